@@ -20,23 +20,53 @@ limitations under the License.
 package fabricsdk
 
 import (
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric/bccsp"
+	"github.com/hyperledger/fabric/common/util"
 	msp "github.com/hyperledger/fabric/msp"
 	"github.com/hyperledger/fabric/protos/common"
+	mb "github.com/hyperledger/fabric/protos/msp"
 	pb "github.com/hyperledger/fabric/protos/peer"
 
 	protos_utils "github.com/hyperledger/fabric/protos/utils"
 	"github.com/op/go-logging"
+	"golang.org/x/net/context"
 
 	config "github.com/hyperledger/fabric-sdk-go/config"
+	events "github.com/hyperledger/fabric-sdk-go/events"
 )
 
 var logger = logging.MustGetLogger("fabric_sdk_go")
 
+const (
+	// ordererAddressesKey is the configuration item key for the list of orderer addresses
+	ordererAddressesKey = "OrdererAddresses"
+	// defaultModificationPolicyID is the policy that must be satisfied to modify a configuration item
+	defaultModificationPolicyID = "DefaultModificationPolicy"
+	// configurationSystemChaincode is the name of the configuration system chaincode
+	configurationSystemChaincode = "cscc"
+	// joinChainFunction is the configuration system chaincode function that makes a peer join a chain
+	joinChainFunction = "JoinChain"
+	// ledgerQuerySystemChaincode is the name of the ledger query system chaincode
+	ledgerQuerySystemChaincode = "qscc"
+	// ledger query system chaincode functions
+	getChainInfoFunction       = "GetChainInfo"
+	getBlockByNumberFunction   = "GetBlockByNumber"
+	getTransactionByIDFunction = "GetTransactionByID"
+	// lifecycleSystemChaincode is the name of the chaincode lifecycle system chaincode
+	lifecycleSystemChaincode = "lccc"
+	// installFunction is the lifecycle system chaincode function that installs a chaincode package on a peer
+	installFunction = "install"
+)
+
 // Chain ...
 /**
  * The “Chain” object captures settings for a channel, which is created by
@@ -53,6 +83,12 @@ type Chain struct {
 	tcertBatchSize  int // The number of tcerts to get in each batch
 	orderers        map[string]*Orderer
 	clientContext   *Client
+	msps            []*mb.MSPConfig
+	policies        map[string]*common.Policy
+	primaryPeer     *Peer
+	eventSource     *Peer
+	// skipEndorserValidation skips the validation of the endorser identities against the chain MSPs
+	skipEndorserValidation bool
 }
 
 // TransactionProposalResponse ...
@@ -90,8 +126,9 @@ func NewChain(name string, client *Client) (*Chain, error) {
 	}
 	p := make(map[string]*Peer)
 	o := make(map[string]*Orderer)
+	policies := make(map[string]*common.Policy)
 	c := &Chain{name: name, securityEnabled: config.IsSecurityEnabled(), peers: p,
-		tcertBatchSize: config.TcertBatchSize(), orderers: o, clientContext: client}
+		tcertBatchSize: config.TcertBatchSize(), orderers: o, clientContext: client, policies: policies}
 	logger.Infof("Constructed Chain instance: %v", c)
 
 	return c, nil
@@ -147,6 +184,48 @@ func (c *Chain) AddPeer(peer *Peer) {
  */
 func (c *Chain) RemovePeer(peer *Peer) {
 	delete(c.peers, peer.GetURL())
+	if c.primaryPeer != nil && c.primaryPeer.GetURL() == peer.GetURL() {
+		c.primaryPeer = nil
+	}
+	if c.eventSource != nil && c.eventSource.GetURL() == peer.GetURL() {
+		c.eventSource = nil
+	}
+}
+
+// SetPrimaryPeer ...
+/**
+ * Set the primary peer of the chain. The primary peer is the peer queried for
+ * information about the chain's ledger. It must have been added to the chain.
+ * @param {Peer} peer An instance of the Peer.
+ */
+func (c *Chain) SetPrimaryPeer(peer *Peer) error {
+	if peer == nil {
+		return fmt.Errorf("peer is nil")
+	}
+	if _, ok := c.peers[peer.GetURL()]; !ok {
+		return fmt.Errorf("peer %s is not a member of chain %s", peer.GetURL(), c.name)
+	}
+	c.primaryPeer = peer
+	return nil
+}
+
+// GetPrimaryPeer ...
+/**
+ * Get the primary peer of the chain. If none has been set, the peer with the
+ * lowest URL is chosen so that repeated queries go to the same peer.
+ * @returns {Peer} The primary peer, nil if the chain has no peers.
+ */
+func (c *Chain) GetPrimaryPeer() *Peer {
+	if c.primaryPeer != nil {
+		return c.primaryPeer
+	}
+	var primaryPeer *Peer
+	for url, p := range c.peers {
+		if primaryPeer == nil || url < primaryPeer.GetURL() {
+			primaryPeer = p
+		}
+	}
+	return primaryPeer
 }
 
 // GetPeers ...
@@ -162,6 +241,49 @@ func (c *Chain) GetPeers() []*Peer {
 	return peersArray
 }
 
+// GetEventSource ...
+/**
+ * Get a connected event source among the peers of the chain. The event source in
+ * use is kept while it is connected, otherwise the primary peer is tried first,
+ * then the other peers with an event source URL in the order of their URL.
+ * @returns {Peer} The peer connected to its event source, see Peer.GetEventHub.
+ */
+func (c *Chain) GetEventSource() (*Peer, error) {
+	if c.eventSource != nil && c.eventSource.IsEventSourceConnected() {
+		return c.eventSource, nil
+	}
+	var candidates []*Peer
+	primaryPeer := c.GetPrimaryPeer()
+	if primaryPeer != nil && primaryPeer.GetEventSourceURL() != "" {
+		candidates = append(candidates, primaryPeer)
+	}
+	var urls []string
+	for url, p := range c.peers {
+		if p != primaryPeer && p.GetEventSourceURL() != "" {
+			urls = append(urls, url)
+		}
+	}
+	sort.Strings(urls)
+	for _, url := range urls {
+		candidates = append(candidates, c.peers[url])
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("No peer of chain %s has an event source", c.name)
+	}
+
+	var errs []string
+	for _, p := range candidates {
+		if err := p.ConnectEventSource(); err != nil {
+			logger.Warningf("Could not use peer %s as event source: %s", p.GetURL(), err)
+			errs = append(errs, err.Error())
+			continue
+		}
+		c.eventSource = p
+		return p, nil
+	}
+	return nil, fmt.Errorf("No event source of chain %s could be connected: %s", c.name, strings.Join(errs, "; "))
+}
+
 // AddOrderer ...
 /**
  * Add orderer endpoint to a chain object, this is a local-only operation.
@@ -172,6 +294,9 @@ func (c *Chain) GetPeers() []*Peer {
  * @param {Orderer} orderer An instance of the Orderer class.
  */
 func (c *Chain) AddOrderer(orderer *Orderer) {
+	if orderer.GetClientContext() == nil {
+		orderer.SetClientContext(c.clientContext)
+	}
 	c.orderers[orderer.url] = orderer
 }
 
@@ -197,6 +322,63 @@ func (c *Chain) GetOrderers() []*Orderer {
 	return orderersArray
 }
 
+// SetMSPs ...
+/**
+ * Set the MSP configurations of the organizations participating in the chain.
+ * They are included in the configuration transaction sent by InitializeChain.
+ * @param {[]MSPConfig} msps The MSP configurations.
+ */
+func (c *Chain) SetMSPs(msps []*mb.MSPConfig) {
+	c.msps = msps
+}
+
+// SetEndorserValidation ...
+/**
+ * Enable or disable the validation of the endorser identities against the MSPs of the chain.
+ * It is enabled by default, and only applies once the MSPs of the chain are set. Without it,
+ * or without MSPs, the endorsement signature is still verified against the certificate it carries,
+ * which any peer with a self-signed certificate can produce.
+ * @param {bool} enabled Whether endorser identities are validated.
+ */
+func (c *Chain) SetEndorserValidation(enabled bool) {
+	c.skipEndorserValidation = !enabled
+}
+
+// IsEndorserValidationEnabled ...
+/**
+ * Determine if endorser identities are validated against the MSPs of the chain.
+ */
+func (c *Chain) IsEndorserValidationEnabled() bool {
+	return !c.skipEndorserValidation
+}
+
+// GetMSPs ...
+/**
+ * Get the MSP configurations of the organizations participating in the chain.
+ */
+func (c *Chain) GetMSPs() []*mb.MSPConfig {
+	return c.msps
+}
+
+// SetPolicy ...
+/**
+ * Add or replace a named signature policy of the chain. The policies are
+ * included in the configuration transaction sent by InitializeChain.
+ * @param {string} name The name the policy is referenced by.
+ * @param {SignaturePolicyEnvelope} policy The signature policy.
+ */
+func (c *Chain) SetPolicy(name string, policy *common.SignaturePolicyEnvelope) error {
+	if name == "" {
+		return fmt.Errorf("policy name is empty")
+	}
+	p, err := protos_utils.MakePolicy(policy)
+	if err != nil {
+		return fmt.Errorf("Could not make policy %s: %v", name, err)
+	}
+	c.policies[name] = p
+	return nil
+}
+
 // InitializeChain ...
 /**
  * Calls the orderer(s) to start building the new chain, which is a combination
@@ -204,10 +386,41 @@ func (c *Chain) GetOrderers() []*Orderer {
  * This is a long-running process. Only one of the application instances needs
  * to call this method. Once the chain is successfully created, other application
  * instances only need to call getChain() to obtain the information about this chain.
- * @returns {bool} Whether the chain initialization process was successful.
+ * @returns {error} nil if the chain initialization process was successful.
  */
-func (c *Chain) InitializeChain() bool {
-	return false
+func (c *Chain) InitializeChain() error {
+	if c.orderers == nil || len(c.orderers) == 0 {
+		return fmt.Errorf("orderers is nil")
+	}
+	user, err := c.clientContext.GetUserContext("")
+	if err != nil {
+		return fmt.Errorf("GetUserContext return error: %s", err)
+	}
+	if user == nil {
+		return fmt.Errorf("user context is nil")
+	}
+
+	configEnvelope, err := c.buildConfigurationEnvelope(user)
+	if err != nil {
+		return fmt.Errorf("Could not build configuration envelope: %v", err)
+	}
+	configEnvelopeBytes, err := proto.Marshal(configEnvelope)
+	if err != nil {
+		return fmt.Errorf("Could not marshal configuration envelope: %v", err)
+	}
+
+	envelope, err := createSignedEnvelope(c.clientContext, user, c.name, common.HeaderType_CONFIGURATION_TRANSACTION, configEnvelopeBytes)
+	if err != nil {
+		return err
+	}
+
+	for _, o := range c.orderers {
+		logger.Debugf("Send configuration transaction to orderer :%s\n", o.GetURL())
+		if err := o.SendBroadcast(envelope); err != nil {
+			return fmt.Errorf("Error calling orderer '%s':  %s", o.GetURL(), err)
+		}
+	}
+	return nil
 }
 
 // UpdateChain ...
@@ -236,40 +449,328 @@ func (c *Chain) IsReadonly() bool {
 /**
  * Queries for various useful information on the state of the Chain
  * (height, known peers).
- * @returns {object} With height, currently the only useful info.
+ * @returns {BlockchainInfo} With height and the hashes of the current and previous blocks.
  */
-func (c *Chain) QueryInfo() {
-	//to do
+func (c *Chain) QueryInfo() (*pb.BlockchainInfo, error) {
+	payload, err := c.queryBySystemChaincode(getChainInfoFunction, []byte(c.name))
+	if err != nil {
+		return nil, err
+	}
+	bci := &pb.BlockchainInfo{}
+	if err := proto.Unmarshal(payload, bci); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal BlockchainInfo: %v", err)
+	}
+	return bci, nil
 }
 
 // QueryBlock ...
 /**
  * Queries the ledger for Block by block number.
  * @param {int} blockNumber The number which is the ID of the Block.
- * @returns {object} Object containing the block.
+ * @returns {Block} The block.
  */
-func (c *Chain) QueryBlock(blockNumber int) {
-	//to do
+func (c *Chain) QueryBlock(blockNumber int) (*common.Block, error) {
+	if blockNumber < 0 {
+		return nil, fmt.Errorf("blockNumber must be a non-negative integer")
+	}
+	payload, err := c.queryBySystemChaincode(getBlockByNumberFunction, []byte(c.name), []byte(strconv.Itoa(blockNumber)))
+	if err != nil {
+		return nil, err
+	}
+	block, err := protos_utils.GetBlockFromBlockBytes(payload)
+	if err != nil {
+		return nil, fmt.Errorf("Could not unmarshal Block: %v", err)
+	}
+	return block, nil
 }
 
 // QueryTransaction ...
 /**
- * Queries the ledger for Transaction by number.
- * @param {int} transactionID
- * @returns {object} Transaction information containing the transaction.
+ * Queries the ledger for Transaction by transaction ID.
+ * @param {string} transactionID
+ * @returns {Envelope} The processed transaction envelope, as committed in the block.
+ */
+func (c *Chain) QueryTransaction(transactionID string) (*common.Envelope, error) {
+	if transactionID == "" {
+		return nil, fmt.Errorf("transactionID is empty")
+	}
+	payload, err := c.queryBySystemChaincode(getTransactionByIDFunction, []byte(c.name), []byte(transactionID))
+	if err != nil {
+		return nil, err
+	}
+	envelope, err := protos_utils.UnmarshalEnvelope(payload)
+	if err != nil {
+		return nil, fmt.Errorf("Could not unmarshal Envelope: %v", err)
+	}
+	return envelope, nil
+}
+
+// NewLedgerBlockReplay ...
+/**
+ * Returns an events.BlockReplay retrieving the blocks of the chain by ledger
+ * queries to the primary peer, up to the ledger height at the time of the replay.
+ */
+func (c *Chain) NewLedgerBlockReplay() events.BlockReplay {
+	return func(ctx context.Context, start uint64) (<-chan *common.Block, <-chan error) {
+		blocks := make(chan *common.Block)
+		errs := make(chan error, 1)
+		go func() {
+			defer close(errs)
+			defer close(blocks)
+			bci, err := c.QueryInfo()
+			if err != nil {
+				errs <- err
+				return
+			}
+			for n := start; n < bci.Height; n++ {
+				block, err := c.QueryBlock(int(n))
+				if err != nil {
+					errs <- fmt.Errorf("Could not query block %d: %s", n, err)
+					return
+				}
+				select {
+				case blocks <- block:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		return blocks, errs
+	}
+}
+
+// queryBySystemChaincode invokes a function of the ledger query system chaincode on the
+// primary peer and returns the response payload
+func (c *Chain) queryBySystemChaincode(function string, args ...[]byte) ([]byte, error) {
+	peer := c.GetPrimaryPeer()
+	if peer == nil {
+		return nil, fmt.Errorf("peers is nil")
+	}
+	signedProposal, _, err := c.CreateSystemChaincodeProposal(ledgerQuerySystemChaincode, "",
+		append([][]byte{[]byte(function)}, args...), util.GenerateUUID())
+	if err != nil {
+		return nil, fmt.Errorf("Could not create %s proposal: %v", function, err)
+	}
+	response := sendProposalToPeers(signedProposal, []*Peer{peer})[peer.GetURL()]
+	if response.Err != nil {
+		return nil, response.Err
+	}
+	if err := checkProposalResponseStatus(function, response); err != nil {
+		return nil, err
+	}
+	return response.ProposalResponse.GetResponse().Payload, nil
+}
+
+// checkProposalResponseStatus returns an error if the peer didn't execute the function successfully
+func checkProposalResponseStatus(function string, r *TransactionProposalResponse) error {
+	response := r.ProposalResponse.GetResponse()
+	if response == nil {
+		return fmt.Errorf("%s failed on peer '%s', response is empty", function, r.Endorser)
+	}
+	if response.Status != 200 {
+		return fmt.Errorf("%s failed on peer '%s', error code %d, msg %s", function, r.Endorser, response.Status, response.Message)
+	}
+	return nil
+}
+
+// JoinPeers ...
+/**
+ * Asks the peers to join the chain. A signed proposal carrying the genesis block
+ * of the chain is sent to the configuration system chaincode of each peer.
+ * @param {Block} genesisBlock The genesis block of the chain, as returned by the orderer.
+ * @param {[]Peer} peers The peers that should join the chain. The peers of the chain are used if none are given.
+ * @returns {map[string]*TransactionProposalResponse} The responses of the peers keyed by peer URL.
+ */
+func (c *Chain) JoinPeers(genesisBlock *common.Block, peers ...*Peer) (map[string]*TransactionProposalResponse, error) {
+	if genesisBlock == nil {
+		return nil, fmt.Errorf("genesisBlock is nil")
+	}
+	if len(peers) == 0 {
+		peers = c.GetPeers()
+	}
+	if len(peers) == 0 {
+		return nil, fmt.Errorf("peers is nil")
+	}
+	genesisBlockBytes, err := proto.Marshal(genesisBlock)
+	if err != nil {
+		return nil, fmt.Errorf("Could not marshal genesis block: %v", err)
+	}
+
+	args := [][]byte{[]byte(joinChainFunction), genesisBlockBytes}
+	// system chaincode proposals are not bound to a chain
+	signedProposal, _, err := c.CreateSystemChaincodeProposal(configurationSystemChaincode, "", args, util.GenerateUUID())
+	if err != nil {
+		return nil, fmt.Errorf("Could not create join chain proposal: %v", err)
+	}
+
+	responses := sendProposalToPeers(signedProposal, peers)
+	for _, r := range responses {
+		if r.Err == nil {
+			r.Err = checkProposalResponseStatus(joinChainFunction, r)
+		}
+	}
+	return responses, nil
+}
+
+// InstallChaincode ...
+/**
+ * Sends a chaincode install proposal to the target peers. The chaincode package
+ * is stored on each peer; the chaincode must then be instantiated on the chain
+ * before it can be invoked.
+ * @param {string} chaincodeName The name of the chaincode.
+ * @param {string} chaincodePath The import path of the chaincode.
+ * @param {[]byte} chaincodePackage The code package of the chaincode, a gzipped tar of the source tree.
+ * @param {[]Peer} targets The peers to install the chaincode on. The peers of the chain are used if none are given.
+ * @returns {map[string]*TransactionProposalResponse} The responses of the peers keyed by peer URL.
+ */
+func (c *Chain) InstallChaincode(chaincodeName string, chaincodePath string, chaincodePackage []byte, targets []*Peer) (map[string]*TransactionProposalResponse, error) {
+	if chaincodeName == "" {
+		return nil, fmt.Errorf("chaincodeName is empty")
+	}
+	if chaincodePath == "" {
+		return nil, fmt.Errorf("chaincodePath is empty")
+	}
+	if len(chaincodePackage) == 0 {
+		return nil, fmt.Errorf("chaincodePackage is empty")
+	}
+	if len(targets) == 0 {
+		targets = c.GetPeers()
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("peers is nil")
+	}
+
+	cds := newChaincodeDeploymentSpec(chaincodeName, chaincodePath, nil, chaincodePackage)
+	cdsBytes, err := proto.Marshal(cds)
+	if err != nil {
+		return nil, fmt.Errorf("Could not marshal ChaincodeDeploymentSpec: %v", err)
+	}
+	// installation is a peer-level operation which isn't bound to a chain
+	signedProposal, _, err := c.CreateSystemChaincodeProposal(lifecycleSystemChaincode, "",
+		[][]byte{[]byte(installFunction), cdsBytes}, util.GenerateUUID())
+	if err != nil {
+		return nil, fmt.Errorf("Could not create install proposal: %v", err)
+	}
+
+	responses := sendProposalToPeers(signedProposal, targets)
+	for _, r := range responses {
+		if r.Err == nil {
+			r.Err = checkProposalResponseStatus(installFunction, r)
+		}
+	}
+	return responses, nil
+}
+
+// InstantiateChaincode ...
+/**
+ * Instantiates an installed chaincode on the chain. The deploy proposal is endorsed
+ * by the peers of the chain and the resulting transaction is sent to the orderers.
+ * @param {string} chaincodeName The name of the chaincode.
+ * @param {string} chaincodePath The import path of the chaincode.
+ * @param {[]string} args The arguments passed to the chaincode Init function.
+ * @returns {string} The ID of the transaction, used to wait for its commit.
+ * @returns {map[string]*TransactionResponse} The responses of the orderers keyed by orderer URL.
  */
-func (c *Chain) QueryTransaction(transactionID int) {
-	//to do
+func (c *Chain) InstantiateChaincode(chaincodeName string, chaincodePath string, args []string) (string, map[string]*TransactionResponse, error) {
+	return c.sendDeploymentTransaction(chaincodeName, chaincodePath, args, false)
+}
+
+// UpgradeChaincode ...
+/**
+ * Upgrades an instantiated chaincode on the chain to a newly installed chaincode
+ * package. The upgrade goes through the same endorsement and ordering as InstantiateChaincode.
+ * @param {string} chaincodeName The name of the chaincode.
+ * @param {string} chaincodePath The import path of the chaincode.
+ * @param {[]string} args The arguments passed to the chaincode Init function.
+ * @returns {string} The ID of the transaction, used to wait for its commit.
+ * @returns {map[string]*TransactionResponse} The responses of the orderers keyed by orderer URL.
+ */
+func (c *Chain) UpgradeChaincode(chaincodeName string, chaincodePath string, args []string) (string, map[string]*TransactionResponse, error) {
+	return c.sendDeploymentTransaction(chaincodeName, chaincodePath, args, true)
+}
+
+// sendDeploymentTransaction endorses a deploy or upgrade proposal and sends the resulting transaction to the orderers
+func (c *Chain) sendDeploymentTransaction(chaincodeName string, chaincodePath string, args []string, upgrade bool) (string, map[string]*TransactionResponse, error) {
+	if chaincodeName == "" {
+		return "", nil, fmt.Errorf("chaincodeName is empty")
+	}
+	if chaincodePath == "" {
+		return "", nil, fmt.Errorf("chaincodePath is empty")
+	}
+	user, err := c.clientContext.GetUserContext("")
+	if err != nil {
+		return "", nil, fmt.Errorf("GetUserContext return error: %s", err)
+	}
+	creatorID, err := getSerializedIdentity(user)
+	if err != nil {
+		return "", nil, err
+	}
+
+	argsArray := make([][]byte, len(args))
+	for i, arg := range args {
+		argsArray[i] = []byte(arg)
+	}
+	cds := newChaincodeDeploymentSpec(chaincodeName, chaincodePath, argsArray, nil)
+	txid := util.GenerateUUID()
+	var proposal *pb.Proposal
+	if upgrade {
+		proposal, err = protos_utils.CreateUpgradeProposalFromCDS(txid, c.name, cds, creatorID)
+	} else {
+		proposal, err = protos_utils.CreateDeployProposalFromCDS(txid, c.name, cds, creatorID)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("Could not create deployment proposal: %v", err)
+	}
+	signedProposal, err := signProposal(c.clientContext, user.GetPrivateKey(), proposal)
+	if err != nil {
+		return "", nil, err
+	}
+
+	transactionProposalResponses, err := c.SendTransactionProposal(signedProposal, 0)
+	if err != nil {
+		return "", nil, err
+	}
+	tx, _, err := c.CreateTransactionFromResponses(proposal, transactionProposalResponses, FailOnDivergence)
+	if err != nil {
+		return "", nil, fmt.Errorf("CreateTransaction return error: %v", err)
+	}
+	transactionResponses, err := c.SendTransaction(proposal, tx)
+	if err != nil {
+		return "", nil, fmt.Errorf("SendTransaction return error: %v", err)
+	}
+	return txid, transactionResponses, nil
+}
+
+// newChaincodeDeploymentSpec creates a deployment spec for a Go chaincode
+func newChaincodeDeploymentSpec(chaincodeName string, chaincodePath string, args [][]byte, codePackage []byte) *pb.ChaincodeDeploymentSpec {
+	spec := &pb.ChaincodeSpec{Type: pb.ChaincodeSpec_GOLANG,
+		ChaincodeID: &pb.ChaincodeID{Name: chaincodeName, Path: chaincodePath},
+		Input:       &pb.ChaincodeInput{Args: args}}
+	return &pb.ChaincodeDeploymentSpec{ChaincodeSpec: spec, CodePackage: codePackage}
 }
 
 // CreateTransactionProposal ...
 /**
  * Create  a proposal for transaction. This involves assembling the proposal
  * with the data (chaincodeName, function to call, arguments, transient data, etc.) and signing it using the private key corresponding to the
- * ECert to sign.
+ * ECert to sign. When security is enabled and the user context has msp services, the proposal is
+ * signed with a TCert from the user's pool instead, so that the user's transactions are unlinkable.
  */
 func (c *Chain) CreateTransactionProposal(chaincodeName string, chainID string, args []string, sign bool, txid string, transientData []byte) (*pb.SignedProposal, *pb.Proposal, error) {
+	user, err := c.clientContext.GetUserContext("")
+	if err != nil {
+		return nil, nil, fmt.Errorf("GetUserContext return error: %s", err)
+	}
+	return c.CreateTransactionProposalForUser(user, chaincodeName, chainID, args, sign, txid, transientData)
+}
 
+// CreateTransactionProposalForUser ...
+/**
+ * Create a proposal for transaction on behalf of a user, instead of the user context of the client.
+ * @param {User} user The user creating and signing the proposal.
+ * See CreateTransactionProposal for the other parameters.
+ */
+func (c *Chain) CreateTransactionProposalForUser(user *User, chaincodeName string, chainID string, args []string, sign bool, txid string, transientData []byte) (*pb.SignedProposal, *pb.Proposal, error) {
 	argsArray := make([][]byte, len(args))
 	for i, arg := range args {
 		argsArray[i] = []byte(arg)
@@ -278,14 +779,47 @@ func (c *Chain) CreateTransactionProposal(chaincodeName string, chainID string,
 		Type: pb.ChaincodeSpec_GOLANG, ChaincodeID: &pb.ChaincodeID{Name: chaincodeName},
 		Input: &pb.ChaincodeInput{Args: argsArray}}}
 
+	return c.createProposal(user, ccis, chainID, txid, transientData, c.securityEnabled)
+}
+
+// CreateSystemChaincodeProposal ...
+/**
+ * Create a signed proposal invoking a system chaincode (for example the configuration
+ * or the ledger query system chaincode) with raw arguments.
+ * @param {string} chaincodeName The name of the system chaincode.
+ * @param {string} chainID The chain the proposal is bound to, empty for peer-level operations.
+ * @param {[][]byte} args The function name followed by its arguments.
+ * @param {string} txid The transaction ID of the proposal.
+ */
+func (c *Chain) CreateSystemChaincodeProposal(chaincodeName string, chainID string, args [][]byte, txid string) (*pb.SignedProposal, *pb.Proposal, error) {
+	ccis := &pb.ChaincodeInvocationSpec{ChaincodeSpec: &pb.ChaincodeSpec{
+		Type: pb.ChaincodeSpec_GOLANG, ChaincodeID: &pb.ChaincodeID{Name: chaincodeName},
+		Input: &pb.ChaincodeInput{Args: args}}}
+
 	user, err := c.clientContext.GetUserContext("")
 	if err != nil {
 		return nil, nil, fmt.Errorf("GetUserContext return error: %s", err)
 	}
-	serializedIdentity := &msp.SerializedIdentity{Mspid: config.GetMspID(), IdBytes: user.GetEnrollmentCertificate()}
-	creatorID, err := proto.Marshal(serializedIdentity)
+	return c.createProposal(user, ccis, chainID, txid, nil, false)
+}
+
+// createProposal creates a proposal from a ChaincodeInvocationSpec and signs it with the user's key,
+// or with the key of one of its TCerts when anonymous is set and the user has msp services
+func (c *Chain) createProposal(user *User, ccis *pb.ChaincodeInvocationSpec, chainID string, txid string, transientData []byte, anonymous bool) (*pb.SignedProposal, *pb.Proposal, error) {
+	if user == nil {
+		return nil, nil, fmt.Errorf("user is nil")
+	}
+	cert, key := user.GetEnrollmentCertificate(), user.GetPrivateKey()
+	if anonymous && user.GetMSPServices() != nil {
+		tcert, err := user.takeTcert(c.tcertBatchSize)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Could not get a TCert: %v", err)
+		}
+		cert, key = tcert.Certificate, tcert.PrivateKey
+	}
+	creatorID, err := serializeIdentity(user.GetMspID(), cert)
 	if err != nil {
-		return nil, nil, fmt.Errorf("Could not Marshal serializedIdentity, err %s", err)
+		return nil, nil, err
 	}
 	// create a proposal from a ChaincodeInvocationSpec
 	proposal, err := protos_utils.CreateChaincodeProposalWithTransient(txid, common.HeaderType_ENDORSER_TRANSACTION, chainID, ccis, creatorID, transientData)
@@ -293,22 +827,24 @@ func (c *Chain) CreateTransactionProposal(chaincodeName string, chainID string,
 		return nil, nil, fmt.Errorf("Could not create chaincode proposal, err %s", err)
 	}
 
-	proposalBytes, err := protos_utils.GetBytesProposal(proposal)
+	signedProposal, err := signProposal(c.clientContext, key, proposal)
 	if err != nil {
 		return nil, nil, err
 	}
-	cryptoSuite := c.clientContext.GetCryptoSuite()
-	digest, err := cryptoSuite.Hash(proposalBytes, &bccsp.SHAOpts{})
+	return signedProposal, proposal, nil
+}
+
+// signProposal signs the proposal with the key
+func signProposal(client *Client, key bccsp.Key, proposal *pb.Proposal) (*pb.SignedProposal, error) {
+	proposalBytes, err := protos_utils.GetBytesProposal(proposal)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	signature, err := cryptoSuite.Sign(user.GetPrivateKey(),
-		digest, nil)
+	signature, err := signObjectWithKey(client, key, proposalBytes)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	signedProposal := &pb.SignedProposal{ProposalBytes: proposalBytes, Signature: signature}
-	return signedProposal, proposal, nil
+	return &pb.SignedProposal{ProposalBytes: proposalBytes, Signature: signature}, nil
 }
 
 // SendTransactionProposal ...
@@ -320,11 +856,100 @@ func (c *Chain) SendTransactionProposal(signedProposal *pb.SignedProposal, retry
 	if signedProposal == nil {
 		return nil, fmt.Errorf("signedProposal is nil")
 	}
+	mspManager, err := c.newMSPManager()
+	if err != nil {
+		return nil, err
+	}
+	responses := sendProposalToPeers(signedProposal, c.GetPeers())
+	for _, r := range responses {
+		if r.Err != nil || r.ProposalResponse.GetResponse() == nil || r.ProposalResponse.Response.Status != 200 {
+			continue
+		}
+		if err := c.verifyProposalResponse(mspManager, r.ProposalResponse); err != nil {
+			logger.Warningf("Rejecting proposal response of endorser %s: %s\n", r.Endorser, err)
+			r.Err = fmt.Errorf("Invalid proposal response from endorser %s: %s", r.Endorser, err)
+		}
+	}
+	return responses, nil
+}
+
+// newMSPManager sets up an MSP manager with the MSPs of the chain. It returns nil when
+// endorser validation is disabled or when the chain has no MSPs to validate with.
+func (c *Chain) newMSPManager() (msp.MSPManager, error) {
+	if c.skipEndorserValidation {
+		return nil, nil
+	}
+	if len(c.msps) == 0 {
+		logger.Warningf("Chain %s has no MSPs, only the endorsement signatures are verified\n", c.name)
+		return nil, nil
+	}
+	mspManager := msp.NewMSPManager()
+	if err := mspManager.Setup(c.msps); err != nil {
+		return nil, fmt.Errorf("Could not set up the MSPs of the chain: %s", err)
+	}
+	return mspManager, nil
+}
+
+// verifyProposalResponse checks the endorsement signature over the response payload and the endorser
+// identity. With an MSP manager, the endorser identity must also be valid for one of the MSPs.
+func (c *Chain) verifyProposalResponse(mspManager msp.MSPManager, response *pb.ProposalResponse) error {
+	endorsement := response.Endorsement
+	if endorsement == nil {
+		return fmt.Errorf("Proposal response has no endorsement")
+	}
+	serializedIdentity := &msp.SerializedIdentity{}
+	if err := proto.Unmarshal(endorsement.Endorser, serializedIdentity); err != nil {
+		return fmt.Errorf("Could not unmarshal endorser identity: %s", err)
+	}
+
+	if mspManager != nil {
+		identity, err := mspManager.DeserializeIdentity(endorsement.Endorser)
+		if err != nil {
+			return fmt.Errorf("Could not deserialize endorser identity: %s", err)
+		}
+		if err := identity.Validate(); err != nil {
+			return fmt.Errorf("Endorser identity is not valid: %s", err)
+		}
+	}
+
+	cryptoSuite := c.clientContext.GetCryptoSuite()
+	if cryptoSuite == nil {
+		return fmt.Errorf("cryptoSuite is nil")
+	}
+	block, _ := pem.Decode(serializedIdentity.IdBytes)
+	if block == nil {
+		return fmt.Errorf("Could not decode endorser certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("Could not parse endorser certificate: %s", err)
+	}
+	publicKey, err := cryptoSuite.KeyImport(cert, &bccsp.X509PublicKeyImportOpts{Temporary: true})
+	if err != nil {
+		return fmt.Errorf("Could not import endorser public key: %s", err)
+	}
+	digest, err := cryptoSuite.Hash(util.ConcatenateBytes(response.Payload, endorsement.Endorser), &bccsp.SHAOpts{})
+	if err != nil {
+		return fmt.Errorf("Could not hash proposal response: %s", err)
+	}
+	valid, err := cryptoSuite.Verify(publicKey, endorsement.Signature, digest, nil)
+	if err != nil {
+		return fmt.Errorf("Could not verify endorsement signature: %s", err)
+	}
+	if !valid {
+		return fmt.Errorf("Endorsement signature is invalid")
+	}
+	return nil
+}
+
+// sendProposalToPeers sends the signed proposal to the peers concurrently and collects their responses
+func sendProposalToPeers(signedProposal *pb.SignedProposal, peers []*Peer) map[string]*TransactionProposalResponse {
 	transactionProposalResponseMap := make(map[string]*TransactionProposalResponse)
+	var mutex sync.Mutex
 	var wg sync.WaitGroup
-	for _, p := range c.peers {
+	for _, p := range peers {
 		wg.Add(1)
-		go func(peer *Peer, wg *sync.WaitGroup, tprm map[string]*TransactionProposalResponse) {
+		go func(peer *Peer) {
 			defer wg.Done()
 			var err error
 			var proposalResponse *pb.ProposalResponse
@@ -334,28 +959,35 @@ func (c *Chain) SendTransactionProposal(signedProposal *pb.SignedProposal, retry
 				logger.Debugf("Receive Error Response :%v\n", proposalResponse)
 				transactionProposalResponse = &TransactionProposalResponse{peer.GetURL(), nil, fmt.Errorf("Error calling endorser '%s':  %s", peer.GetURL(), err)}
 			} else {
-				prp1, _ := protos_utils.GetProposalResponsePayload(proposalResponse.Payload)
-				act1, _ := protos_utils.GetChaincodeAction(prp1.Extension)
-				logger.Debugf("%s ProposalResponsePayload Extension ChaincodeAction Results\n%s\n", peer.GetURL(), string(act1.Results))
-
 				logger.Debugf("Receive Proposal ChaincodeActionResponse :%v\n", proposalResponse)
 				transactionProposalResponse = &TransactionProposalResponse{peer.GetURL(), proposalResponse, nil}
 			}
-			tprm[transactionProposalResponse.Endorser] = transactionProposalResponse
-		}(p, &wg, transactionProposalResponseMap)
+			mutex.Lock()
+			transactionProposalResponseMap[transactionProposalResponse.Endorser] = transactionProposalResponse
+			mutex.Unlock()
+		}(p)
 	}
 	wg.Wait()
-	return transactionProposalResponseMap, nil
+	return transactionProposalResponseMap
 }
 
 // CreateTransaction ...
 /**
  * Create a transaction with proposal response, following the endorsement policy.
+ * The transaction is refused when the responses are not over the same ProposalResponsePayload;
+ * CreateTransactionFromResponses names the divergent endorsers by endpoint and can drop the minority.
+ * @param {Proposal} proposal The proposal that was endorsed.
+ * @param {[]ProposalResponse} resps The endorsements of the proposal.
+ * @param {SignaturePolicyEnvelope} policy Optional endorsement policy of the chaincode. When given,
+ * the transaction is refused if the endorsements do not satisfy it, since the committers would invalidate it.
  */
-func (c *Chain) CreateTransaction(proposal *pb.Proposal, resps []*pb.ProposalResponse) (*pb.Transaction, error) {
+func (c *Chain) CreateTransaction(proposal *pb.Proposal, resps []*pb.ProposalResponse, policy ...*common.SignaturePolicyEnvelope) (*pb.Transaction, error) {
 	if len(resps) == 0 {
 		return nil, fmt.Errorf("At least one proposal response is necessary")
 	}
+	if len(policy) > 1 {
+		return nil, fmt.Errorf("At most one endorsement policy can be given")
+	}
 
 	// the original header
 	hdr, err := protos_utils.GetHeader(proposal.Header)
@@ -375,35 +1007,41 @@ func (c *Chain) CreateTransaction(proposal *pb.Proposal, resps []*pb.ProposalRes
 		return nil, err
 	}
 
-	// This code is commented out because the ProposalResponsePayload Extension ChaincodeAction Results
-	// return from endorsements is different so the compare will fail
-
-	//	var a1 []byte
-	//	for n, r := range resps {
-	//		if n == 0 {
-	//			a1 = r.Payload
-	//			if r.Response.Status != 200 {
-	//				return nil, fmt.Errorf("Proposal response was not successful, error code %d, msg %s", r.Response.Status, r.Response.Message)
-	//			}
-	//			continue
-	//		}
-
-	//		if bytes.Compare(a1, r.Payload) != 0 {
-	//			return nil, fmt.Errorf("ProposalResponsePayloads do not match")
-	//		}
-	//	}
-
-	for _, r := range resps {
+	for n, r := range resps {
+		if r == nil || r.Response == nil {
+			return nil, fmt.Errorf("Proposal response %d has no response", n)
+		}
+		if r.Endorsement == nil {
+			return nil, fmt.Errorf("Proposal response %d has no endorsement", n)
+		}
 		if r.Response.Status != 200 {
 			return nil, fmt.Errorf("Proposal response was not successful, error code %d, msg %s", r.Response.Status, r.Response.Message)
 		}
 	}
 
+	// all the endorsements must be over the same ProposalResponsePayload
+	names := make([]string, len(resps))
+	for n := range resps {
+		names[n] = fmt.Sprintf("response %d", n)
+	}
+	if _, err := compareProposalResponses(names, resps); err != nil {
+		return nil, err
+	}
+
 	// fill endorsements
 	endorsements := make([]*pb.Endorsement, len(resps))
 	for n, r := range resps {
 		endorsements[n] = r.Endorsement
 	}
+	if len(policy) == 1 {
+		endorsementPolicy, err := NewEndorsementPolicy(policy[0], c.msps)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid endorsement policy: %s", err)
+		}
+		if err := endorsementPolicy.Evaluate(endorsements); err != nil {
+			return nil, err
+		}
+	}
 	// create ChaincodeEndorsedAction
 	cea := &pb.ChaincodeEndorsedAction{ProposalResponsePayload: resps[0].Payload, Endorsements: endorsements}
 
@@ -436,6 +1074,49 @@ func (c *Chain) CreateTransaction(proposal *pb.Proposal, resps []*pb.ProposalRes
 
 }
 
+// CreateTransactionFromResponses ...
+/**
+ * Create a transaction from the responses returned by SendTransactionProposal. The endorsers are
+ * named by their endpoint in the errors, and divergent endorsers are handled as CheckProposalResponses does.
+ * @param {Proposal} proposal The proposal that was endorsed.
+ * @param {map} responses The responses of the endorsers, keyed by endpoint. They must all be successful.
+ * @param {ResponseConsistency} consistency Whether to fail or to drop the minority endorsers on divergence.
+ * @param {SignaturePolicyEnvelope} policy Optional endorsement policy of the chaincode, checked on the kept endorsements.
+ * @returns {Transaction} The transaction.
+ * @returns {[]TransactionProposalResponse} The responses of the endorsers kept in the transaction, ordered by endpoint.
+ */
+func (c *Chain) CreateTransactionFromResponses(proposal *pb.Proposal, responses map[string]*TransactionProposalResponse,
+	consistency ResponseConsistency, policy ...*common.SignaturePolicyEnvelope) (*pb.Transaction, []*TransactionProposalResponse, error) {
+	for endorser, r := range responses {
+		if r == nil {
+			return nil, nil, fmt.Errorf("Endorser %s has no response", endorser)
+		}
+		if r.Err != nil {
+			return nil, nil, fmt.Errorf("Endorser %s return error: %v", endorser, r.Err)
+		}
+		if r.ProposalResponse == nil || r.ProposalResponse.Response == nil {
+			return nil, nil, fmt.Errorf("Endorser %s returned a proposal response without response", endorser)
+		}
+		if r.ProposalResponse.Response.Status != 200 {
+			return nil, nil, fmt.Errorf("Proposal response of endorser %s was not successful, error code %d, msg %s",
+				endorser, r.ProposalResponse.Response.Status, r.ProposalResponse.Response.Message)
+		}
+	}
+	consistent, err := CheckProposalResponses(responses, consistency)
+	if err != nil {
+		return nil, nil, err
+	}
+	resps := make([]*pb.ProposalResponse, len(consistent))
+	for i, r := range consistent {
+		resps[i] = r.ProposalResponse
+	}
+	tx, err := c.CreateTransaction(proposal, resps, policy...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tx, consistent, nil
+}
+
 // SendTransaction ...
 /**
  * Send a transaction to the chain’s orderer service (one or more orderer endpoints) for consensus and committing to the ledger.
@@ -450,6 +1131,26 @@ func (c *Chain) CreateTransaction(proposal *pb.Proposal, resps []*pb.ProposalRes
  * These events should cause the method to emit “complete” or “error” events to the application.
  */
 func (c *Chain) SendTransaction(proposal *pb.Proposal, tx *pb.Transaction) (map[string]*TransactionResponse, error) {
+	return c.sendTransaction(nil, proposal, tx)
+}
+
+// SendTransactionForUser ...
+/**
+ * Send a transaction to the orderers on behalf of a user, instead of the user who created the proposal
+ * among the users of the client.
+ * @param {User} user The user who created the proposal.
+ * See SendTransaction for the other parameters.
+ */
+func (c *Chain) SendTransactionForUser(user *User, proposal *pb.Proposal, tx *pb.Transaction) (map[string]*TransactionResponse, error) {
+	if user == nil {
+		return nil, fmt.Errorf("user is nil")
+	}
+	return c.sendTransaction(user, proposal, tx)
+}
+
+// sendTransaction signs the transaction with the key the proposal was created with, the key of the
+// user or, when it is nil, of the client's user who created the proposal
+func (c *Chain) sendTransaction(user *User, proposal *pb.Proposal, tx *pb.Transaction) (map[string]*TransactionResponse, error) {
 	if c.orderers == nil || len(c.orderers) == 0 {
 		return nil, fmt.Errorf("orderers is nil")
 	}
@@ -477,17 +1178,24 @@ func (c *Chain) SendTransaction(proposal *pb.Proposal, tx *pb.Transaction) (map[
 		return nil, err
 	}
 
-	cryptoSuite := c.clientContext.GetCryptoSuite()
-	digest, err := cryptoSuite.Hash(paylBytes, &bccsp.SHAOpts{})
-	if err != nil {
-		return nil, err
+	// sign with the key of the certificate the proposal was created with
+	if hdr.SignatureHeader == nil {
+		return nil, fmt.Errorf("The proposal header has no signature header")
+	}
+	creator := &msp.SerializedIdentity{}
+	if err := proto.Unmarshal(hdr.SignatureHeader.Creator, creator); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal the proposal creator")
+	}
+	var key bccsp.Key
+	if user != nil {
+		key, err = user.getSigningKey(creator.IdBytes)
+	} else {
+		key, err = c.clientContext.getSigningKey(creator.Mspid, creator.IdBytes)
 	}
-	user, err := c.clientContext.GetUserContext("")
 	if err != nil {
-		return nil, fmt.Errorf("GetUserContext return error: %s\n", err)
+		return nil, err
 	}
-	signature, err := cryptoSuite.Sign(user.GetPrivateKey(),
-		digest, nil)
+	signature, err := signObjectWithKey(c.clientContext, key, paylBytes)
 	if err != nil {
 		return nil, err
 	}
@@ -518,3 +1226,143 @@ func (c *Chain) SendTransaction(proposal *pb.Proposal, tx *pb.Transaction) (map[
 	return transactionResponseMap, nil
 
 }
+
+// buildConfigurationEnvelope builds the signed configuration items describing
+// the chain: the orderer addresses, the MSPs and the policies.
+func (c *Chain) buildConfigurationEnvelope(user *User) (*common.ConfigurationEnvelope, error) {
+	var items []*common.ConfigurationItem
+
+	// the addresses and policies are appended in order so the envelope does not depend on map iteration
+	var addresses []string
+	for _, o := range c.orderers {
+		addresses = append(addresses, o.GetURL())
+	}
+	sort.Strings(addresses)
+	ordererAddresses, err := proto.Marshal(&common.OrdererAddresses{Addresses: addresses})
+	if err != nil {
+		return nil, err
+	}
+	items = append(items, c.makeConfigurationItem(common.ConfigurationItem_Chain, ordererAddressesKey, ordererAddresses))
+
+	for _, m := range c.msps {
+		fabricMSPConfig := &mb.FabricMSPConfig{}
+		if err := proto.Unmarshal(m.Config, fabricMSPConfig); err != nil {
+			return nil, fmt.Errorf("Could not unmarshal fabric MSP config: %v", err)
+		}
+		mspBytes, err := proto.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, c.makeConfigurationItem(common.ConfigurationItem_MSP, fabricMSPConfig.Name, mspBytes))
+	}
+
+	policyNames := make([]string, 0, len(c.policies))
+	for name := range c.policies {
+		policyNames = append(policyNames, name)
+	}
+	sort.Strings(policyNames)
+	for _, name := range policyNames {
+		policyBytes, err := proto.Marshal(c.policies[name])
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, c.makeConfigurationItem(common.ConfigurationItem_Policy, name, policyBytes))
+	}
+
+	creator, err := getSerializedIdentity(user)
+	if err != nil {
+		return nil, err
+	}
+	signedItems := make([]*common.SignedConfigurationItem, len(items))
+	for i, item := range items {
+		itemBytes, err := proto.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		nonce, err := protos_utils.CreateNonce()
+		if err != nil {
+			return nil, err
+		}
+		sigHeaderBytes, err := protos_utils.GetBytesSignatureHeader(protos_utils.MakeSignatureHeader(creator, nonce))
+		if err != nil {
+			return nil, err
+		}
+		// the signature covers the concatenation of the item and the signature header
+		signature, err := signObject(c.clientContext, user, util.ConcatenateBytes(itemBytes, sigHeaderBytes))
+		if err != nil {
+			return nil, err
+		}
+		signedItems[i] = &common.SignedConfigurationItem{ConfigurationItem: itemBytes,
+			Signatures: []*common.ConfigurationSignature{{SignatureHeader: sigHeaderBytes, Signature: signature}}}
+	}
+
+	return protos_utils.MakeConfigurationEnvelope(signedItems...), nil
+}
+
+// makeConfigurationItem creates a configuration item bound to this chain
+func (c *Chain) makeConfigurationItem(itemType common.ConfigurationItem_ConfigurationType, key string, value []byte) *common.ConfigurationItem {
+	chainHeader := protos_utils.MakeChainHeader(common.HeaderType_CONFIGURATION_ITEM, 0, c.name, 0)
+	return protos_utils.MakeConfigurationItem(chainHeader, itemType, 0, defaultModificationPolicyID, key, value)
+}
+
+// createSignedEnvelope wraps data into a payload for the chain and signs it with the user's key
+func createSignedEnvelope(client *Client, user *User, chainID string, headerType common.HeaderType, data []byte) (*common.Envelope, error) {
+	creator, err := getSerializedIdentity(user)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := protos_utils.CreateNonce()
+	if err != nil {
+		return nil, err
+	}
+	payloadHeader := protos_utils.MakePayloadHeader(protos_utils.MakeChainHeader(headerType, 0, chainID, 0),
+		protos_utils.MakeSignatureHeader(creator, nonce))
+	paylBytes, err := protos_utils.GetBytesPayload(&common.Payload{Header: payloadHeader, Data: data})
+	if err != nil {
+		return nil, err
+	}
+	signature, err := signObject(client, user, paylBytes)
+	if err != nil {
+		return nil, err
+	}
+	return &common.Envelope{Payload: paylBytes, Signature: signature}, nil
+}
+
+// signObject hashes the object with the client's crypto suite and signs the digest with the user's key
+func signObject(client *Client, user *User, object []byte) ([]byte, error) {
+	if user == nil {
+		return nil, fmt.Errorf("user is nil")
+	}
+	return signObjectWithKey(client, user.GetPrivateKey(), object)
+}
+
+// signObjectWithKey hashes the object with the client's crypto suite and signs the digest with the key
+func signObjectWithKey(client *Client, key bccsp.Key, object []byte) ([]byte, error) {
+	cryptoSuite := client.GetCryptoSuite()
+	if cryptoSuite == nil {
+		return nil, fmt.Errorf("cryptoSuite is nil")
+	}
+	digest, err := cryptoSuite.Hash(object, &bccsp.SHAOpts{})
+	if err != nil {
+		return nil, err
+	}
+	return cryptoSuite.Sign(key, digest, nil)
+}
+
+// getSerializedIdentity returns the serialized identity of the user within the configured MSP
+func getSerializedIdentity(user *User) ([]byte, error) {
+	if user == nil {
+		return nil, fmt.Errorf("user is nil")
+	}
+	return serializeIdentity(user.GetMspID(), user.GetEnrollmentCertificate())
+}
+
+// serializeIdentity returns the serialized identity of a certificate within an MSP
+func serializeIdentity(mspID string, cert []byte) ([]byte, error) {
+	serializedIdentity := &msp.SerializedIdentity{Mspid: mspID, IdBytes: cert}
+	creatorID, err := proto.Marshal(serializedIdentity)
+	if err != nil {
+		return nil, fmt.Errorf("Could not Marshal serializedIdentity, err %s", err)
+	}
+	return creatorID, nil
+}
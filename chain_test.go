@@ -20,7 +20,25 @@ limitations under the License.
 package fabricsdk
 
 import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/bccsp"
+	bccspFactory "github.com/hyperledger/fabric/bccsp/factory"
+	"github.com/hyperledger/fabric/bccsp/sw"
+	msp "github.com/hyperledger/fabric/msp"
+	"github.com/hyperledger/fabric/protos/common"
+	mb "github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	protos_utils "github.com/hyperledger/fabric/protos/utils"
+	"golang.org/x/net/context"
 )
 
 func TestChainMethods(t *testing.T) {
@@ -50,3 +68,696 @@ func TestChainMethods(t *testing.T) {
 	}
 
 }
+
+func TestInitializeChain(t *testing.T) {
+	client := setupTestClient(t)
+	chain, err := client.NewChain("testChain-initialize")
+	if err != nil {
+		t.Fatalf("NewChain return error[%s]", err)
+	}
+
+	err = chain.InitializeChain()
+	if err == nil {
+		t.Fatalf("InitializeChain didn't return error")
+	}
+	if err.Error() != "orderers is nil" {
+		t.Fatalf("InitializeChain didn't return right error")
+	}
+
+	broadcastServer := &mockBroadcastServer{status: common.Status_SUCCESS}
+	addr, grpcServer := startMockBroadcastServer(t, broadcastServer)
+	defer grpcServer.Stop()
+	chain.AddOrderer(CreateNewOrderer(addr))
+	policy := &common.SignaturePolicyEnvelope{Policy: &common.SignaturePolicy{Type: &common.SignaturePolicy_SignedBy{SignedBy: 0}}}
+	for _, name := range []string{"AcceptAllPolicy", "WriterPolicy", "AdminPolicy"} {
+		if err := chain.SetPolicy(name, policy); err != nil {
+			t.Fatalf("SetPolicy return error[%s]", err)
+		}
+	}
+
+	if err := chain.InitializeChain(); err != nil {
+		t.Fatalf("InitializeChain return error[%s]", err)
+	}
+	envelopes := broadcastServer.getEnvelopes()
+	if len(envelopes) != 1 {
+		t.Fatalf("Expecting one envelope, got %d", len(envelopes))
+	}
+	payload, err := protos_utils.GetPayload(envelopes[0])
+	if err != nil {
+		t.Fatalf("GetPayload return error[%s]", err)
+	}
+	if payload.Header.ChainHeader.Type != int32(common.HeaderType_CONFIGURATION_TRANSACTION) {
+		t.Fatalf("Envelope is not a configuration transaction")
+	}
+	if payload.Header.ChainHeader.ChainID != "testChain-initialize" {
+		t.Fatalf("Envelope is for the wrong chain")
+	}
+	configEnvelope, err := protos_utils.UnmarshalConfigurationEnvelope(payload.Data)
+	if err != nil {
+		t.Fatalf("UnmarshalConfigurationEnvelope return error[%s]", err)
+	}
+	if len(configEnvelope.Items) != 4 {
+		t.Fatalf("Expecting 4 configuration items, got %d", len(configEnvelope.Items))
+	}
+	var policyNames []string
+	for _, signedItem := range configEnvelope.Items {
+		if len(signedItem.Signatures) != 1 {
+			t.Fatalf("Configuration item is not signed")
+		}
+		item, err := protos_utils.UnmarshalConfigurationItem(signedItem.ConfigurationItem)
+		if err != nil {
+			t.Fatalf("UnmarshalConfigurationItem return error[%s]", err)
+		}
+		if item.Type == common.ConfigurationItem_Chain {
+			ordererAddresses := &common.OrdererAddresses{}
+			if err := proto.Unmarshal(item.Value, ordererAddresses); err != nil {
+				t.Fatalf("Unmarshal OrdererAddresses return error[%s]", err)
+			}
+			if len(ordererAddresses.Addresses) != 1 || ordererAddresses.Addresses[0] != addr {
+				t.Fatalf("Wrong orderer addresses %v", ordererAddresses.Addresses)
+			}
+		}
+		if item.Type == common.ConfigurationItem_Policy {
+			policyNames = append(policyNames, item.Key)
+		}
+	}
+	if fmt.Sprint(policyNames) != "[AcceptAllPolicy AdminPolicy WriterPolicy]" {
+		t.Fatalf("Policies are not in name order: %v", policyNames)
+	}
+
+	broadcastServer.Lock()
+	broadcastServer.status = common.Status_BAD_REQUEST
+	broadcastServer.Unlock()
+	if err := chain.InitializeChain(); err == nil {
+		t.Fatalf("InitializeChain didn't return error on a rejected configuration transaction")
+	}
+}
+
+func TestBuildConfigurationEnvelopeIsStable(t *testing.T) {
+	client := setupTestClient(t)
+	chain, err := client.NewChain("testChain-envelope")
+	if err != nil {
+		t.Fatalf("NewChain return error[%s]", err)
+	}
+	for _, addr := range []string{"orderer3:7050", "orderer1:7050", "orderer2:7050", "orderer0:7050"} {
+		chain.AddOrderer(CreateNewOrderer(addr))
+	}
+	policy := &common.SignaturePolicyEnvelope{Policy: &common.SignaturePolicy{Type: &common.SignaturePolicy_SignedBy{SignedBy: 0}}}
+	for _, name := range []string{"WriterPolicy", "AcceptAllPolicy", "ReaderPolicy", "AdminPolicy"} {
+		if err := chain.SetPolicy(name, policy); err != nil {
+			t.Fatalf("SetPolicy return error[%s]", err)
+		}
+	}
+	user, err := client.GetUserContext("")
+	if err != nil {
+		t.Fatalf("GetUserContext return error[%s]", err)
+	}
+
+	// the nonces and signatures differ between builds, the configuration items don't
+	var previous [][]byte
+	for i := 0; i < 10; i++ {
+		configEnvelope, err := chain.buildConfigurationEnvelope(user)
+		if err != nil {
+			t.Fatalf("buildConfigurationEnvelope return error[%s]", err)
+		}
+		var items [][]byte
+		for _, signedItem := range configEnvelope.Items {
+			items = append(items, signedItem.ConfigurationItem)
+		}
+		if previous != nil && !reflect.DeepEqual(items, previous) {
+			t.Fatalf("Configuration items differ between two builds")
+		}
+		previous = items
+	}
+	item, err := protos_utils.UnmarshalConfigurationItem(previous[0])
+	if err != nil {
+		t.Fatalf("UnmarshalConfigurationItem return error[%s]", err)
+	}
+	ordererAddresses := &common.OrdererAddresses{}
+	if err := proto.Unmarshal(item.Value, ordererAddresses); err != nil {
+		t.Fatalf("Unmarshal OrdererAddresses return error[%s]", err)
+	}
+	if fmt.Sprint(ordererAddresses.Addresses) != "[orderer0:7050 orderer1:7050 orderer2:7050 orderer3:7050]" {
+		t.Fatalf("Orderer addresses are not sorted: %v", ordererAddresses.Addresses)
+	}
+}
+
+func TestJoinPeers(t *testing.T) {
+	client := setupTestClient(t)
+	chain, err := client.NewChain("testChain-join")
+	if err != nil {
+		t.Fatalf("NewChain return error[%s]", err)
+	}
+	genesisBlock := common.NewBlock(0, nil)
+
+	_, err = chain.JoinPeers(nil)
+	if err == nil || err.Error() != "genesisBlock is nil" {
+		t.Fatalf("JoinPeers didn't return right error")
+	}
+	_, err = chain.JoinPeers(genesisBlock)
+	if err == nil || err.Error() != "peers is nil" {
+		t.Fatalf("JoinPeers didn't return right error")
+	}
+
+	okServer := &mockEndorserServer{response: &pb.ProposalResponse{Response: &pb.Response{Status: 200}}}
+	okAddr, okGrpcServer := startMockEndorserServer(t, okServer)
+	defer okGrpcServer.Stop()
+	failServer := &mockEndorserServer{response: &pb.ProposalResponse{Response: &pb.Response{Status: 500, Message: "already joined"}}}
+	failAddr, failGrpcServer := startMockEndorserServer(t, failServer)
+	defer failGrpcServer.Stop()
+
+	responses, err := chain.JoinPeers(genesisBlock, CreateNewPeer(okAddr), CreateNewPeer(failAddr))
+	if err != nil {
+		t.Fatalf("JoinPeers return error[%s]", err)
+	}
+	if len(responses) != 2 {
+		t.Fatalf("Expecting 2 responses, got %d", len(responses))
+	}
+	if responses[okAddr].Err != nil {
+		t.Fatalf("JoinPeers returned error for successful peer: %s", responses[okAddr].Err)
+	}
+	if responses[failAddr].Err == nil {
+		t.Fatalf("JoinPeers didn't return error for failing peer")
+	}
+
+	proposals := okServer.getProposals()
+	if len(proposals) != 1 {
+		t.Fatalf("Expecting one proposal, got %d", len(proposals))
+	}
+	proposal, err := protos_utils.GetProposal(proposals[0].ProposalBytes)
+	if err != nil {
+		t.Fatalf("GetProposal return error[%s]", err)
+	}
+	cis, err := protos_utils.GetChaincodeInvocationSpec(proposal)
+	if err != nil {
+		t.Fatalf("GetChaincodeInvocationSpec return error[%s]", err)
+	}
+	if cis.ChaincodeSpec.ChaincodeID.Name != "cscc" {
+		t.Fatalf("Proposal was not sent to the configuration system chaincode")
+	}
+	args := cis.ChaincodeSpec.Input.Args
+	if len(args) != 2 || string(args[0]) != "JoinChain" {
+		t.Fatalf("Proposal doesn't invoke JoinChain")
+	}
+	block, err := protos_utils.GetBlockFromBlockBytes(args[1])
+	if err != nil || block.Header.Number != 0 {
+		t.Fatalf("Proposal doesn't carry the genesis block")
+	}
+}
+
+func TestQueryMethods(t *testing.T) {
+	client := setupTestClient(t)
+	chain, err := client.NewChain("testChain-query")
+	if err != nil {
+		t.Fatalf("NewChain return error[%s]", err)
+	}
+	_, err = chain.QueryInfo()
+	if err == nil || err.Error() != "peers is nil" {
+		t.Fatalf("QueryInfo didn't return right error")
+	}
+
+	endorserServer := &mockEndorserServer{}
+	addr, grpcServer := startMockEndorserServer(t, endorserServer)
+	defer grpcServer.Stop()
+	peer := CreateNewPeer(addr)
+	chain.AddPeer(peer)
+	if err := chain.SetPrimaryPeer(CreateNewPeer("localhost:1")); err == nil {
+		t.Fatalf("SetPrimaryPeer didn't return error for a peer outside of the chain")
+	}
+	if err := chain.SetPrimaryPeer(peer); err != nil {
+		t.Fatalf("SetPrimaryPeer return error[%s]", err)
+	}
+
+	bciBytes, _ := proto.Marshal(&pb.BlockchainInfo{Height: 3, CurrentBlockHash: []byte("hash")})
+	endorserServer.response = &pb.ProposalResponse{Response: &pb.Response{Status: 200, Payload: bciBytes}}
+	bci, err := chain.QueryInfo()
+	if err != nil {
+		t.Fatalf("QueryInfo return error[%s]", err)
+	}
+	if bci.Height != 3 || string(bci.CurrentBlockHash) != "hash" {
+		t.Fatalf("QueryInfo returned wrong info %v", bci)
+	}
+	checkQueryProposal(t, endorserServer, "GetChainInfo", "testChain-query")
+
+	blockBytes, _ := proto.Marshal(common.NewBlock(2, []byte("previous")))
+	endorserServer.response = &pb.ProposalResponse{Response: &pb.Response{Status: 200, Payload: blockBytes}}
+	block, err := chain.QueryBlock(2)
+	if err != nil {
+		t.Fatalf("QueryBlock return error[%s]", err)
+	}
+	if block.Header.Number != 2 {
+		t.Fatalf("QueryBlock returned wrong block %d", block.Header.Number)
+	}
+	checkQueryProposal(t, endorserServer, "GetBlockByNumber", "testChain-query", "2")
+	if _, err := chain.QueryBlock(-1); err == nil {
+		t.Fatalf("QueryBlock didn't return error for a negative block number")
+	}
+
+	envelopeBytes, _ := proto.Marshal(&common.Envelope{Payload: []byte("payload")})
+	endorserServer.response = &pb.ProposalResponse{Response: &pb.Response{Status: 200, Payload: envelopeBytes}}
+	envelope, err := chain.QueryTransaction("txid")
+	if err != nil {
+		t.Fatalf("QueryTransaction return error[%s]", err)
+	}
+	if string(envelope.Payload) != "payload" {
+		t.Fatalf("QueryTransaction returned wrong envelope")
+	}
+	checkQueryProposal(t, endorserServer, "GetTransactionByID", "testChain-query", "txid")
+
+	endorserServer.response = &pb.ProposalResponse{Response: &pb.Response{Status: 404, Message: "not found"}}
+	if _, err := chain.QueryTransaction("unknown"); err == nil {
+		t.Fatalf("QueryTransaction didn't return error")
+	}
+}
+
+func TestChaincodeDeployment(t *testing.T) {
+	client := setupTestClient(t)
+	chain, err := client.NewChain("testChain-deploy")
+	if err != nil {
+		t.Fatalf("NewChain return error[%s]", err)
+	}
+	_, err = chain.InstallChaincode("mycc", "github.com/mycc", []byte("code"), nil)
+	if err == nil || err.Error() != "peers is nil" {
+		t.Fatalf("InstallChaincode didn't return right error")
+	}
+	_, err = chain.InstallChaincode("mycc", "github.com/mycc", nil, nil)
+	if err == nil || err.Error() != "chaincodePackage is empty" {
+		t.Fatalf("InstallChaincode didn't return right error")
+	}
+
+	response, mspConfig := signedProposalResponse(t, client.GetCryptoSuite(), "Org1MSP", []byte("payload"))
+	chain.SetMSPs([]*mb.MSPConfig{mspConfig})
+	endorserServer := &mockEndorserServer{response: response}
+	endorserAddr, endorserGrpcServer := startMockEndorserServer(t, endorserServer)
+	defer endorserGrpcServer.Stop()
+	broadcastServer := &mockBroadcastServer{status: common.Status_SUCCESS}
+	ordererAddr, ordererGrpcServer := startMockBroadcastServer(t, broadcastServer)
+	defer ordererGrpcServer.Stop()
+	chain.AddPeer(CreateNewPeer(endorserAddr))
+	chain.AddOrderer(CreateNewOrderer(ordererAddr))
+
+	responses, err := chain.InstallChaincode("mycc", "github.com/mycc", []byte("code"), nil)
+	if err != nil {
+		t.Fatalf("InstallChaincode return error[%s]", err)
+	}
+	if responses[endorserAddr] == nil || responses[endorserAddr].Err != nil {
+		t.Fatalf("InstallChaincode didn't return a successful response")
+	}
+	cis := lastChaincodeInvocationSpec(t, endorserServer)
+	if cis.ChaincodeSpec.ChaincodeID.Name != "lccc" || string(cis.ChaincodeSpec.Input.Args[0]) != "install" {
+		t.Fatalf("Install proposal was not sent to the lifecycle system chaincode")
+	}
+	cds, err := protos_utils.GetChaincodeDeploymentSpec(cis.ChaincodeSpec.Input.Args[1])
+	if err != nil {
+		t.Fatalf("GetChaincodeDeploymentSpec return error[%s]", err)
+	}
+	if string(cds.CodePackage) != "code" || cds.ChaincodeSpec.ChaincodeID.Name != "mycc" {
+		t.Fatalf("Install proposal carries the wrong deployment spec")
+	}
+
+	for _, upgrade := range []bool{false, true} {
+		var txid string
+		var transactionResponses map[string]*TransactionResponse
+		if upgrade {
+			txid, transactionResponses, err = chain.UpgradeChaincode("mycc", "github.com/mycc", []string{"init", "a", "100"})
+		} else {
+			txid, transactionResponses, err = chain.InstantiateChaincode("mycc", "github.com/mycc", []string{"init", "a", "100"})
+		}
+		if err != nil {
+			t.Fatalf("Deployment return error[%s]", err)
+		}
+		if txid == "" {
+			t.Fatalf("Deployment didn't return the transaction ID")
+		}
+		if transactionResponses[ordererAddr] == nil || transactionResponses[ordererAddr].Err != nil {
+			t.Fatalf("Deployment transaction was not sent to the orderer")
+		}
+		cis = lastChaincodeInvocationSpec(t, endorserServer)
+		expectedFunction := "deploy"
+		if upgrade {
+			expectedFunction = "upgrade"
+		}
+		if cis.ChaincodeSpec.ChaincodeID.Name != "lccc" || string(cis.ChaincodeSpec.Input.Args[0]) != expectedFunction {
+			t.Fatalf("Deployment proposal doesn't invoke lccc %s", expectedFunction)
+		}
+		if string(cis.ChaincodeSpec.Input.Args[1]) != "testChain-deploy" {
+			t.Fatalf("Deployment proposal is for the wrong chain")
+		}
+	}
+	if len(broadcastServer.getEnvelopes()) != 2 {
+		t.Fatalf("Expecting 2 transactions sent to the orderer")
+	}
+}
+
+func TestSendTransactionProposalVerification(t *testing.T) {
+	client := setupTestClient(t)
+	chain, err := client.NewChain("testChain-verify")
+	if err != nil {
+		t.Fatalf("NewChain return error[%s]", err)
+	}
+	signedProposal, _, err := chain.CreateTransactionProposal("mycc", "testChain-verify", []string{"invoke"}, true, "1234", nil)
+	if err != nil {
+		t.Fatalf("CreateTransactionProposal return error[%s]", err)
+	}
+
+	valid, mspConfig := signedProposalResponse(t, client.GetCryptoSuite(), "Org1MSP", []byte("payload"))
+	untrusted, _ := signedProposalResponse(t, client.GetCryptoSuite(), "Org1MSP", []byte("payload"))
+	tampered, _ := signedProposalResponse(t, client.GetCryptoSuite(), "Org1MSP", []byte("payload"))
+	tampered.Payload = []byte("tampered")
+	servers := map[string]*pb.ProposalResponse{"valid": valid, "untrusted": untrusted, "tampered": tampered}
+	addrs := make(map[string]string)
+	for name, response := range servers {
+		addr, grpcServer := startMockEndorserServer(t, &mockEndorserServer{response: response})
+		defer grpcServer.Stop()
+		addrs[name] = addr
+		chain.AddPeer(CreateNewPeer(addr))
+	}
+
+	// without channel MSPs only the signatures are verified
+	expected := "Invalid proposal response from endorser " + addrs["tampered"] + ": Endorsement signature is invalid"
+	responses, err := chain.SendTransactionProposal(signedProposal, 0)
+	if err != nil {
+		t.Fatalf("SendTransactionProposal return error[%s]", err)
+	}
+	if responses[addrs["valid"]].Err != nil || responses[addrs["untrusted"]].Err != nil {
+		t.Fatalf("SendTransactionProposal rejected a correctly signed response")
+	}
+	if err := responses[addrs["tampered"]].Err; err == nil || err.Error() != expected {
+		t.Fatalf("SendTransactionProposal didn't reject a tampered response, got %v", err)
+	}
+
+	chain.SetMSPs([]*mb.MSPConfig{mspConfig})
+	responses, err = chain.SendTransactionProposal(signedProposal, 0)
+	if err != nil {
+		t.Fatalf("SendTransactionProposal return error[%s]", err)
+	}
+	if responses[addrs["valid"]].Err != nil {
+		t.Fatalf("SendTransactionProposal rejected a valid response: %s", responses[addrs["valid"]].Err)
+	}
+	err = responses[addrs["untrusted"]].Err
+	if err == nil || !strings.Contains(err.Error(), "Endorser identity is not valid") {
+		t.Fatalf("SendTransactionProposal didn't reject an endorser from an untrusted CA, got %v", err)
+	}
+
+	// with endorser validation disabled the signatures are still verified
+	chain.SetEndorserValidation(false)
+	responses, err = chain.SendTransactionProposal(signedProposal, 0)
+	if err != nil {
+		t.Fatalf("SendTransactionProposal return error[%s]", err)
+	}
+	if responses[addrs["valid"]].Err != nil || responses[addrs["untrusted"]].Err != nil {
+		t.Fatalf("SendTransactionProposal rejected a correctly signed response")
+	}
+	if err := responses[addrs["tampered"]].Err; err == nil || err.Error() != expected {
+		t.Fatalf("SendTransactionProposal didn't reject a tampered response, got %v", err)
+	}
+}
+
+func TestGetEventSource(t *testing.T) {
+	client := setupTestClient(t)
+	chain, err := client.NewChain("testChain-events")
+	if err != nil {
+		t.Fatalf("NewChain return error[%s]", err)
+	}
+	noEventSource := CreateNewPeer("localhost:7051")
+	chain.AddPeer(noEventSource)
+	if _, err := chain.GetEventSource(); err == nil || err.Error() != "No peer of chain testChain-events has an event source" {
+		t.Fatalf("GetEventSource didn't return right error: %v", err)
+	}
+
+	addr, grpcServer := startMockEventServer(t)
+	defer grpcServer.Stop()
+	// the primary peer is tried first, its event source is down
+	down := CreateNewPeer("localhost:7052")
+	down.SetEventSourceURL("127.0.0.1:1")
+	up := CreateNewPeer("localhost:7053")
+	up.SetEventSourceURL(addr)
+	chain.AddPeer(down)
+	chain.AddPeer(up)
+	if err := chain.SetPrimaryPeer(down); err != nil {
+		t.Fatalf("SetPrimaryPeer return error[%s]", err)
+	}
+	eventSource, err := chain.GetEventSource()
+	if err != nil {
+		t.Fatalf("GetEventSource return error[%s]", err)
+	}
+	defer eventSource.DisconnectEventSource()
+	if eventSource != up || !up.IsEventSourceConnected() {
+		t.Fatalf("GetEventSource returned %s, expected the connected peer %s", eventSource.GetURL(), up.GetURL())
+	}
+	if again, err := chain.GetEventSource(); err != nil || again != up {
+		t.Fatalf("GetEventSource did not keep the connected event source")
+	}
+}
+
+// lastChaincodeInvocationSpec returns the invocation spec of the last proposal received by the endorser
+func lastChaincodeInvocationSpec(t *testing.T, endorserServer *mockEndorserServer) *pb.ChaincodeInvocationSpec {
+	proposals := endorserServer.getProposals()
+	proposal, err := protos_utils.GetProposal(proposals[len(proposals)-1].ProposalBytes)
+	if err != nil {
+		t.Fatalf("GetProposal return error[%s]", err)
+	}
+	cis, err := protos_utils.GetChaincodeInvocationSpec(proposal)
+	if err != nil {
+		t.Fatalf("GetChaincodeInvocationSpec return error[%s]", err)
+	}
+	return cis
+}
+
+// checkQueryProposal verifies that the last proposal received by the endorser
+// invokes the ledger query system chaincode with the expected arguments
+func checkQueryProposal(t *testing.T, endorserServer *mockEndorserServer, expectedArgs ...string) {
+	cis := lastChaincodeInvocationSpec(t, endorserServer)
+	if cis.ChaincodeSpec.ChaincodeID.Name != "qscc" {
+		t.Fatalf("Proposal was not sent to the ledger query system chaincode")
+	}
+	args := cis.ChaincodeSpec.Input.Args
+	if len(args) != len(expectedArgs) {
+		t.Fatalf("Expecting %d proposal args, got %d", len(expectedArgs), len(args))
+	}
+	for i, arg := range expectedArgs {
+		if string(args[i]) != arg {
+			t.Fatalf("Expecting proposal arg %s, got %s", arg, string(args[i]))
+		}
+	}
+}
+
+// setupTestClient returns a client using an ephemeral crypto suite, with
+// a user context holding a freshly generated signing key
+func setupTestClient(t *testing.T) *Client {
+	client := NewClient()
+	ks := &sw.FileBasedKeyStore{}
+	if err := ks.Init(nil, "/tmp/keystoretest", false); err != nil {
+		t.Fatalf("Failed initializing key store [%s]", err)
+	}
+	cryptoSuite, err := bccspFactory.GetBCCSP(&bccspFactory.SwOpts{Ephemeral_: true, SecLevel: 256,
+		HashFamily: "SHA2", KeyStore: ks})
+	if err != nil {
+		t.Fatalf("Failed getting ephemeral software-based BCCSP [%s]", err)
+	}
+	client.SetCryptoSuite(cryptoSuite)
+	key, err := cryptoSuite.KeyGen(&bccsp.ECDSAKeyGenOpts{Temporary: true})
+	if err != nil {
+		t.Fatalf("KeyGen return error[%s]", err)
+	}
+	user := NewUser("testUser")
+	user.SetPrivateKey(key)
+	user.SetEnrollmentCertificate([]byte("testCert"))
+	if err := client.SetUserContext(user, true); err != nil {
+		t.Fatalf("SetUserContext return error[%s]", err)
+	}
+	return client
+}
+
+func TestLedgerBlockReplay(t *testing.T) {
+	client := setupTestClient(t)
+	chain, err := client.NewChain("testChain-replay")
+	if err != nil {
+		t.Fatalf("NewChain return error[%s]", err)
+	}
+	blocks, errs := chain.NewLedgerBlockReplay()(context.Background(), 0)
+	for range blocks {
+		t.Fatalf("Replay returned a block without peers")
+	}
+	if err := <-errs; err == nil || err.Error() != "peers is nil" {
+		t.Fatalf("Replay didn't return right error: %v", err)
+	}
+}
+
+func TestCreateTransactionProposalWithTcerts(t *testing.T) {
+	client := setupTestClient(t)
+	chain, err := client.NewChain("testChain-tcerts")
+	if err != nil {
+		t.Fatalf("NewChain return error[%s]", err)
+	}
+	broadcastServer := &mockBroadcastServer{status: common.Status_SUCCESS}
+	ordererAddr, ordererGrpcServer := startMockBroadcastServer(t, broadcastServer)
+	defer ordererGrpcServer.Stop()
+	chain.AddOrderer(CreateNewOrderer(ordererAddr))
+	user, err := client.GetUserContext("")
+	if err != nil {
+		t.Fatalf("GetUserContext return error[%s]", err)
+	}
+	ca := startMockCAServer(t)
+	defer ca.server.Close()
+	ca.enroll(t, client.GetCryptoSuite(), user)
+	user.SetMSPServices(ca.newMSPServices(t, client.GetCryptoSuite()))
+	chain.SetTCertBatchSize(20)
+
+	// without security the proposal is created by the enrollment certificate
+	signedProposal, _, err := chain.CreateTransactionProposal("mycc", chain.GetName(), []string{"invoke"}, true, "txid-0", nil)
+	if err != nil {
+		t.Fatalf("CreateTransactionProposal return error[%s]", err)
+	}
+	if creator := verifyCreatorSignature(t, client, signedProposal.ProposalBytes, signedProposal.Signature); !bytes.Equal(creator, user.GetEnrollmentCertificate()) {
+		t.Fatalf("CreateTransactionProposal didn't use the enrollment certificate")
+	}
+
+	chain.securityEnabled = true
+	creators := make(map[string]bool)
+	for i := 1; i <= 3; i++ {
+		signedProposal, proposal, err := chain.CreateTransactionProposal("mycc", chain.GetName(), []string{"invoke"}, true, fmt.Sprintf("txid-%d", i), nil)
+		if err != nil {
+			t.Fatalf("CreateTransactionProposal return error[%s]", err)
+		}
+		creator := verifyCreatorSignature(t, client, signedProposal.ProposalBytes, signedProposal.Signature)
+		if bytes.Equal(creator, user.GetEnrollmentCertificate()) || creators[string(creator)] {
+			t.Fatalf("CreateTransactionProposal didn't use a new TCert")
+		}
+		creators[string(creator)] = true
+
+		// the transaction is signed by the TCert of its proposal
+		if _, err := chain.SendTransaction(proposal, &pb.Transaction{}); err != nil {
+			t.Fatalf("SendTransaction return error[%s]", err)
+		}
+		envelopes := broadcastServer.getEnvelopes()
+		envelope := envelopes[len(envelopes)-1]
+		if !bytes.Equal(verifyCreatorSignature(t, client, envelope.Payload, envelope.Signature), creator) {
+			t.Fatalf("SendTransaction didn't sign with the TCert of the proposal")
+		}
+	}
+	if ca.getBatches() != 1 {
+		t.Fatalf("%d TCert batches were fetched, expected 1", ca.getBatches())
+	}
+}
+
+// verifyCreatorSignature verifies the signature of a proposal or a payload by the certificate
+// of its creator, and returns the certificate
+func verifyCreatorSignature(t *testing.T, client *Client, message []byte, signature []byte) []byte {
+	var signatureHeader *common.SignatureHeader
+	proposal := &pb.Proposal{}
+	payload := &common.Payload{}
+	if err := proto.Unmarshal(message, payload); err == nil && payload.Header != nil && payload.Header.SignatureHeader != nil {
+		signatureHeader = payload.Header.SignatureHeader
+	} else if err := proto.Unmarshal(message, proposal); err == nil {
+		header, err := protos_utils.GetHeader(proposal.Header)
+		if err != nil {
+			t.Fatalf("GetHeader return error[%s]", err)
+		}
+		signatureHeader = header.SignatureHeader
+	}
+	if signatureHeader == nil {
+		t.Fatalf("The message has no signature header")
+	}
+	creator := &msp.SerializedIdentity{}
+	if err := proto.Unmarshal(signatureHeader.Creator, creator); err != nil {
+		t.Fatalf("Unmarshal return error[%s]", err)
+	}
+	certPem, _ := pem.Decode(creator.IdBytes)
+	if certPem == nil {
+		t.Fatalf("The creator is not a PEM certificate")
+	}
+	cert, err := x509.ParseCertificate(certPem.Bytes)
+	if err != nil {
+		t.Fatalf("x509 ParseCertificate return error[%s]", err)
+	}
+	cryptoSuite := client.GetCryptoSuite()
+	publicKey, err := cryptoSuite.KeyImport(cert, &bccsp.X509PublicKeyImportOpts{Temporary: true})
+	if err != nil {
+		t.Fatalf("KeyImport return error[%s]", err)
+	}
+	digest, err := cryptoSuite.Hash(message, &bccsp.SHAOpts{})
+	if err != nil {
+		t.Fatalf("Hash return error[%s]", err)
+	}
+	valid, err := cryptoSuite.Verify(publicKey, signature, digest, nil)
+	if err != nil || !valid {
+		t.Fatalf("The signature isn't verified by the creator certificate")
+	}
+	return creator.IdBytes
+}
+
+func TestProposalsOfConcurrentUsers(t *testing.T) {
+	client := setupTestClient(t)
+	chain, err := client.NewChain("testChain-users")
+	if err != nil {
+		t.Fatalf("NewChain return error[%s]", err)
+	}
+	broadcastServer := &mockBroadcastServer{status: common.Status_SUCCESS}
+	ordererAddr, ordererGrpcServer := startMockBroadcastServer(t, broadcastServer)
+	defer ordererGrpcServer.Stop()
+	chain.AddOrderer(CreateNewOrderer(ordererAddr))
+	ca := startMockCAServer(t)
+	defer ca.server.Close()
+	users := make([]*User, 4)
+	for i := range users {
+		users[i] = NewUser(fmt.Sprintf("user%d", i))
+		users[i].SetMspID(fmt.Sprintf("Org%dMSP", i%2))
+		ca.enroll(t, client.GetCryptoSuite(), users[i])
+		if err := client.AddUserContext(users[i], true); err != nil {
+			t.Fatalf("AddUserContext return error[%s]", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(users)*5)
+	for _, user := range users {
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func(user *User, i int) {
+				defer wg.Done()
+				txid := fmt.Sprintf("%s-%d", user.GetName(), i)
+				signedProposal, proposal, err := chain.CreateTransactionProposalForUser(user, "mycc", chain.GetName(), []string{"invoke"}, true, txid, nil)
+				if err != nil {
+					errs <- fmt.Errorf("CreateTransactionProposalForUser return error[%s]", err)
+					return
+				}
+				if creator := verifyCreatorSignature(t, client, signedProposal.ProposalBytes, signedProposal.Signature); !bytes.Equal(creator, user.GetEnrollmentCertificate()) {
+					errs <- fmt.Errorf("The proposal %s wasn't created by %s", txid, user.GetName())
+					return
+				}
+				// the client signs the transaction with the key of the proposal's creator
+				if _, err := chain.SendTransaction(proposal, &pb.Transaction{}); err != nil {
+					errs <- fmt.Errorf("SendTransaction return error[%s]", err)
+				}
+			}(user, i)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	envelopes := broadcastServer.getEnvelopes()
+	if len(envelopes) != len(users)*5 {
+		t.Fatalf("The orderer received %d transactions, expected %d", len(envelopes), len(users)*5)
+	}
+	for _, envelope := range envelopes {
+		verifyCreatorSignature(t, client, envelope.Payload, envelope.Signature)
+	}
+
+	// a proposal of a user unknown to the client can only be sent on its behalf
+	stranger := NewUser("stranger")
+	ca.enroll(t, client.GetCryptoSuite(), stranger)
+	_, proposal, err := chain.CreateTransactionProposalForUser(stranger, "mycc", chain.GetName(), []string{"invoke"}, true, "stranger-0", nil)
+	if err != nil {
+		t.Fatalf("CreateTransactionProposalForUser return error[%s]", err)
+	}
+	if _, err := chain.SendTransaction(proposal, &pb.Transaction{}); err == nil {
+		t.Fatalf("SendTransaction didn't return error")
+	}
+	if _, err := chain.SendTransactionForUser(stranger, proposal, &pb.Transaction{}); err != nil {
+		t.Fatalf("SendTransactionForUser return error[%s]", err)
+	}
+}
@@ -0,0 +1,455 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packager
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/op/go-logging"
+)
+
+var logger = logging.MustGetLogger("fabric_sdk_go")
+
+// file is a source file of the chaincode package
+type file struct {
+	// location of the file in the code package
+	name string
+	// location of the file on disk
+	path string
+}
+
+// resolver locates the source directories of Go packages
+type resolver struct {
+	goRoot  string
+	goPaths []string
+	// directory and path of the Go module the chaincode belongs to, if any
+	moduleDir  string
+	modulePath string
+	// directories of the modules required by the chaincode module, by module path
+	moduleDirs map[string]string
+	modCache   string
+}
+
+// goModFile holds the directives of a go.mod file the packager needs
+type goModFile struct {
+	modulePath string
+	// required module versions, by module path
+	requires map[string]string
+	// replacements of required modules, by module path
+	replaces map[string]moduleVersion
+}
+
+// moduleVersion is a module path and version, or a local directory when version is empty
+type moduleVersion struct {
+	path    string
+	version string
+}
+
+// PackageCC ...
+/**
+ * Creates the code package of a Go chaincode: a gzipped tar holding the .go files
+ * of the chaincode and of all its non standard library dependencies, laid out as
+ * "src/<import path>/<file>" the way the peer expects to build it.
+ * The package is deterministic: packaging the same sources twice gives the same bytes.
+ * @param {string} chaincodePath The import path of the chaincode under GOPATH, or the
+ * directory of the chaincode inside a Go module. Inside a module, the dependencies come from
+ * the vendor directory, the module itself and the modules required by its go.mod, read from
+ * their local replacement or from the module cache (GOMODCACHE, by default GOPATH/pkg/mod).
+ * @returns {[]byte} The CodePackage of the chaincode deployment spec.
+ */
+func PackageCC(chaincodePath string) ([]byte, error) {
+	if chaincodePath == "" {
+		return nil, fmt.Errorf("chaincodePath is empty")
+	}
+	goPath := os.Getenv("GOPATH")
+	if goPath == "" {
+		goPath = build.Default.GOPATH
+	}
+	r := &resolver{goRoot: build.Default.GOROOT, goPaths: filepath.SplitList(goPath)}
+	r.modCache = os.Getenv("GOMODCACHE")
+	if r.modCache == "" && len(r.goPaths) > 0 {
+		r.modCache = filepath.Join(r.goPaths[0], "pkg", "mod")
+	}
+
+	dir, importPath, err := r.resolveChaincode(chaincodePath)
+	if err != nil {
+		return nil, err
+	}
+	logger.Debugf("Packaging chaincode %s from %s\n", importPath, dir)
+
+	files, err := r.collectFiles(dir, importPath)
+	if err != nil {
+		return nil, err
+	}
+	return writeCodePackage(files)
+}
+
+// ListPackageContents ...
+/**
+ * Lists the files of a chaincode code package, in the order they are stored.
+ * @param {[]byte} codePackage The code package, as produced by PackageCC.
+ * @returns {[]string} The names of the files in the package.
+ */
+func ListPackageContents(codePackage []byte) ([]string, error) {
+	gr, err := gzip.NewReader(bytes.NewReader(codePackage))
+	if err != nil {
+		return nil, fmt.Errorf("Could not read gzip stream: %v", err)
+	}
+	defer gr.Close()
+
+	var names []string
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("Could not read tar stream: %v", err)
+		}
+		names = append(names, header.Name)
+	}
+	return names, nil
+}
+
+// resolveChaincode returns the directory and the import path of the chaincode
+func (r *resolver) resolveChaincode(chaincodePath string) (string, string, error) {
+	if info, err := os.Stat(chaincodePath); err == nil && info.IsDir() {
+		dir, err := filepath.Abs(chaincodePath)
+		if err != nil {
+			return "", "", err
+		}
+		if moduleDir, goMod, ok := findModule(dir); ok {
+			modulePath := goMod.modulePath
+			r.moduleDir, r.modulePath = moduleDir, modulePath
+			r.moduleDirs = r.requiredModuleDirs(moduleDir, goMod)
+			rel, err := filepath.Rel(moduleDir, dir)
+			if err != nil {
+				return "", "", err
+			}
+			return dir, path.Join(modulePath, filepath.ToSlash(rel)), nil
+		}
+		for _, goPath := range r.goPaths {
+			src := filepath.Join(goPath, "src")
+			if rel, err := filepath.Rel(src, dir); err == nil && !strings.HasPrefix(rel, "..") {
+				return dir, filepath.ToSlash(rel), nil
+			}
+		}
+		return "", "", fmt.Errorf("chaincode directory %s is neither in a Go module nor under GOPATH", chaincodePath)
+	}
+
+	for _, goPath := range r.goPaths {
+		dir := filepath.Join(goPath, "src", filepath.FromSlash(chaincodePath))
+		if isDir(dir) {
+			return dir, chaincodePath, nil
+		}
+	}
+	return "", "", fmt.Errorf("could not find chaincode %s under GOPATH %s", chaincodePath, strings.Join(r.goPaths, string(filepath.ListSeparator)))
+}
+
+// collectFiles walks the imports of the chaincode package and returns the Go files of the
+// chaincode and its dependencies, sorted by name
+func (r *resolver) collectFiles(dir string, importPath string) ([]*file, error) {
+	var files []*file
+	visited := map[string]bool{dir: true}
+	type pkgDir struct{ dir, importPath string }
+	queue := []pkgDir{{dir, importPath}}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		pkg, err := build.ImportDir(current.dir, 0)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read package %s: %v", current.importPath, err)
+		}
+		for _, f := range append(pkg.GoFiles, pkg.CgoFiles...) {
+			files = append(files, &file{name: path.Join("src", current.importPath, f), path: filepath.Join(current.dir, f)})
+		}
+		for _, imp := range pkg.Imports {
+			if r.isStandard(imp) {
+				continue
+			}
+			depDir, depImportPath, err := r.resolveImport(imp, current.dir)
+			if err != nil {
+				return nil, fmt.Errorf("Could not find dependency %s of %s: %v", imp, current.importPath, err)
+			}
+			if !visited[depDir] {
+				visited[depDir] = true
+				queue = append(queue, pkgDir{depDir, depImportPath})
+			}
+		}
+	}
+
+	sort.Sort(byName(files))
+	return files, nil
+}
+
+// isStandard returns true if the import path denotes a package of the standard library
+func (r *resolver) isStandard(importPath string) bool {
+	if importPath == "C" {
+		return true
+	}
+	return isDir(filepath.Join(r.goRoot, "src", filepath.FromSlash(importPath)))
+}
+
+// resolveImport returns the directory of an imported package and the location it is stored
+// at in the code package. Vendor directories are searched first, from the importing package up.
+func (r *resolver) resolveImport(importPath string, fromDir string) (string, string, error) {
+	root, rootImportPath := r.rootOf(fromDir)
+	if root != "" {
+		for d := fromDir; strings.HasPrefix(d, root); d = filepath.Dir(d) {
+			vendorDir := filepath.Join(d, "vendor", filepath.FromSlash(importPath))
+			if isDir(vendorDir) {
+				rel, err := filepath.Rel(root, vendorDir)
+				if err != nil {
+					return "", "", err
+				}
+				return vendorDir, path.Join(rootImportPath, filepath.ToSlash(rel)), nil
+			}
+			if d == root {
+				break
+			}
+		}
+	}
+
+	if r.modulePath != "" {
+		// in module mode, dependencies come from the module itself or the modules it requires, never from GOPATH
+		if isInModule(importPath, r.modulePath) {
+			dir := filepath.Join(r.moduleDir, filepath.FromSlash(strings.TrimPrefix(importPath, r.modulePath)))
+			if isDir(dir) {
+				return dir, importPath, nil
+			}
+			return "", "", fmt.Errorf("package not found")
+		}
+		modulePath := ""
+		for required := range r.moduleDirs {
+			if isInModule(importPath, required) && len(required) > len(modulePath) {
+				modulePath = required
+			}
+		}
+		if modulePath == "" {
+			return "", "", fmt.Errorf("package is neither vendored nor provided by a module required in %s", filepath.Join(r.moduleDir, "go.mod"))
+		}
+		dir := filepath.Join(r.moduleDirs[modulePath], filepath.FromSlash(strings.TrimPrefix(importPath, modulePath)))
+		if isDir(dir) {
+			return dir, importPath, nil
+		}
+		return "", "", fmt.Errorf("package not found in module %s at %s, the module may need to be downloaded with go mod download", modulePath, r.moduleDirs[modulePath])
+	}
+
+	for _, goPath := range r.goPaths {
+		dir := filepath.Join(goPath, "src", filepath.FromSlash(importPath))
+		if isDir(dir) {
+			return dir, importPath, nil
+		}
+	}
+	return "", "", fmt.Errorf("package not found")
+}
+
+// rootOf returns the source root containing dir (the module directory or a GOPATH src directory)
+// and the import path of that root
+func (r *resolver) rootOf(dir string) (string, string) {
+	if r.moduleDir != "" && (dir == r.moduleDir || strings.HasPrefix(dir, r.moduleDir+string(filepath.Separator))) {
+		return r.moduleDir, r.modulePath
+	}
+	for _, goPath := range r.goPaths {
+		src := filepath.Join(goPath, "src")
+		if strings.HasPrefix(dir, src+string(filepath.Separator)) {
+			return src, ""
+		}
+	}
+	return "", ""
+}
+
+// requiredModuleDirs returns the directories of the modules required by a go.mod file: the
+// replacement directory of locally replaced modules, else the module cache directory of the version
+func (r *resolver) requiredModuleDirs(moduleDir string, goMod *goModFile) map[string]string {
+	dirs := make(map[string]string)
+	for modulePath, version := range goMod.requires {
+		target := moduleVersion{path: modulePath, version: version}
+		if replace, ok := goMod.replaces[modulePath]; ok {
+			target = replace
+		}
+		if target.version == "" {
+			dir := filepath.FromSlash(target.path)
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(moduleDir, dir)
+			}
+			dirs[modulePath] = dir
+			continue
+		}
+		dirs[modulePath] = filepath.Join(r.modCache, filepath.FromSlash(escapeModulePath(target.path)+"@"+escapeModulePath(target.version)))
+	}
+	return dirs
+}
+
+// findModule looks for a go.mod file in dir and its parents and returns the module directory and file
+func findModule(dir string) (string, *goModFile, bool) {
+	for d := dir; ; d = filepath.Dir(d) {
+		if goMod, ok := readGoMod(filepath.Join(d, "go.mod")); ok {
+			return d, goMod, true
+		}
+		if filepath.Dir(d) == d {
+			return "", nil, false
+		}
+	}
+}
+
+// readGoMod reads the module path and the require and replace directives of a go.mod file
+func readGoMod(goMod string) (*goModFile, bool) {
+	f, err := os.Open(goMod)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+	modFile := &goModFile{requires: make(map[string]string), replaces: make(map[string]moduleVersion)}
+	block := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if block != "" {
+			if fields[0] == ")" {
+				block = ""
+			} else {
+				modFile.addDirective(block, fields)
+			}
+			continue
+		}
+		if len(fields) == 2 && fields[1] == "(" {
+			block = fields[0]
+			continue
+		}
+		modFile.addDirective(fields[0], fields[1:])
+	}
+	if modFile.modulePath == "" {
+		return nil, false
+	}
+	return modFile, true
+}
+
+// addDirective records a module, require or replace directive of a go.mod file
+func (m *goModFile) addDirective(verb string, args []string) {
+	for i := range args {
+		args[i] = strings.Trim(args[i], `"`)
+	}
+	switch verb {
+	case "module":
+		if len(args) == 1 {
+			m.modulePath = args[0]
+		}
+	case "require":
+		if len(args) == 2 {
+			m.requires[args[0]] = args[1]
+		}
+	case "replace":
+		// replace old [version] => new [version]
+		for i, arg := range args {
+			if arg != "=>" || i == 0 || i+1 >= len(args) {
+				continue
+			}
+			replace := moduleVersion{path: args[i+1]}
+			if i+2 < len(args) {
+				replace.version = args[i+2]
+			}
+			m.replaces[args[0]] = replace
+		}
+	}
+}
+
+// escapeModulePath escapes a module path or version the way the module cache stores it:
+// upper case letters are replaced by an exclamation mark followed by the lower case letter
+func escapeModulePath(modulePath string) string {
+	var buf bytes.Buffer
+	for _, c := range modulePath {
+		if c >= 'A' && c <= 'Z' {
+			buf.WriteByte('!')
+			buf.WriteRune(c + 'a' - 'A')
+		} else {
+			buf.WriteRune(c)
+		}
+	}
+	return buf.String()
+}
+
+// isInModule returns true if the import path denotes a package of the module
+func isInModule(importPath string, modulePath string) bool {
+	return importPath == modulePath || strings.HasPrefix(importPath, modulePath+"/")
+}
+
+// writeCodePackage writes the files into a gzipped tar. Timestamps and ownership are
+// fixed so that the output only depends on the file names and contents.
+func writeCodePackage(files []*file) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	for _, f := range files {
+		content, err := ioutil.ReadFile(f.path)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read %s: %v", f.path, err)
+		}
+		header := &tar.Header{Name: f.name, Mode: 0100644, Size: int64(len(content)), ModTime: time.Unix(0, 0), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, fmt.Errorf("Could not write tar header for %s: %v", f.name, err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			return nil, fmt.Errorf("Could not write %s: %v", f.name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func isDir(dir string) bool {
+	info, err := os.Stat(dir)
+	return err == nil && info.IsDir()
+}
+
+// byName sorts files by their location in the code package
+type byName []*file
+
+func (f byName) Len() int           { return len(f) }
+func (f byName) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+func (f byName) Less(i, j int) bool { return f[i].name < f[j].name }
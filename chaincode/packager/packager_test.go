@@ -0,0 +1,205 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packager
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, name string, content string) {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatalf("MkdirAll return error[%s]", err)
+	}
+	if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile return error[%s]", err)
+	}
+}
+
+func setupTestGoPath(t *testing.T) string {
+	goPath, err := ioutil.TempDir("", "packagertest")
+	if err != nil {
+		t.Fatalf("TempDir return error[%s]", err)
+	}
+	src := filepath.Join(goPath, "src")
+	writeTestFile(t, filepath.Join(src, "example.com/cc/main.go"),
+		"package main\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/cc/util\"\n\t\"example.com/dep\"\n\t\"example.com/vendored\"\n)\n\nfunc main() { fmt.Println(util.A, dep.B, vendored.C) }\n")
+	writeTestFile(t, filepath.Join(src, "example.com/cc/main_test.go"), "package main\n")
+	writeTestFile(t, filepath.Join(src, "example.com/cc/README.md"), "readme\n")
+	writeTestFile(t, filepath.Join(src, "example.com/cc/util/util.go"), "package util\n\nconst A = 1\n")
+	writeTestFile(t, filepath.Join(src, "example.com/cc/vendor/example.com/vendored/v.go"), "package vendored\n\nconst C = 3\n")
+	writeTestFile(t, filepath.Join(src, "example.com/dep/dep.go"), "package dep\n\nimport \"strings\"\n\nvar B = strings.ToUpper(\"b\")\n")
+	writeTestFile(t, filepath.Join(src, "example.com/unused/unused.go"), "package unused\n")
+	return goPath
+}
+
+func TestPackageCC(t *testing.T) {
+	goPath := setupTestGoPath(t)
+	defer os.RemoveAll(goPath)
+	oldGoPath := os.Getenv("GOPATH")
+	os.Setenv("GOPATH", goPath)
+	defer os.Setenv("GOPATH", oldGoPath)
+
+	codePackage, err := PackageCC("example.com/cc")
+	if err != nil {
+		t.Fatalf("PackageCC return error[%s]", err)
+	}
+	names, err := ListPackageContents(codePackage)
+	if err != nil {
+		t.Fatalf("ListPackageContents return error[%s]", err)
+	}
+	expected := []string{
+		"src/example.com/cc/main.go",
+		"src/example.com/cc/util/util.go",
+		"src/example.com/cc/vendor/example.com/vendored/v.go",
+		"src/example.com/dep/dep.go",
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("ListPackageContents return %v, expected %v", names, expected)
+	}
+
+	// Packaging from the chaincode directory gives the same package
+	fromDir, err := PackageCC(filepath.Join(goPath, "src", "example.com", "cc"))
+	if err != nil {
+		t.Fatalf("PackageCC return error[%s]", err)
+	}
+	if !bytes.Equal(codePackage, fromDir) {
+		t.Fatalf("PackageCC is not deterministic")
+	}
+
+	_, err = PackageCC("example.com/missing")
+	if err == nil {
+		t.Fatalf("PackageCC didn't return error for a missing chaincode")
+	}
+
+	writeTestFile(t, filepath.Join(goPath, "src", "example.com/broken/main.go"), "package main\n\nimport \"example.com/nowhere\"\n")
+	_, err = PackageCC("example.com/broken")
+	if err == nil || err.Error() != "Could not find dependency example.com/nowhere of example.com/broken: package not found" {
+		t.Fatalf("PackageCC didn't return the expected error for a missing dependency, got %v", err)
+	}
+
+	_, err = PackageCC("")
+	if err == nil || err.Error() != "chaincodePath is empty" {
+		t.Fatalf("PackageCC didn't return the expected error for an empty path")
+	}
+}
+
+func TestPackageCCFromModule(t *testing.T) {
+	goPath := setupTestGoPath(t)
+	defer os.RemoveAll(goPath)
+	oldGoPath := os.Getenv("GOPATH")
+	os.Setenv("GOPATH", goPath)
+	defer os.Setenv("GOPATH", oldGoPath)
+	oldModCache := os.Getenv("GOMODCACHE")
+	os.Setenv("GOMODCACHE", "")
+	defer os.Setenv("GOMODCACHE", oldModCache)
+
+	moduleDir, err := ioutil.TempDir("", "packagermodule")
+	if err != nil {
+		t.Fatalf("TempDir return error[%s]", err)
+	}
+	defer os.RemoveAll(moduleDir)
+	localDir, err := ioutil.TempDir("", "packagerlocal")
+	if err != nil {
+		t.Fatalf("TempDir return error[%s]", err)
+	}
+	defer os.RemoveAll(localDir)
+	writeTestFile(t, filepath.Join(moduleDir, "go.mod"), "module example.org/mod\n\ngo 1.12\n\nrequire (\n"+
+		"\tgithub.com/Example/dep v1.2.0 // indirect\n\texample.net/local v0.0.0\n)\n\nreplace example.net/local => "+localDir+"\n")
+	writeTestFile(t, filepath.Join(moduleDir, "cc", "cc.go"),
+		"package main\n\nimport (\n\t\"example.net/local\"\n\t\"example.org/mod/lib\"\n\t\"github.com/Example/dep/sub\"\n)\n\nfunc main() { _ = lib.D + sub.B + local.L }\n")
+	writeTestFile(t, filepath.Join(moduleDir, "lib", "lib.go"), "package lib\n\nconst D = \"d\"\n")
+	// required modules are read from the module cache, with upper case letters escaped
+	writeTestFile(t, filepath.Join(goPath, "pkg", "mod", "github.com", "!example", "dep@v1.2.0", "sub", "sub.go"), "package sub\n\nconst B = \"b\"\n")
+	writeTestFile(t, filepath.Join(localDir, "local.go"), "package local\n\nconst L = \"l\"\n")
+
+	codePackage, err := PackageCC(filepath.Join(moduleDir, "cc"))
+	if err != nil {
+		t.Fatalf("PackageCC return error[%s]", err)
+	}
+	names, err := ListPackageContents(codePackage)
+	if err != nil {
+		t.Fatalf("ListPackageContents return error[%s]", err)
+	}
+	expected := []string{
+		"src/example.net/local/local.go",
+		"src/example.org/mod/cc/cc.go",
+		"src/example.org/mod/lib/lib.go",
+		"src/github.com/Example/dep/sub/sub.go",
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("ListPackageContents return %v, expected %v", names, expected)
+	}
+
+	// GOPATH is not searched in module mode, example.com/dep is only there
+	writeTestFile(t, filepath.Join(moduleDir, "gopathdep", "main.go"), "package main\n\nimport \"example.com/dep\"\n\nvar _ = dep.B\n")
+	_, err = PackageCC(filepath.Join(moduleDir, "gopathdep"))
+	if err == nil || !strings.Contains(err.Error(), "package is neither vendored nor provided by a module required in") {
+		t.Fatalf("PackageCC didn't return the expected error for a dependency not required by go.mod, got %v", err)
+	}
+
+	// a required module missing from the module cache
+	writeTestFile(t, filepath.Join(moduleDir, "missing", "main.go"), "package main\n\nimport \"github.com/Example/dep/other\"\n\nvar _ = other.O\n")
+	_, err = PackageCC(filepath.Join(moduleDir, "missing"))
+	if err == nil || !strings.Contains(err.Error(), "package not found in module github.com/Example/dep") {
+		t.Fatalf("PackageCC didn't return the expected error for a package missing from the module cache, got %v", err)
+	}
+}
+
+func TestReadGoMod(t *testing.T) {
+	dir, err := ioutil.TempDir("", "packagergomod")
+	if err != nil {
+		t.Fatalf("TempDir return error[%s]", err)
+	}
+	defer os.RemoveAll(dir)
+	goMod := filepath.Join(dir, "go.mod")
+	writeTestFile(t, goMod, "modulefoo example.org/wrong\nmodule\t\"example.org/mod\"\n\nrequire example.com/a v1.0.0\nreplace example.com/a v1.0.0 => example.com/b v1.1.0\n")
+
+	modFile, ok := readGoMod(goMod)
+	if !ok {
+		t.Fatalf("readGoMod didn't read the module")
+	}
+	if modFile.modulePath != "example.org/mod" {
+		t.Fatalf("readGoMod return module path %s", modFile.modulePath)
+	}
+	if modFile.requires["example.com/a"] != "v1.0.0" {
+		t.Fatalf("readGoMod return requires %v", modFile.requires)
+	}
+	if modFile.replaces["example.com/a"] != (moduleVersion{path: "example.com/b", version: "v1.1.0"}) {
+		t.Fatalf("readGoMod return replaces %v", modFile.replaces)
+	}
+
+	writeTestFile(t, goMod, "modulefoo example.org/wrong\n")
+	if _, ok := readGoMod(goMod); ok {
+		t.Fatalf("readGoMod read a module from a modulefoo directive")
+	}
+}
+
+func TestListPackageContentsInvalid(t *testing.T) {
+	_, err := ListPackageContents([]byte("not a package"))
+	if err == nil {
+		t.Fatalf("ListPackageContents didn't return error for an invalid package")
+	}
+}
@@ -22,7 +22,10 @@ package fabricsdk
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
+	"sync"
 
+	"github.com/hyperledger/fabric-sdk-go/config"
 	kvs "github.com/hyperledger/fabric-sdk-go/keyvaluestore"
 	"github.com/hyperledger/fabric/bccsp"
 )
@@ -48,7 +51,9 @@ type Client struct {
 	chains      map[string]*Chain
 	cryptoSuite bccsp.BCCSP
 	stateStore  kvs.KeyValueStore
+	userMtx     sync.RWMutex
 	userContext *User
+	users       map[string]*User
 }
 
 // NewClient ...
@@ -57,7 +62,7 @@ type Client struct {
  */
 func NewClient() *Client {
 	chains := make(map[string]*Chain)
-	c := &Client{chains: chains, cryptoSuite: nil, stateStore: nil, userContext: nil}
+	c := &Client{chains: chains, cryptoSuite: nil, stateStore: nil, userContext: nil, users: make(map[string]*User)}
 	return c
 }
 
@@ -152,6 +157,7 @@ func (c *Client) GetCryptoSuite() bccsp.BCCSP {
  * in a persistence cache if the “state store” has been set on the Client instance. If no state store has been set,
  * this cache will not be established and the application is responsible for setting the user context again when the application
  * crashed and is recovered.
+ * The user is also added to the users of the client, see AddUserContext.
  */
 func (c *Client) SetUserContext(user *User, skipPersistence bool) error {
 	if user == nil {
@@ -161,39 +167,97 @@ func (c *Client) SetUserContext(user *User, skipPersistence bool) error {
 	if user.GetName() == "" {
 		return fmt.Errorf("user name is empty")
 	}
+	c.userMtx.Lock()
 	c.userContext = user
+	c.users[userKey(user.GetName(), user.GetMspID())] = user
+	c.userMtx.Unlock()
 	if !skipPersistence {
-		if c.stateStore == nil {
-			return fmt.Errorf("stateStore is nil")
-		}
-		userJSON := &UserJSON{PrivateKeySKI: user.GetPrivateKey().SKI(), EnrollmentCertificate: user.GetEnrollmentCertificate()}
-		data, err := json.Marshal(userJSON)
-		if err != nil {
-			return fmt.Errorf("Marshal json return error: %v", err)
-		}
-		err = c.stateStore.SetValue(user.GetName(), data)
-		if err != nil {
-			return fmt.Errorf("stateStore SetValue return error: %v", err)
-		}
+		return c.storeUser(user)
+	}
+	return nil
+
+}
+
+// AddUserContext ...
+/*
+ * Adds a user to the users the client can act on behalf of, without changing the security context
+ * of the client instance. Users are identified by their name and MSP ID, an existing user with the
+ * same name and MSP ID is replaced. The user is saved like by SetUserContext.
+ * @param {User} user The enrolled user
+ * @param {bool} skipPersistence Don't save the user in the state store
+ */
+func (c *Client) AddUserContext(user *User, skipPersistence bool) error {
+	if user == nil {
+		return fmt.Errorf("user is nil")
+	}
+	if user.GetName() == "" {
+		return fmt.Errorf("user name is empty")
+	}
+	c.userMtx.Lock()
+	c.users[userKey(user.GetName(), user.GetMspID())] = user
+	c.userMtx.Unlock()
+	if !skipPersistence {
+		return c.storeUser(user)
 	}
 	return nil
+}
 
+// RemoveUserContext ...
+/*
+ * Removes a user from the users of the client. The user isn't removed from the state store.
+ * If the user is the security context of the client instance, the client has no security context anymore.
+ * @param {string} name The user name
+ * @param {string} mspID The MSP ID of the user, empty for the configured MSP
+ */
+func (c *Client) RemoveUserContext(name string, mspID string) {
+	if mspID == "" {
+		mspID = config.GetMspID()
+	}
+	c.userMtx.Lock()
+	defer c.userMtx.Unlock()
+	key := userKey(name, mspID)
+	if user, ok := c.users[key]; ok && user == c.userContext {
+		c.userContext = nil
+	}
+	delete(c.users, key)
 }
 
 // GetUserContext ...
 /*
  * The client instance can have an optional state store. The SDK saves enrolled users in the storage which can be accessed by
  * authorized users of the application (authentication is done by the application outside of the SDK).
- * This function attempts to load the user by name from the local storage (via the KeyValueStore interface).
+ * This function returns the user of the configured MSP with the given name, or the security context of the client instance
+ * when the name is empty. It attempts to load a user it doesn't know by name from the local storage (via the KeyValueStore interface).
  * The loaded user object must represent an enrolled user with a valid enrollment certificate signed by a trusted CA
  * (such as the COP server).
  */
 func (c *Client) GetUserContext(name string) (*User, error) {
-	if c.userContext != nil {
+	if name == "" {
+		c.userMtx.RLock()
+		defer c.userMtx.RUnlock()
 		return c.userContext, nil
 	}
-	if name == "" {
-		return nil, nil
+	return c.GetMspUserContext(name, "")
+}
+
+// GetMspUserContext ...
+/*
+ * Returns the user with the given name and MSP ID, loading it from the state store when the client doesn't know it.
+ * A loaded user becomes the security context of the client instance when it has none.
+ * @param {string} name The user name
+ * @param {string} mspID The MSP ID of the user, empty for the configured MSP
+ * @returns {User} The user, nil if it is neither known nor stored
+ */
+func (c *Client) GetMspUserContext(name string, mspID string) (*User, error) {
+	if mspID == "" {
+		mspID = config.GetMspID()
+	}
+	key := userKey(name, mspID)
+	c.userMtx.RLock()
+	user := c.users[key]
+	c.userMtx.RUnlock()
+	if user != nil {
+		return user, nil
 	}
 	if c.stateStore == nil {
 		return nil, nil
@@ -201,7 +265,7 @@ func (c *Client) GetUserContext(name string) (*User, error) {
 	if c.cryptoSuite == nil {
 		return nil, fmt.Errorf("cryptoSuite is nil")
 	}
-	value, err := c.stateStore.GetValue(name)
+	value, err := c.stateStore.GetValue(storeKey(name, mspID))
 	if err != nil {
 		return nil, nil
 	}
@@ -210,14 +274,106 @@ func (c *Client) GetUserContext(name string) (*User, error) {
 	if err != nil {
 		return nil, fmt.Errorf("stateStore GetValue return error: %v", err)
 	}
-	user := NewUser(name)
+	user = NewUser(name)
+	user.SetMspID(userJSON.MspID)
 	user.SetEnrollmentCertificate(userJSON.EnrollmentCertificate)
-	key, err := c.cryptoSuite.GetKey(userJSON.PrivateKeySKI)
+	privateKey, err := c.cryptoSuite.GetKey(userJSON.PrivateKeySKI)
 	if err != nil {
 		return nil, fmt.Errorf("cryptoSuite GetKey return error: %v", err)
 	}
-	user.SetPrivateKey(key)
-	c.userContext = user
-	return c.userContext, nil
+	user.SetPrivateKey(privateKey)
 
+	c.userMtx.Lock()
+	defer c.userMtx.Unlock()
+	// another request may have loaded the user meanwhile
+	if loaded, ok := c.users[key]; ok {
+		return loaded, nil
+	}
+	c.users[key] = user
+	if c.userContext == nil {
+		c.userContext = user
+	}
+	return user, nil
+
+}
+
+// GetUserContexts ...
+/*
+ * Returns the users the client can act on behalf of, sorted by MSP ID and name.
+ */
+func (c *Client) GetUserContexts() []*User {
+	c.userMtx.RLock()
+	defer c.userMtx.RUnlock()
+	keys := make([]string, 0, len(c.users))
+	for key := range c.users {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	users := make([]*User, len(keys))
+	for i, key := range keys {
+		users[i] = c.users[key]
+	}
+	return users
+}
+
+/**
+ * private internal method returning the private key of the certificate, which is the enrollment
+ * certificate or a TCert of one of the users of the client in the MSP
+ */
+func (c *Client) getSigningKey(mspID string, cert []byte) (bccsp.Key, error) {
+	c.userMtx.RLock()
+	users := make([]*User, 0, len(c.users)+1)
+	if c.userContext != nil {
+		users = append(users, c.userContext)
+	}
+	for _, user := range c.users {
+		users = append(users, user)
+	}
+	c.userMtx.RUnlock()
+	for _, user := range users {
+		if user.GetMspID() != mspID {
+			continue
+		}
+		if key, err := user.getSigningKey(cert); err == nil {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("The certificate doesn't belong to any user of the client in MSP %s", mspID)
+}
+
+/**
+ * private internal method saving the user in the state store
+ */
+func (c *Client) storeUser(user *User) error {
+	if c.stateStore == nil {
+		return fmt.Errorf("stateStore is nil")
+	}
+	userJSON := &UserJSON{PrivateKeySKI: user.GetPrivateKey().SKI(), EnrollmentCertificate: user.GetEnrollmentCertificate(), MspID: user.mspID}
+	data, err := json.Marshal(userJSON)
+	if err != nil {
+		return fmt.Errorf("Marshal json return error: %v", err)
+	}
+	err = c.stateStore.SetValue(storeKey(user.GetName(), user.GetMspID()), data)
+	if err != nil {
+		return fmt.Errorf("stateStore SetValue return error: %v", err)
+	}
+	return nil
+}
+
+/**
+ * private internal method returning the key of a user in the users of the client
+ */
+func userKey(name string, mspID string) string {
+	return mspID + "/" + name
+}
+
+/**
+ * private internal method returning the key of a user in the state store, the users of the
+ * configured MSP are saved under their name
+ */
+func storeKey(name string, mspID string) string {
+	if mspID == config.GetMspID() {
+		return name
+	}
+	return name + "@" + mspID
 }
@@ -22,7 +22,9 @@ package fabricsdk
 import (
 	"testing"
 
+	"github.com/hyperledger/fabric-sdk-go/config"
 	kvs "github.com/hyperledger/fabric-sdk-go/keyvaluestore"
+	"github.com/hyperledger/fabric/bccsp"
 	"github.com/hyperledger/fabric/bccsp/sw"
 
 	bccspFactory "github.com/hyperledger/fabric/bccsp/factory"
@@ -129,3 +131,74 @@ func TestClientMethods(t *testing.T) {
 	}
 
 }
+
+func TestClientUserContexts(t *testing.T) {
+	client := setupTestClient(t)
+	defaultUser, err := client.GetUserContext("")
+	if err != nil {
+		t.Fatalf("client.GetUserContext return error[%s]", err)
+	}
+	stateStore, err := kvs.CreateNewFileKeyValueStore("/tmp/keyvaluestore-users")
+	if err != nil {
+		t.Fatalf("CreateNewFileKeyValueStore return error[%s]", err)
+	}
+	client.SetStateStore(stateStore)
+
+	// users with the same name in two MSPs
+	alice := NewUser("alice")
+	alice2 := NewUser("alice")
+	alice2.SetMspID("Org2MSP")
+	for _, user := range []*User{alice, alice2} {
+		key, err := client.GetCryptoSuite().KeyGen(&bccsp.ECDSAKeyGenOpts{Temporary: false})
+		if err != nil {
+			t.Fatalf("KeyGen return error[%s]", err)
+		}
+		user.SetPrivateKey(key)
+		user.SetEnrollmentCertificate([]byte("cert-" + user.GetMspID()))
+		if err := client.AddUserContext(user, false); err != nil {
+			t.Fatalf("client.AddUserContext return error[%s]", err)
+		}
+	}
+	if user, _ := client.GetUserContext(""); user != defaultUser {
+		t.Fatalf("client.AddUserContext changed the user context")
+	}
+	if user, _ := client.GetUserContext("alice"); user != alice {
+		t.Fatalf("client.GetUserContext didn't return the right user")
+	}
+	if user, _ := client.GetMspUserContext("alice", "Org2MSP"); user != alice2 {
+		t.Fatalf("client.GetMspUserContext didn't return the right user")
+	}
+	if user, _ := client.GetUserContext("bob"); user != nil {
+		t.Fatalf("client.GetUserContext returned a user for an unknown name")
+	}
+	if users := client.GetUserContexts(); len(users) != 3 || users[0] != alice || users[1] != defaultUser || users[2] != alice2 {
+		t.Fatalf("client.GetUserContexts returned wrong users %v", users)
+	}
+
+	// a new client loads the users from the state store
+	loader := NewClient()
+	loader.SetCryptoSuite(client.GetCryptoSuite())
+	loader.SetStateStore(stateStore)
+	user, err := loader.GetMspUserContext("alice", "Org2MSP")
+	if err != nil {
+		t.Fatalf("client.GetMspUserContext return error[%s]", err)
+	}
+	if user == nil || user.GetMspID() != "Org2MSP" || string(user.GetEnrollmentCertificate()) != "cert-Org2MSP" {
+		t.Fatalf("client.GetMspUserContext didn't load the right user")
+	}
+	if user, _ := loader.GetUserContext(""); user == nil || user.GetMspID() != "Org2MSP" {
+		t.Fatalf("The loaded user didn't become the user context")
+	}
+	user, err = loader.GetUserContext("alice")
+	if err != nil {
+		t.Fatalf("client.GetUserContext return error[%s]", err)
+	}
+	if user == nil || user.GetMspID() != config.GetMspID() || string(user.GetEnrollmentCertificate()) != "cert-"+config.GetMspID() {
+		t.Fatalf("client.GetUserContext didn't load the right user")
+	}
+
+	client.RemoveUserContext("alice", "Org2MSP")
+	if user, _ := client.GetMspUserContext("alice", "Org2MSP"); user == alice2 {
+		t.Fatalf("client.RemoveUserContext didn't remove the user")
+	}
+}
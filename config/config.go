@@ -164,6 +164,42 @@ func GetSecurityLevel() int {
 
 }
 
+// GetSecurityProvider ...
+/**
+ * @returns {string} The crypto provider holding the private keys, "SW" (default) or "PKCS11"
+ */
+func GetSecurityProvider() string {
+	provider := viper.GetString("client.security.provider")
+	if provider == "" {
+		return "SW"
+	}
+	return provider
+}
+
+// GetSecurityProviderLibPath ...
+/**
+ * @returns {string} The path of the PKCS#11 library of the HSM
+ */
+func GetSecurityProviderLibPath() string {
+	return viper.GetString("client.security.pkcs11.library")
+}
+
+// GetSecurityProviderLabel ...
+/**
+ * @returns {string} The label of the HSM slot holding the private keys
+ */
+func GetSecurityProviderLabel() string {
+	return viper.GetString("client.security.pkcs11.label")
+}
+
+// GetSecurityProviderPin ...
+/**
+ * @returns {string} The user PIN of the HSM slot
+ */
+func GetSecurityProviderPin() string {
+	return viper.GetString("client.security.pkcs11.pin")
+}
+
 // GetOrdererHost ...
 func GetOrdererHost() string {
 	return viper.GetString("client.orderer.host")
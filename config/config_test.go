@@ -53,3 +53,12 @@ func TestMain(m *testing.M) {
 	}
 	os.Exit(m.Run())
 }
+
+func TestGetSecurityProvider(t *testing.T) {
+	if GetSecurityProvider() != "SW" {
+		t.Fatalf("Security provider is not SW")
+	}
+	if GetSecurityProviderLibPath() == "" || GetSecurityProviderLabel() == "" || GetSecurityProviderPin() == "" {
+		t.Fatalf("PKCS11 settings are empty")
+	}
+}
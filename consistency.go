@@ -0,0 +1,240 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	pb "github.com/hyperledger/fabric/protos/peer"
+	protos_utils "github.com/hyperledger/fabric/protos/utils"
+)
+
+// ResponseConsistency tells what to do with endorsers whose proposal response differs from the others
+type ResponseConsistency int
+
+const (
+	// FailOnDivergence refuses the proposal responses when any endorser diverges
+	FailOnDivergence ResponseConsistency = iota
+	// DropDivergentEndorsers keeps the responses of the majority and drops the others
+	DropDivergentEndorsers
+)
+
+// maxDiffBytes is the number of bytes shown around the first difference of binary fields
+const maxDiffBytes = 16
+
+// EndorserDivergence describes how the response of an endorser differs from the majority's
+type EndorserDivergence struct {
+	Endorser    string
+	Differences []string
+}
+
+// InconsistentResponsesError is returned when endorsers returned different ProposalResponsePayloads
+type InconsistentResponsesError struct {
+	// Majority holds the endorsers that agree on the reference response
+	Majority    []string
+	Divergences []*EndorserDivergence
+}
+
+// Error describes the divergent endorsers and their differences
+func (e *InconsistentResponsesError) Error() string {
+	var details []string
+	for _, d := range e.Divergences {
+		details = append(details, fmt.Sprintf("%s: %s", d.Endorser, strings.Join(d.Differences, ", ")))
+	}
+	return fmt.Sprintf("ProposalResponsePayloads do not match, %d endorser(s) diverge from [%s]: %s",
+		len(e.Divergences), strings.Join(e.Majority, " "), strings.Join(details, "; "))
+}
+
+// CheckProposalResponses ...
+/**
+ * Compares the ProposalResponsePayloads returned by the endorsers. The committers invalidate a
+ * transaction whose endorsements are not over the same payload, so divergent endorsers are reported
+ * with a decoded diff of their chaincode action results and events.
+ * Responses that carry an error are not endorsements and are left out.
+ * @param {map} responses The responses returned by SendTransactionProposal.
+ * @param {ResponseConsistency} consistency Whether to fail or to drop the minority endorsers on divergence.
+ * @returns {[]TransactionProposalResponse} The consistent responses, ordered by endorser.
+ * The error is an *InconsistentResponsesError when the endorsers diverge.
+ */
+func CheckProposalResponses(responses map[string]*TransactionProposalResponse, consistency ResponseConsistency) ([]*TransactionProposalResponse, error) {
+	var endorsers []string
+	for endorser, r := range responses {
+		if r != nil && r.Err == nil && r.ProposalResponse != nil {
+			endorsers = append(endorsers, endorser)
+		}
+	}
+	if len(endorsers) == 0 {
+		return nil, fmt.Errorf("No successful proposal response to check")
+	}
+	sort.Strings(endorsers)
+
+	resps := make([]*pb.ProposalResponse, len(endorsers))
+	for i, endorser := range endorsers {
+		resps[i] = responses[endorser].ProposalResponse
+	}
+	majority, err := compareProposalResponses(endorsers, resps)
+	if err != nil {
+		inconsistent, ok := err.(*InconsistentResponsesError)
+		// with a tie there is no majority to keep
+		if consistency != DropDivergentEndorsers || !ok || len(inconsistent.Majority) <= len(endorsers)/2 {
+			return nil, err
+		}
+		logger.Warningf("Dropping divergent endorsers: %s\n", err)
+	}
+
+	consistent := make([]*TransactionProposalResponse, len(majority))
+	for i, index := range majority {
+		consistent[i] = responses[endorsers[index]]
+	}
+	return consistent, nil
+}
+
+// compareProposalResponses groups the responses by payload and returns the indexes of the largest group.
+// An *InconsistentResponsesError is returned along when some responses are not in that group.
+func compareProposalResponses(names []string, resps []*pb.ProposalResponse) ([]int, error) {
+	var groups [][]int
+	for i, r := range resps {
+		found := false
+		for g, group := range groups {
+			if bytes.Equal(resps[group[0]].Payload, r.Payload) {
+				groups[g] = append(group, i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			groups = append(groups, []int{i})
+		}
+	}
+
+	largest := 0
+	for g, group := range groups {
+		if len(group) > len(groups[largest]) {
+			largest = g
+		}
+	}
+	majority := groups[largest]
+	if len(groups) == 1 {
+		return majority, nil
+	}
+
+	reference := resps[majority[0]].Payload
+	inconsistent := &InconsistentResponsesError{}
+	for _, i := range majority {
+		inconsistent.Majority = append(inconsistent.Majority, names[i])
+	}
+	for g, group := range groups {
+		if g == largest {
+			continue
+		}
+		differences := diffProposalResponsePayloads(reference, resps[group[0]].Payload)
+		for _, i := range group {
+			inconsistent.Divergences = append(inconsistent.Divergences, &EndorserDivergence{Endorser: names[i], Differences: differences})
+		}
+	}
+	return majority, inconsistent
+}
+
+// diffProposalResponsePayloads decodes two ProposalResponsePayloads and describes how they differ
+func diffProposalResponsePayloads(expected []byte, actual []byte) []string {
+	expectedPayload, err := protos_utils.GetProposalResponsePayload(expected)
+	if err != nil {
+		return []string{fmt.Sprintf("reference payload could not be decoded: %s", err)}
+	}
+	actualPayload, err := protos_utils.GetProposalResponsePayload(actual)
+	if err != nil {
+		return []string{fmt.Sprintf("payload could not be decoded: %s", err)}
+	}
+
+	var differences []string
+	if !bytes.Equal(expectedPayload.ProposalHash, actualPayload.ProposalHash) {
+		differences = append(differences, "proposal hash "+diffBytes(expectedPayload.ProposalHash, actualPayload.ProposalHash))
+	}
+
+	expectedAction, err := protos_utils.GetChaincodeAction(expectedPayload.Extension)
+	if err != nil {
+		return append(differences, fmt.Sprintf("reference chaincode action could not be decoded: %s", err))
+	}
+	actualAction, err := protos_utils.GetChaincodeAction(actualPayload.Extension)
+	if err != nil {
+		return append(differences, fmt.Sprintf("chaincode action could not be decoded: %s", err))
+	}
+	if !bytes.Equal(expectedAction.Results, actualAction.Results) {
+		differences = append(differences, "results "+diffBytes(expectedAction.Results, actualAction.Results))
+	}
+	if !bytes.Equal(expectedAction.Events, actualAction.Events) {
+		differences = append(differences, diffChaincodeEvents(expectedAction.Events, actualAction.Events)...)
+	}
+
+	if len(differences) == 0 {
+		// the payloads differ in a way the decoded fields don't show, such as field encoding
+		differences = append(differences, "payload "+diffBytes(expected, actual))
+	}
+	return differences
+}
+
+// diffChaincodeEvents decodes two serialized chaincode events and describes how they differ
+func diffChaincodeEvents(expected []byte, actual []byte) []string {
+	expectedEvent, err := protos_utils.GetChaincodeEvents(expected)
+	if err != nil {
+		return []string{fmt.Sprintf("reference event could not be decoded: %s", err)}
+	}
+	actualEvent, err := protos_utils.GetChaincodeEvents(actual)
+	if err != nil {
+		return []string{fmt.Sprintf("event could not be decoded: %s", err)}
+	}
+
+	var differences []string
+	if expectedEvent.ChaincodeID != actualEvent.ChaincodeID {
+		differences = append(differences, fmt.Sprintf("event chaincodeID %q != %q", expectedEvent.ChaincodeID, actualEvent.ChaincodeID))
+	}
+	if expectedEvent.TxID != actualEvent.TxID {
+		differences = append(differences, fmt.Sprintf("event txID %q != %q", expectedEvent.TxID, actualEvent.TxID))
+	}
+	if expectedEvent.EventName != actualEvent.EventName {
+		differences = append(differences, fmt.Sprintf("event name %q != %q", expectedEvent.EventName, actualEvent.EventName))
+	}
+	if !bytes.Equal(expectedEvent.Payload, actualEvent.Payload) {
+		differences = append(differences, "event payload "+diffBytes(expectedEvent.Payload, actualEvent.Payload))
+	}
+	if len(differences) == 0 {
+		differences = append(differences, "event "+diffBytes(expected, actual))
+	}
+	return differences
+}
+
+// diffBytes shows the lengths of two byte slices and the bytes at their first difference
+func diffBytes(expected []byte, actual []byte) string {
+	offset := 0
+	for offset < len(expected) && offset < len(actual) && expected[offset] == actual[offset] {
+		offset++
+	}
+	excerpt := func(b []byte) string {
+		end := offset + maxDiffBytes
+		if end > len(b) {
+			end = len(b)
+		}
+		return fmt.Sprintf("%x", b[offset:end])
+	}
+	return fmt.Sprintf("differ at byte %d (%d bytes [%s] != %d bytes [%s])", offset, len(expected), excerpt(expected), len(actual), excerpt(actual))
+}
@@ -0,0 +1,175 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func TestCheckProposalResponses(t *testing.T) {
+	agreed := proposalResponse(t, []byte("results"), nil)
+	responses := map[string]*TransactionProposalResponse{
+		"peer1": {Endorser: "peer1", ProposalResponse: agreed},
+		"peer2": {Endorser: "peer2", ProposalResponse: agreed},
+		"peer3": {Endorser: "peer3", ProposalResponse: proposalResponse(t, []byte("resultz"),
+			&pb.ChaincodeEvent{ChaincodeID: "cc", EventName: "evt", Payload: []byte("p")})},
+		"peer4": {Endorser: "peer4", Err: fmt.Errorf("unreachable")},
+	}
+
+	_, err := CheckProposalResponses(responses, FailOnDivergence)
+	inconsistent, ok := err.(*InconsistentResponsesError)
+	if !ok {
+		t.Fatalf("CheckProposalResponses didn't return an InconsistentResponsesError, got %v", err)
+	}
+	if !reflect.DeepEqual(inconsistent.Majority, []string{"peer1", "peer2"}) {
+		t.Fatalf("Unexpected majority %v", inconsistent.Majority)
+	}
+	if len(inconsistent.Divergences) != 1 || inconsistent.Divergences[0].Endorser != "peer3" {
+		t.Fatalf("Unexpected divergences %v", inconsistent.Divergences)
+	}
+	expected := []string{
+		"results differ at byte 6 (7 bytes [73] != 7 bytes [7a])",
+		"event chaincodeID \"\" != \"cc\"",
+		"event name \"\" != \"evt\"",
+		"event payload differ at byte 0 (0 bytes [] != 1 bytes [70])",
+	}
+	if !reflect.DeepEqual(inconsistent.Divergences[0].Differences, expected) {
+		t.Fatalf("Unexpected differences %v", inconsistent.Divergences[0].Differences)
+	}
+	if !strings.HasPrefix(err.Error(), "ProposalResponsePayloads do not match, 1 endorser(s) diverge from [peer1 peer2]: peer3: results differ") {
+		t.Fatalf("Unexpected error message %s", err)
+	}
+
+	consistent, err := CheckProposalResponses(responses, DropDivergentEndorsers)
+	if err != nil {
+		t.Fatalf("CheckProposalResponses return error[%s]", err)
+	}
+	if len(consistent) != 2 || consistent[0].Endorser != "peer1" || consistent[1].Endorser != "peer2" {
+		t.Fatalf("CheckProposalResponses didn't keep the majority endorsers, got %v", consistent)
+	}
+
+	// without a majority the divergent endorsers can't be dropped
+	delete(responses, "peer2")
+	_, err = CheckProposalResponses(responses, DropDivergentEndorsers)
+	if _, ok := err.(*InconsistentResponsesError); !ok {
+		t.Fatalf("CheckProposalResponses didn't fail on a tie, got %v", err)
+	}
+
+	_, err = CheckProposalResponses(map[string]*TransactionProposalResponse{"peer4": responses["peer4"]}, FailOnDivergence)
+	if err == nil || err.Error() != "No successful proposal response to check" {
+		t.Fatalf("CheckProposalResponses didn't return the expected error, got %v", err)
+	}
+}
+
+func TestCreateTransactionDivergentResponses(t *testing.T) {
+	client := setupTestClient(t)
+	chain, err := NewChain("testChain", client)
+	if err != nil {
+		t.Fatalf("NewChain return error[%s]", err)
+	}
+	_, proposal, err := chain.CreateTransactionProposal("testCC", "testChain", []string{"invoke"}, true, "1234", nil)
+	if err != nil {
+		t.Fatalf("CreateTransactionProposal return error[%s]", err)
+	}
+	resps := []*pb.ProposalResponse{proposalResponse(t, []byte("a"), nil), proposalResponse(t, []byte("b"), nil)}
+	_, err = chain.CreateTransaction(proposal, resps)
+	if _, ok := err.(*InconsistentResponsesError); !ok {
+		t.Fatalf("CreateTransaction didn't refuse divergent responses, got %v", err)
+	}
+}
+
+func TestCreateTransactionFromResponses(t *testing.T) {
+	client := setupTestClient(t)
+	chain, err := NewChain("testChain", client)
+	if err != nil {
+		t.Fatalf("NewChain return error[%s]", err)
+	}
+	_, proposal, err := chain.CreateTransactionProposal("testCC", "testChain", []string{"invoke"}, true, "1234", nil)
+	if err != nil {
+		t.Fatalf("CreateTransactionProposal return error[%s]", err)
+	}
+	agreed := proposalResponse(t, []byte("results"), nil)
+	divergent := proposalResponse(t, []byte("resultz"), nil)
+	responses := map[string]*TransactionProposalResponse{
+		"peer1:7051": {Endorser: "peer1:7051", ProposalResponse: agreed},
+		"peer2:7051": {Endorser: "peer2:7051", ProposalResponse: agreed},
+		"peer3:7051": {Endorser: "peer3:7051", ProposalResponse: divergent},
+	}
+
+	_, _, err = chain.CreateTransactionFromResponses(proposal, responses, FailOnDivergence)
+	if _, ok := err.(*InconsistentResponsesError); !ok || !strings.Contains(err.Error(), "[peer1:7051 peer2:7051]: peer3:7051: results differ") {
+		t.Fatalf("CreateTransactionFromResponses didn't name the divergent endorser, got %v", err)
+	}
+	tx, kept, err := chain.CreateTransactionFromResponses(proposal, responses, DropDivergentEndorsers)
+	if err != nil {
+		t.Fatalf("CreateTransactionFromResponses return error[%s]", err)
+	}
+	if len(kept) != 2 || kept[0].Endorser != "peer1:7051" || kept[1].Endorser != "peer2:7051" {
+		t.Fatalf("CreateTransactionFromResponses didn't keep the majority endorsers, got %v", kept)
+	}
+	actionPayload := &pb.ChaincodeActionPayload{}
+	if err := proto.Unmarshal(tx.Actions[0].Payload, actionPayload); err != nil {
+		t.Fatalf("Unmarshal ChaincodeActionPayload return error[%s]", err)
+	}
+	if len(actionPayload.Action.Endorsements) != 2 {
+		t.Fatalf("Transaction has %d endorsements, expected 2", len(actionPayload.Action.Endorsements))
+	}
+
+	// a malformed response is reported with its endorser instead of panicking
+	responses["peer3:7051"] = &TransactionProposalResponse{Endorser: "peer3:7051", ProposalResponse: &pb.ProposalResponse{}}
+	_, _, err = chain.CreateTransactionFromResponses(proposal, responses, DropDivergentEndorsers)
+	if err == nil || err.Error() != "Endorser peer3:7051 returned a proposal response without response" {
+		t.Fatalf("CreateTransactionFromResponses didn't return the expected error, got %v", err)
+	}
+	_, err = chain.CreateTransaction(proposal, []*pb.ProposalResponse{agreed, {}})
+	if err == nil || err.Error() != "Proposal response 1 has no response" {
+		t.Fatalf("CreateTransaction didn't return the expected error, got %v", err)
+	}
+	_, err = chain.CreateTransaction(proposal, []*pb.ProposalResponse{agreed, {Response: &pb.Response{Status: 200}}})
+	if err == nil || err.Error() != "Proposal response 1 has no endorsement" {
+		t.Fatalf("CreateTransaction didn't return the expected error, got %v", err)
+	}
+}
+
+func proposalResponse(t *testing.T, results []byte, event *pb.ChaincodeEvent) *pb.ProposalResponse {
+	var events []byte
+	var err error
+	if event != nil {
+		if events, err = proto.Marshal(event); err != nil {
+			t.Fatalf("Marshal return error[%s]", err)
+		}
+	}
+	extension, err := proto.Marshal(&pb.ChaincodeAction{Results: results, Events: events})
+	if err != nil {
+		t.Fatalf("Marshal return error[%s]", err)
+	}
+	payload, err := proto.Marshal(&pb.ProposalResponsePayload{ProposalHash: []byte("hash"), Extension: extension})
+	if err != nil {
+		t.Fatalf("Marshal return error[%s]", err)
+	}
+	return &pb.ProposalResponse{Response: &pb.Response{Status: 200}, Payload: payload,
+		Endorsement: &pb.Endorsement{Endorser: []byte("endorser"), Signature: []byte("signature")}}
+}
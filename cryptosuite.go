@@ -0,0 +1,134 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	config "github.com/hyperledger/fabric-sdk-go/config"
+	"github.com/hyperledger/fabric/bccsp"
+	bccspFactory "github.com/hyperledger/fabric/bccsp/factory"
+	"github.com/hyperledger/fabric/bccsp/pkcs11"
+	"github.com/hyperledger/fabric/bccsp/sw"
+)
+
+const (
+	// SWProvider is the software crypto provider, keeping the private keys in a file key store
+	SWProvider = "SW"
+	// PKCS11Provider is the crypto provider keeping the private keys in a PKCS#11 HSM
+	PKCS11Provider = "PKCS11"
+)
+
+// CryptoSuiteOptions ...
+/**
+ * The settings of the crypto suite holding the private keys of the users.
+ * KeyStorePath is only used by the SW provider, Library, Label and Pin by the PKCS11 provider.
+ */
+type CryptoSuiteOptions struct {
+	Provider      string
+	SecurityLevel int
+	HashAlgorithm string
+	KeyStorePath  string
+	Library       string
+	Label         string
+	Pin           string
+}
+
+// NewCryptoSuiteFromConfig ...
+/**
+ * Create the crypto suite described by the client.security and client.keystore settings of the configuration
+ * @returns {bccsp.BCCSP} The crypto suite
+ */
+func NewCryptoSuiteFromConfig() (bccsp.BCCSP, error) {
+	return NewCryptoSuite(&CryptoSuiteOptions{
+		Provider:      config.GetSecurityProvider(),
+		SecurityLevel: config.GetSecurityLevel(),
+		HashAlgorithm: config.GetSecurityAlgorithm(),
+		KeyStorePath:  config.GetKeyStorePath(),
+		Library:       config.GetSecurityProviderLibPath(),
+		Label:         config.GetSecurityProviderLabel(),
+		Pin:           config.GetSecurityProviderPin(),
+	})
+}
+
+// NewCryptoSuite ...
+/**
+ * Create a crypto suite. The private keys it generates with non temporary options, such as
+ * the keys of msp.Services.EnrollWithCryptoSuite, are kept by the provider and found by their SKI.
+ * @param {CryptoSuiteOptions} options The provider and its settings
+ * @returns {bccsp.BCCSP} The crypto suite
+ */
+func NewCryptoSuite(options *CryptoSuiteOptions) (bccsp.BCCSP, error) {
+	if options == nil {
+		return nil, fmt.Errorf("crypto suite options are nil")
+	}
+	switch strings.ToUpper(options.Provider) {
+	case SWProvider:
+		if options.KeyStorePath == "" {
+			return nil, fmt.Errorf("key store path is empty")
+		}
+		ks := &sw.FileBasedKeyStore{}
+		if err := ks.Init(nil, options.KeyStorePath, false); err != nil {
+			return nil, fmt.Errorf("Failed initializing key store [%s]", err)
+		}
+		cryptoSuite, err := bccspFactory.GetBCCSP(&bccspFactory.SwOpts{Ephemeral_: true, SecLevel: options.SecurityLevel,
+			HashFamily: options.HashAlgorithm, KeyStore: ks})
+		if err != nil {
+			return nil, fmt.Errorf("Failed getting software-based BCCSP [%s]", err)
+		}
+		return cryptoSuite, nil
+	case PKCS11Provider:
+		if err := checkPKCS11Options(options); err != nil {
+			return nil, err
+		}
+		// the keys are kept by the HSM and found by their SKI, none is stored outside of it.
+		// The PKCS11Opts of the vendored factory take no library, label and PIN yet, so the
+		// HSM must be the one the factory is built for; the settings are only validated here.
+		cryptoSuite, err := bccspFactory.GetBCCSP(&bccspFactory.PKCS11Opts{Ephemeral_: true, SecLevel: options.SecurityLevel,
+			HashFamily: options.HashAlgorithm, KeyStore: &pkcs11.DummyKeyStore{}})
+		if err != nil {
+			return nil, fmt.Errorf("Failed getting PKCS11-based BCCSP [%s]", err)
+		}
+		return cryptoSuite, nil
+	default:
+		return nil, fmt.Errorf("unsupported crypto provider %s", options.Provider)
+	}
+}
+
+/**
+ * private internal method validating the HSM settings of the PKCS11 provider
+ */
+func checkPKCS11Options(options *CryptoSuiteOptions) error {
+	if options.Library == "" {
+		return fmt.Errorf("PKCS11 library is empty")
+	}
+	if _, err := os.Stat(options.Library); err != nil {
+		return fmt.Errorf("PKCS11 library %s not found: %s", options.Library, err)
+	}
+	if options.Label == "" {
+		return fmt.Errorf("PKCS11 label is empty")
+	}
+	if options.Pin == "" {
+		return fmt.Errorf("PKCS11 pin is empty")
+	}
+	return nil
+}
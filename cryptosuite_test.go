@@ -0,0 +1,160 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/bccsp"
+)
+
+func TestNewCryptoSuite(t *testing.T) {
+	options := &CryptoSuiteOptions{Provider: SWProvider, SecurityLevel: 256, HashAlgorithm: "SHA2", KeyStorePath: "/tmp/keystoretest"}
+	cryptoSuite, err := NewCryptoSuite(options)
+	if err != nil {
+		t.Fatalf("NewCryptoSuite return error[%s]", err)
+	}
+	key, err := cryptoSuite.KeyGen(&bccsp.ECDSAKeyGenOpts{Temporary: false})
+	if err != nil {
+		t.Fatalf("KeyGen return error[%s]", err)
+	}
+
+	// a new crypto suite on the same key store finds the key by its SKI
+	cryptoSuite, err = NewCryptoSuite(&CryptoSuiteOptions{Provider: "sw", SecurityLevel: 256, HashAlgorithm: "SHA2",
+		KeyStorePath: "/tmp/keystoretest"})
+	if err != nil {
+		t.Fatalf("NewCryptoSuite return error[%s]", err)
+	}
+	storedKey, err := cryptoSuite.GetKey(key.SKI())
+	if err != nil {
+		t.Fatalf("GetKey return error[%s]", err)
+	}
+	if !bytes.Equal(storedKey.SKI(), key.SKI()) || !storedKey.Private() {
+		t.Fatalf("GetKey didn't return the generated key")
+	}
+
+	if _, err := NewCryptoSuite(&CryptoSuiteOptions{Provider: "unknown"}); err == nil {
+		t.Fatalf("NewCryptoSuite didn't return error with an unknown provider")
+	}
+	if _, err := NewCryptoSuite(&CryptoSuiteOptions{Provider: SWProvider}); err == nil {
+		t.Fatalf("NewCryptoSuite didn't return error without key store path")
+	}
+}
+
+func TestNewPKCS11CryptoSuiteOptions(t *testing.T) {
+	library, err := ioutil.TempFile("", "libpkcs11")
+	if err != nil {
+		t.Fatalf("TempFile return error[%s]", err)
+	}
+	library.Close()
+	defer os.Remove(library.Name())
+
+	tests := []struct {
+		options *CryptoSuiteOptions
+		err     string
+	}{
+		{&CryptoSuiteOptions{Provider: PKCS11Provider, Label: "ForFabric", Pin: "98765432"}, "PKCS11 library is empty"},
+		{&CryptoSuiteOptions{Provider: PKCS11Provider, Library: library.Name() + ".missing", Label: "ForFabric", Pin: "98765432"}, "not found"},
+		{&CryptoSuiteOptions{Provider: PKCS11Provider, Library: library.Name(), Pin: "98765432"}, "PKCS11 label is empty"},
+		{&CryptoSuiteOptions{Provider: PKCS11Provider, Library: library.Name(), Label: "ForFabric"}, "PKCS11 pin is empty"},
+		// a library which isn't a PKCS#11 module gives no crypto suite
+		{&CryptoSuiteOptions{Provider: PKCS11Provider, Library: library.Name(), Label: "ForFabric", Pin: "98765432"}, "Failed getting PKCS11-based BCCSP"},
+	}
+	for _, test := range tests {
+		cryptoSuite, err := NewCryptoSuite(test.options)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("NewCryptoSuite return error[%v], expected [%s]", err, test.err)
+		}
+		if cryptoSuite != nil {
+			t.Fatalf("NewCryptoSuite returned a crypto suite with an error")
+		}
+	}
+}
+
+// softHSMLibrary returns the SoftHSM library set by PKCS11_LIB or installed at a usual path, empty if there is none
+func softHSMLibrary() string {
+	libraries := []string{os.Getenv("PKCS11_LIB"), "/usr/lib/softhsm/libsofthsm2.so",
+		"/usr/lib/x86_64-linux-gnu/softhsm/libsofthsm2.so", "/usr/local/lib/softhsm/libsofthsm2.so"}
+	for _, library := range libraries {
+		if library == "" {
+			continue
+		}
+		if _, err := os.Stat(library); err == nil {
+			return library
+		}
+	}
+	return ""
+}
+
+func TestNewPKCS11CryptoSuite(t *testing.T) {
+	library := softHSMLibrary()
+	if library == "" {
+		t.Skip("SoftHSM is not installed")
+	}
+	label, pin := os.Getenv("PKCS11_LABEL"), os.Getenv("PKCS11_PIN")
+	if label == "" {
+		label = "ForFabric"
+	}
+	if pin == "" {
+		pin = "98765432"
+	}
+	options := &CryptoSuiteOptions{Provider: PKCS11Provider, SecurityLevel: 256, HashAlgorithm: "SHA2",
+		KeyStorePath: "/tmp/keystoretest", Library: library, Label: label, Pin: pin}
+	cryptoSuite, err := NewCryptoSuite(options)
+	if err != nil {
+		t.Fatalf("NewCryptoSuite return error[%s]", err)
+	}
+	key, err := cryptoSuite.KeyGen(&bccsp.ECDSAKeyGenOpts{Temporary: false})
+	if err != nil {
+		t.Fatalf("KeyGen return error[%s]", err)
+	}
+	// the key never leaves the HSM
+	if _, err := os.Stat(filepath.Join(options.KeyStorePath, hex.EncodeToString(key.SKI())+"_sk")); !os.IsNotExist(err) {
+		t.Fatalf("The private key was stored out of the HSM")
+	}
+
+	// a new crypto suite on the same slot finds the key by its SKI and signs with it
+	cryptoSuite, err = NewCryptoSuite(options)
+	if err != nil {
+		t.Fatalf("NewCryptoSuite return error[%s]", err)
+	}
+	storedKey, err := cryptoSuite.GetKey(key.SKI())
+	if err != nil {
+		t.Fatalf("GetKey return error[%s]", err)
+	}
+	digest := []byte("0123456789abcdef0123456789abcdef")
+	signature, err := cryptoSuite.Sign(storedKey, digest, nil)
+	if err != nil {
+		t.Fatalf("Sign return error[%s]", err)
+	}
+	publicKey, err := storedKey.PublicKey()
+	if err != nil {
+		t.Fatalf("PublicKey return error[%s]", err)
+	}
+	if valid, err := cryptoSuite.Verify(publicKey, signature, digest, nil); err != nil || !valid {
+		t.Fatalf("The signature of the HSM key doesn't verify")
+	}
+}
@@ -0,0 +1,288 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	kvs "github.com/hyperledger/fabric-sdk-go/keyvaluestore"
+	common "github.com/hyperledger/fabric/protos/common"
+	"golang.org/x/net/context"
+)
+
+// checkpointKeyPrefix prefixes the consumer name in the key of its checkpoint
+const checkpointKeyPrefix = "checkpoint-"
+
+// BlockReplay retrieves the committed blocks from the start block up to the
+// newest one, in order. Both channels are closed once the blocks are sent, an
+// error has occurred or the context is done, like for Orderer.Deliver.
+type BlockReplay func(ctx context.Context, start uint64) (<-chan *common.Block, <-chan error)
+
+// checkpointJSON is the checkpoint saved in the key value store
+type checkpointJSON struct {
+	BlockNumber uint64
+}
+
+// BlockConsumer ...
+/**
+ * The BlockConsumer delivers the blocks of a chain to a named consumer, at least
+ * once, from the block following its checkpoint. The checkpoint, the last
+ * acknowledged block, is saved in a key value store so that a restarted consumer
+ * resumes where it stopped: the blocks committed since are replayed before the
+ * live blocks of the EventHub.
+ */
+type BlockConsumer struct {
+	name     string
+	eventHub *EventHub
+	store    kvs.KeyValueStore
+	replay   BlockReplay
+	// protects the checkpoint and the error
+	mtx           sync.Mutex
+	checkpoint    uint64
+	hasCheckpoint bool
+	err           error
+}
+
+// NewBlockConsumer ...
+/**
+ * @param {string} name The consumer name, which identifies its checkpoint in the store.
+ * @param {EventHub} eventHub The source of the live blocks.
+ * @param {KeyValueStore} store The store of the checkpoint.
+ * @param {BlockReplay} replay The source of the blocks committed since the checkpoint.
+ */
+func NewBlockConsumer(name string, eventHub *EventHub, store kvs.KeyValueStore, replay BlockReplay) (*BlockConsumer, error) {
+	if name == "" {
+		return nil, fmt.Errorf("name is empty")
+	}
+	if eventHub == nil {
+		return nil, fmt.Errorf("eventHub is nil")
+	}
+	if store == nil {
+		return nil, fmt.Errorf("store is nil")
+	}
+	if replay == nil {
+		return nil, fmt.Errorf("replay is nil")
+	}
+	return &BlockConsumer{name: name, eventHub: eventHub, store: store, replay: replay}, nil
+}
+
+// GetCheckpoint ...
+/**
+ * Get the checkpoint of the consumer from the store.
+ * @returns {uint64} The number of the last acknowledged block.
+ * @returns {bool} false if no block has been acknowledged yet.
+ */
+func (c *BlockConsumer) GetCheckpoint() (uint64, bool, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if err := c.loadCheckpoint(); err != nil {
+		return 0, false, err
+	}
+	return c.checkpoint, c.hasCheckpoint, nil
+}
+
+func (c *BlockConsumer) loadCheckpoint() error {
+	value, err := c.store.GetValue(checkpointKeyPrefix + c.name)
+	if err == kvs.ErrNotFound {
+		c.hasCheckpoint = false
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Could not read checkpoint of consumer %s: %s", c.name, err)
+	}
+	var checkpoint checkpointJSON
+	if err := json.Unmarshal(value, &checkpoint); err != nil {
+		return fmt.Errorf("Could not unmarshal checkpoint of consumer %s: %s", c.name, err)
+	}
+	c.checkpoint = checkpoint.BlockNumber
+	c.hasCheckpoint = true
+	return nil
+}
+
+// Start ...
+/**
+ * Start delivering the blocks following the checkpoint, from block 0 if there is
+ * none. The blocks missed while the consumer was stopped are replayed first, then
+ * the live blocks of the EventHub are delivered. A block is delivered again after
+ * a restart until it is acknowledged.
+ * @param {Context} ctx The context used to stop the delivery.
+ * @returns {chan Block} The channel the blocks are delivered on, in order. It is closed
+ * when the context is done or an error occurred, see Err.
+ */
+func (c *BlockConsumer) Start(ctx context.Context) (<-chan *common.Block, error) {
+	c.mtx.Lock()
+	err := c.loadCheckpoint()
+	next := c.checkpoint + 1
+	if !c.hasCheckpoint {
+		next = 0
+	}
+	c.err = nil
+	c.mtx.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	// subscribe before replaying, so that no block is lost in between
+	live, unsubscribe := c.eventHub.SubscribeBlocks(SubscriptionOptions{Overflow: OverflowError})
+	blocks := make(chan *common.Block)
+	go c.run(ctx, next, live, unsubscribe, blocks)
+	return blocks, nil
+}
+
+// Ack ...
+/**
+ * Acknowledge the processing of a block, and of the blocks before it. The
+ * checkpoint is saved in the store, the block won't be delivered again.
+ * @param {uint64} blockNumber The number of the processed block.
+ */
+func (c *BlockConsumer) Ack(blockNumber uint64) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.hasCheckpoint && blockNumber <= c.checkpoint {
+		return nil
+	}
+	value, err := json.Marshal(checkpointJSON{BlockNumber: blockNumber})
+	if err != nil {
+		return fmt.Errorf("Marshal json return error: %v", err)
+	}
+	if err := c.store.SetValue(checkpointKeyPrefix+c.name, value); err != nil {
+		return fmt.Errorf("Could not save checkpoint of consumer %s: %s", c.name, err)
+	}
+	c.checkpoint = blockNumber
+	c.hasCheckpoint = true
+	return nil
+}
+
+// Err ...
+/**
+ * Get the reason the block channel was closed.
+ * @returns {error} The error which stopped the delivery, the context error if it
+ * was stopped by the context, nil while the blocks are delivered.
+ */
+func (c *BlockConsumer) Err() error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.err
+}
+
+func (c *BlockConsumer) setErr(err error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.err = err
+}
+
+/**
+ * private internal delivery of the replayed then live blocks
+ * @param {uint64} next The number of the next block to deliver.
+ */
+func (c *BlockConsumer) run(ctx context.Context, next uint64, live <-chan *common.Block, unsubscribe Unsubscribe, blocks chan<- *common.Block) {
+	defer close(blocks)
+	defer func() { unsubscribe() }()
+
+	var err error
+	if next, err = c.replayBlocks(ctx, next, 0, blocks); err != nil {
+		c.setErr(err)
+		return
+	}
+	for {
+		select {
+		case block, ok := <-live:
+			if !ok {
+				reason := unsubscribe()
+				if reason != ErrSubscriptionOverflow {
+					c.setErr(reason)
+					return
+				}
+				// the consumer is too slow for the live blocks, the missed ones are replayed
+				logger.Warningf("Consumer %s missed live blocks, replaying from block %d\n", c.name, next)
+				live, unsubscribe = c.eventHub.SubscribeBlocks(SubscriptionOptions{Overflow: OverflowError})
+				continue
+			}
+			if block == nil || block.Header == nil || block.Header.Number < next {
+				continue
+			}
+			if block.Header.Number > next {
+				if next, err = c.replayBlocks(ctx, next, block.Header.Number, blocks); err != nil {
+					c.setErr(err)
+					return
+				}
+				if block.Header.Number < next {
+					continue
+				}
+			}
+			if err := c.deliver(ctx, block, blocks); err != nil {
+				c.setErr(err)
+				return
+			}
+			next = block.Header.Number + 1
+		case <-ctx.Done():
+			c.setErr(ctx.Err())
+			return
+		}
+	}
+}
+
+/**
+ * private internal replay of the blocks from next up to the newest one, or up to
+ * the block before until if it is not 0
+ * @returns {uint64} The number of the next block to deliver.
+ */
+func (c *BlockConsumer) replayBlocks(ctx context.Context, next uint64, until uint64, blocks chan<- *common.Block) (uint64, error) {
+	replayCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	replayed, errs := c.replay(replayCtx, next)
+	for block := range replayed {
+		if block == nil || block.Header == nil || block.Header.Number < next {
+			continue
+		}
+		if until > 0 && block.Header.Number >= until {
+			break
+		}
+		if block.Header.Number > next {
+			return next, fmt.Errorf("Replay returned block %d, expected block %d", block.Header.Number, next)
+		}
+		if err := c.deliver(ctx, block, blocks); err != nil {
+			return next, err
+		}
+		next++
+	}
+	cancel()
+	if err := <-errs; err != nil && ctx.Err() == nil && (until == 0 || next < until) {
+		return next, fmt.Errorf("Could not replay blocks from block %d: %s", next, err)
+	}
+	if until > 0 && next < until {
+		return next, fmt.Errorf("Could not replay blocks %d to %d", next, until-1)
+	}
+	return next, nil
+}
+
+/**
+ * private internal delivery of a block to the consumer
+ */
+func (c *BlockConsumer) deliver(ctx context.Context, block *common.Block, blocks chan<- *common.Block) error {
+	select {
+	case blocks <- block:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
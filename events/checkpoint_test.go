@@ -0,0 +1,224 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	kvs "github.com/hyperledger/fabric-sdk-go/keyvaluestore"
+	common "github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"golang.org/x/net/context"
+)
+
+// testLedger is a BlockReplay source of the blocks committed so far
+type testLedger struct {
+	sync.Mutex
+	blocks []*common.Block
+}
+
+func (l *testLedger) commit(eventHub *EventHub) *common.Block {
+	l.Lock()
+	block := &common.Block{Header: &common.BlockHeader{Number: uint64(len(l.blocks))}, Data: &common.BlockData{}}
+	l.blocks = append(l.blocks, block)
+	l.Unlock()
+	if eventHub != nil {
+		eventHub.Recv(&pb.Event{Event: &pb.Event_Block{Block: block}})
+	}
+	return block
+}
+
+func (l *testLedger) replay(ctx context.Context, start uint64) (<-chan *common.Block, <-chan error) {
+	l.Lock()
+	committed := l.blocks
+	l.Unlock()
+	blocks := make(chan *common.Block)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		defer close(blocks)
+		for n := start; n < uint64(len(committed)); n++ {
+			select {
+			case blocks <- committed[n]:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return blocks, errs
+}
+
+func TestBlockConsumerCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatalf("TempDir return error[%s]", err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := kvs.CreateNewFileKeyValueStore(dir)
+	if err != nil {
+		t.Fatalf("CreateNewFileKeyValueStore return error[%s]", err)
+	}
+	eventHub := NewEventHub()
+	ledger := &testLedger{}
+	for i := 0; i < 3; i++ {
+		ledger.commit(nil)
+	}
+
+	consumer, err := NewBlockConsumer("indexer", eventHub, store, ledger.replay)
+	if err != nil {
+		t.Fatalf("NewBlockConsumer return error[%s]", err)
+	}
+	if _, ok, err := consumer.GetCheckpoint(); err != nil || ok {
+		t.Fatalf("GetCheckpoint returned %t, %v before any Ack", ok, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	blocks, err := consumer.Start(ctx)
+	if err != nil {
+		t.Fatalf("Start return error[%s]", err)
+	}
+	// the ledger is replayed from block 0, then the live blocks follow
+	expectBlocks(t, blocks, 0, 1, 2)
+	if err := consumer.Ack(1); err != nil {
+		t.Fatalf("Ack return error[%s]", err)
+	}
+	ledger.commit(eventHub)
+	expectBlocks(t, blocks, 3)
+	cancel()
+	if _, ok := <-blocks; ok {
+		t.Fatalf("Block channel is not closed when the context is done")
+	}
+	if consumer.Err() != context.Canceled {
+		t.Fatalf("Err returned %v, expected %v", consumer.Err(), context.Canceled)
+	}
+
+	// after a restart, the blocks after the checkpoint are delivered again
+	consumer, err = NewBlockConsumer("indexer", eventHub, store, ledger.replay)
+	if err != nil {
+		t.Fatalf("NewBlockConsumer return error[%s]", err)
+	}
+	if checkpoint, ok, err := consumer.GetCheckpoint(); err != nil || !ok || checkpoint != 1 {
+		t.Fatalf("GetCheckpoint returned %d, %t, %v, expected 1", checkpoint, ok, err)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	blocks, err = consumer.Start(ctx)
+	if err != nil {
+		t.Fatalf("Start return error[%s]", err)
+	}
+	expectBlocks(t, blocks, 2, 3)
+	// block 4 is missed by the event hub, it is replayed before block 5
+	ledger.commit(nil)
+	ledger.commit(eventHub)
+	expectBlocks(t, blocks, 4, 5)
+}
+
+// memoryStore is a KeyValueStore keeping the values in memory
+type memoryStore struct {
+	mtx    sync.Mutex
+	values map[string][]byte
+}
+
+func (m *memoryStore) GetValue(key string) ([]byte, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	value, ok := m.values[key]
+	if !ok {
+		return nil, kvs.ErrNotFound
+	}
+	return value, nil
+}
+
+func (m *memoryStore) SetValue(key string, value []byte) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.values[key] = value
+	return nil
+}
+
+func TestBlockConsumerStore(t *testing.T) {
+	store := &memoryStore{values: make(map[string][]byte)}
+	consumer, err := NewBlockConsumer("indexer", NewEventHub(), store, (&testLedger{}).replay)
+	if err != nil {
+		t.Fatalf("NewBlockConsumer return error[%s]", err)
+	}
+	// any store reporting ErrNotFound can start a consumer without checkpoint
+	if _, ok, err := consumer.GetCheckpoint(); err != nil || ok {
+		t.Fatalf("GetCheckpoint returned %t, %v without checkpoint", ok, err)
+	}
+	if err := consumer.Ack(4); err != nil {
+		t.Fatalf("Ack return error[%s]", err)
+	}
+	if checkpoint, ok, err := consumer.GetCheckpoint(); err != nil || !ok || checkpoint != 4 {
+		t.Fatalf("GetCheckpoint returned %d, %t, %v, expected 4", checkpoint, ok, err)
+	}
+}
+
+func TestBlockConsumerDisconnect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatalf("TempDir return error[%s]", err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := kvs.CreateNewFileKeyValueStore(dir)
+	if err != nil {
+		t.Fatalf("CreateNewFileKeyValueStore return error[%s]", err)
+	}
+	eventHub := NewEventHub()
+	consumer, err := NewBlockConsumer("indexer", eventHub, store, (&testLedger{}).replay)
+	if err != nil {
+		t.Fatalf("NewBlockConsumer return error[%s]", err)
+	}
+	blocks, err := consumer.Start(context.Background())
+	if err != nil {
+		t.Fatalf("Start return error[%s]", err)
+	}
+	eventHub.Disconnect()
+	select {
+	case _, ok := <-blocks:
+		if ok {
+			t.Fatalf("Unexpected block")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Block channel is not closed on disconnection")
+	}
+	if consumer.Err() != ErrEventHubDisconnected {
+		t.Fatalf("Err returned %v, expected %v", consumer.Err(), ErrEventHubDisconnected)
+	}
+}
+
+func expectBlocks(t *testing.T, blocks <-chan *common.Block, expected ...uint64) {
+	for _, number := range expected {
+		select {
+		case block, ok := <-blocks:
+			if !ok {
+				t.Fatalf("Block channel closed waiting for block %d", number)
+			}
+			if block.Header.Number != number {
+				t.Fatalf("Received block %d, expected %d", block.Header.Number, number)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout waiting for block %d", number)
+		}
+	}
+}
@@ -41,6 +41,7 @@ type EventsClient struct {
 	regTimeout  time.Duration
 	stream      ehpb.Events_ChatClient
 	adapter     consumer.EventAdapter
+	conn        *grpc.ClientConn
 }
 
 //NewEventsClient Returns a new grpc.ClientConn to the configured local PEER.
@@ -53,7 +54,7 @@ func NewEventsClient(peerAddress string, regTimeout time.Duration, adapter consu
 		regTimeout = 60 * time.Second
 		err = fmt.Errorf("regTimeout > 60, setting to 60 sec")
 	}
-	return &EventsClient{sync.RWMutex{}, peerAddress, regTimeout, nil, adapter}, err
+	return &EventsClient{sync.RWMutex{}, peerAddress, regTimeout, nil, adapter, nil}, err
 }
 
 //newEventsClientConnectionWithAddress Returns a new grpc.ClientConn to the configured local PEER.
@@ -214,14 +215,14 @@ func (ec *EventsClient) Start() error {
 		return fmt.Errorf("Could not create client conn to %s", ec.peerAddress)
 	}
 
+	ec.conn = conn
+
 	ies, err := ec.adapter.GetInterestedEvents()
 	if err != nil {
 		return fmt.Errorf("error getting interested events:%s", err)
 	}
 
-	if len(ies) == 0 {
-		return fmt.Errorf("must supply interested events")
-	}
+	// the interests may be empty, they can be registered later with RegisterAsync
 
 	serverClient := ehpb.NewEventsClient(conn)
 	ec.stream, err = serverClient.Chat(context.Background())
@@ -240,6 +241,10 @@ func (ec *EventsClient) Start() error {
 
 //Stop terminates connection with event hub
 func (ec *EventsClient) Stop() error {
+	if ec.conn != nil {
+		// release the connection once the stream is closed
+		defer ec.conn.Close()
+	}
 	if ec.stream == nil {
 		// in case the stream/chat server has not been established earlier, we assume that it's closed, successfully
 		return nil
@@ -21,6 +21,8 @@ package events
 
 import (
 	"fmt"
+	"regexp"
+	"sync"
 
 	consumer "github.com/hyperledger/fabric-sdk-go/events/consumer"
 	common "github.com/hyperledger/fabric/protos/common"
@@ -31,20 +33,55 @@ import (
 
 var logger = logging.MustGetLogger("fabric_sdk_go")
 
+// maxDispatchedChaincodeEvents is the number of chaincode events remembered to avoid delivering
+// an event twice when it is received both on its own and within a block
+const maxDispatchedChaincodeEvents = 1000
+
 // EventHub ...
+/**
+ * The EventHub can be used from any goroutine. Callbacks are invoked on the
+ * goroutine receiving the events, without any lock held, so a callback may
+ * register or unregister callbacks, including itself.
+ */
 type EventHub struct {
+	// protects the registrations and the connection state
+	mtx sync.RWMutex
 	// Map of clients registered for chaincode events
 	chaincodeRegistrants map[string][]*ChainCodeCBE
 	// Map of clients registered for block events
 	blockRegistrants []func(*common.Block, string, string)
+	// block event registrations which can be unregistered
+	blockCallbacks []*BlockCBE
 	// Map of clients registered for transactional events
-	txRegistrants map[string]func(string, error)
+	txRegistrants map[string]func(TxEvent)
+	// transaction ids keyed by proposal nonce, used to match rejections
+	txNonces map[string]string
 	// peer addr to connect to
 	peerAddr string
 	// grpc event client interface
 	client *consumer.EventsClient
 	// fabric connection state of this eventhub
 	connected bool
+	// recently dispatched chaincode events, in order of dispatch
+	dispatchedChaincodeEvents map[string]bool
+	dispatchedOrder           []string
+	// reconnection settings, and the channel closed by Disconnect to stop reconnecting
+	reconnectConfig ReconnectConfig
+	stopReconnect   chan struct{}
+	// source of the blocks missed while disconnected
+	blockSource func(uint64) (*common.Block, error)
+	// number of the last delivered block
+	lastBlock    uint64
+	hasLastBlock bool
+	// serializes the delivery of blocks
+	dispatchMtx sync.Mutex
+	// interests registered on the event stream
+	streamInterests map[string]*pb.Interest
+	// serializes the updates of the interests registered on the event stream
+	interestsMtx sync.Mutex
+	// open channel subscriptions, and those receiving blocks
+	subscriptions      map[*subscription]bool
+	blockSubscriptions []*subscription
 }
 
 // ChainCodeCBE ...
@@ -59,15 +96,30 @@ type ChainCodeCBE struct {
 	EventNameFilter string
 	// callback function to invoke on successful filter match
 	CallbackFunc func(*pb.ChaincodeEvent)
+	// compiled event name filter
+	eventNameRegexp *regexp.Regexp
+}
+
+// BlockCBE ...
+/**
+ * The BlockCBE is used internal to the EventHub to hold block
+ * event registration callbacks.
+ */
+type BlockCBE struct {
+	// callback function to invoke for each block
+	CallbackFunc func(*common.Block)
 }
 
 // NewEventHub ...
 func NewEventHub() *EventHub {
 	chaincodeRegistrants := make(map[string][]*ChainCodeCBE)
 	blockRegistrants := make([]func(*common.Block, string, string), 0)
-	txRegistrants := make(map[string]func(string, error))
+	txRegistrants := make(map[string]func(TxEvent))
 
-	eventHub := &EventHub{chaincodeRegistrants: chaincodeRegistrants, blockRegistrants: blockRegistrants, txRegistrants: txRegistrants}
+	eventHub := &EventHub{chaincodeRegistrants: chaincodeRegistrants, blockRegistrants: blockRegistrants, txRegistrants: txRegistrants,
+		txNonces: make(map[string]string), dispatchedChaincodeEvents: make(map[string]bool), reconnectConfig: DefaultReconnectConfig(),
+		subscriptions: make(map[*subscription]bool)}
+	eventHub.blockRegistrants = append(eventHub.blockRegistrants, eventHub.txCallback)
 
 	return eventHub
 }
@@ -81,6 +133,8 @@ func NewEventHub() *EventHub {
  * @param {string} peeraddr peer url
  */
 func (eventHub *EventHub) SetPeerAddr(peerURL string) {
+	eventHub.mtx.Lock()
+	defer eventHub.mtx.Unlock()
 	eventHub.peerAddr = peerURL
 }
 
@@ -90,34 +144,77 @@ func (eventHub *EventHub) SetPeerAddr(peerURL string) {
  * @returns true if connected to event source, false otherwise
  */
 func (eventHub *EventHub) Isconnected() bool {
+	eventHub.mtx.RLock()
+	defer eventHub.mtx.RUnlock()
 	return eventHub.connected
 }
 
 // Connect ...
 /**
  * Establishes connection with peer event source<p>
+ * When the connection drops, the EventHub reconnects according to its
+ * ReconnectConfig until Disconnect is called.
  */
 func (eventHub *EventHub) Connect() error {
-	if eventHub.peerAddr == "" {
+	stop := make(chan struct{})
+	eventHub.mtx.Lock()
+	eventHub.stopReconnect = stop
+	eventHub.mtx.Unlock()
+	return eventHub.connect(stop)
+}
+
+/**
+ * private internal connection to the peer event source
+ * @param {chan} stop closed by Disconnect, the new connection is dropped if it is closed
+ */
+func (eventHub *EventHub) connect(stop chan struct{}) error {
+	eventHub.mtx.RLock()
+	peerAddr := eventHub.peerAddr
+	eventHub.mtx.RUnlock()
+	if peerAddr == "" {
 		return fmt.Errorf("eventHub.peerAddr is empty")
 	}
-	eventHub.blockRegistrants = make([]func(*common.Block, string, string), 0)
-	eventHub.blockRegistrants = append(eventHub.blockRegistrants, eventHub.txCallback)
 
-	eventsClient, _ := consumer.NewEventsClient(eventHub.peerAddr, 5, eventHub)
+	// the lock is not held while starting, since the events client asks for
+	// the interested events and may deliver events before Start returns
+	adapter := &connectionAdapter{EventHub: eventHub}
+	eventsClient, _ := consumer.NewEventsClient(peerAddr, 5, adapter)
+	adapter.client = eventsClient
 	if err := eventsClient.Start(); err != nil {
 		eventsClient.Stop()
 		return fmt.Errorf("Error from eventsClient.Start (%s)", err.Error())
 
+	}
+	eventHub.mtx.Lock()
+	select {
+	case <-stop:
+		// Disconnect was called meanwhile
+		eventHub.mtx.Unlock()
+		eventsClient.Stop()
+		return fmt.Errorf("eventHub was disconnected")
+	default:
 	}
 	eventHub.connected = true
 	eventHub.client = eventsClient
+	eventHub.mtx.Unlock()
+	// listeners may have come or gone while starting
+	eventHub.updateInterests()
 	return nil
 }
 
 //GetInterestedEvents implements consumer.EventAdapter interface for registering interested events
+// Only the events someone listens to are asked for, the interests are then updated
+// on the live stream as listeners come and go.
 func (eventHub *EventHub) GetInterestedEvents() ([]*pb.Interest, error) {
-	return []*pb.Interest{{EventType: pb.EventType_BLOCK}, {EventType: pb.EventType_REJECTION}}, nil
+	eventHub.mtx.Lock()
+	defer eventHub.mtx.Unlock()
+	interests := eventHub.interestsLocked()
+	eventHub.streamInterests = interests
+	sorted := make([]*pb.Interest, 0, len(interests))
+	for _, key := range sortedInterestKeys(interests) {
+		sorted = append(sorted, interests[key])
+	}
+	return sorted, nil
 }
 
 //Recv implements consumer.EventAdapter interface for receiving events
@@ -126,15 +223,20 @@ func (eventHub *EventHub) Recv(msg *pb.Event) (bool, error) {
 	case *pb.Event_Block:
 		blockEvent := msg.Event.(*pb.Event_Block)
 		logger.Debugf("Recv blockEvent:%v\n", blockEvent)
-		for _, v := range eventHub.blockRegistrants {
-			v(blockEvent.Block, "", "")
+		eventHub.receiveBlock(blockEvent.Block)
+		return true, nil
+	case *pb.Event_ChaincodeEvent:
+		ccEvent := msg.Event.(*pb.Event_ChaincodeEvent)
+		logger.Debugf("Recv ccEvent:%v\n", ccEvent)
+		if ccEvent.ChaincodeEvent != nil {
+			eventHub.dispatchChaincodeEvent(ccEvent.ChaincodeEvent)
 		}
 		return true, nil
 	case *pb.Event_Rejection:
 		rejectionEvent := msg.Event.(*pb.Event_Rejection)
 		logger.Debugf("Recv rejectionEvent:%v\n", rejectionEvent)
-		for _, v := range eventHub.blockRegistrants {
-			v(nil, "", rejectionEvent.Rejection.ErrorMsg)
+		if rejectionEvent.Rejection != nil {
+			eventHub.rejectionCallback(rejectionEvent.Rejection)
 		}
 		return true, nil
 	default:
@@ -142,47 +244,120 @@ func (eventHub *EventHub) Recv(msg *pb.Event) (bool, error) {
 	}
 }
 
-// Disconnected ...
+// Disconnected implements consumer.EventAdapter interface for the loss of the event stream.
+// The EventHub reconnects unless reconnection is disabled or Disconnect was called.
+func (eventHub *EventHub) Disconnected(err error) {
+	eventHub.mtx.RLock()
+	client := eventHub.client
+	eventHub.mtx.RUnlock()
+	eventHub.disconnected(client, err)
+}
+
 /**
- * Disconnects peer event source<p>
+ * private internal handling of the loss of the stream of the given client
+ * @param {object} client the events client which lost its stream
+ * @param {error} err the stream error, nil at the end of the stream
+ */
+func (eventHub *EventHub) disconnected(client *consumer.EventsClient, err error) {
+	eventHub.mtx.Lock()
+	if !eventHub.connected || eventHub.client != client {
+		// already disconnected, or a replaced connection
+		eventHub.mtx.Unlock()
+		return
+	}
+	eventHub.connected = false
+	stop := eventHub.stopReconnect
+	disabled := eventHub.reconnectConfig.Disabled
+	eventHub.mtx.Unlock()
+
+	logger.Warningf("Event source disconnected: %v\n", err)
+	client.Stop()
+	if !disabled && stop != nil {
+		go eventHub.reconnect(stop)
+	} else {
+		eventHub.closeSubscriptions(ErrEventHubDisconnected)
+	}
+}
+
+// Disconnect ...
+/**
+ * Disconnects peer event source and ends the channel subscriptions<p>
  * Note: Only use this if creating your own EventHub. The chain
  * class creates a default eventHub that most Node clients can
  * use (see eventHubConnect, eventHubDisconnect and getEventHub).
  */
-func (eventHub *EventHub) Disconnected(err error) {
-	if !eventHub.connected {
-		return
+func (eventHub *EventHub) Disconnect() {
+	eventHub.mtx.Lock()
+	if eventHub.stopReconnect != nil {
+		close(eventHub.stopReconnect)
+		eventHub.stopReconnect = nil
 	}
-	eventHub.client.Stop()
+	client := eventHub.client
+	connected := eventHub.connected
 	eventHub.connected = false
+	eventHub.mtx.Unlock()
+
+	if connected {
+		client.Stop()
+	}
+	eventHub.closeSubscriptions(ErrEventHubDisconnected)
+}
 
+/**
+ * private internal delivery of a block to the block and chaincode event listeners
+ * @param {object} block the block from the fabric
+ */
+func (eventHub *EventHub) dispatchBlock(block *common.Block) {
+	eventHub.mtx.RLock()
+	blockRegistrants := eventHub.blockRegistrants
+	blockCallbacks := eventHub.blockCallbacks
+	eventHub.mtx.RUnlock()
+	for _, v := range blockRegistrants {
+		v(block, "", "")
+	}
+	for _, v := range blockCallbacks {
+		v.CallbackFunc(block)
+	}
+	eventHub.dispatchBlockChaincodeEvents(block)
+	eventHub.deliverBlock(block)
+
+	if block != nil && block.Header != nil {
+		eventHub.mtx.Lock()
+		// the gaps are only tracked while someone receives the blocks
+		if eventHub.blockListenersLocked() > 0 {
+			eventHub.lastBlock = block.Header.Number
+			eventHub.hasLastBlock = true
+		}
+		eventHub.mtx.Unlock()
+	}
 }
 
 // RegisterChaincodeEvent ...
 /**
  * Register a callback function to receive chaincode events.
+ * Registrations made before Connect are sent to the peer as chaincode interests.
  * @param {string} ccid string chaincode id
- * @param {string} eventname string The regex string used to filter events
+ * @param {string} eventname string The regex string used to filter events,
+ * it matches any part of the event name unless anchored with ^ and $
  * @param {function} callback Function Callback function for filter matches
  * that takes a single parameter which is a json object representation
  * of type "message ChaincodeEvent"
  * @returns {object} ChainCodeCBE object that should be treated as an opaque
- * handle used to unregister (see unregisterChaincodeEvent)
+ * handle used to unregister (see unregisterChaincodeEvent), nil if eventname
+ * is not a valid regex
  */
 func (eventHub *EventHub) RegisterChaincodeEvent(ccid string, eventname string, callback func(*pb.ChaincodeEvent)) *ChainCodeCBE {
-	if !eventHub.connected {
+	eventNameRegexp, err := regexp.Compile(eventname)
+	if err != nil {
+		logger.Errorf("Invalid event name filter %s: %s\n", eventname, err)
 		return nil
 	}
-	cbe := ChainCodeCBE{CCID: ccid, EventNameFilter: eventname, CallbackFunc: callback}
-	cbeArray := eventHub.chaincodeRegistrants[ccid]
-	if cbeArray == nil && len(cbeArray) <= 0 {
-		cbeArray = make([]*ChainCodeCBE, 0)
-		cbeArray = append(cbeArray, &cbe)
-		eventHub.chaincodeRegistrants[ccid] = cbeArray
-	} else {
-		cbeArray = append(cbeArray, &cbe)
-		eventHub.chaincodeRegistrants[ccid] = cbeArray
-	}
+	cbe := ChainCodeCBE{CCID: ccid, EventNameFilter: eventname, CallbackFunc: callback, eventNameRegexp: eventNameRegexp}
+
+	eventHub.mtx.Lock()
+	eventHub.chaincodeRegistrants[ccid] = append(eventHub.chaincodeRegistrants[ccid], &cbe)
+	eventHub.mtx.Unlock()
+	eventHub.updateInterests()
 	return &cbe
 }
 
@@ -193,25 +368,68 @@ func (eventHub *EventHub) RegisterChaincodeEvent(ccid string, eventname string,
  * registerChaincodeEvent.
  */
 func (eventHub *EventHub) UnregisterChaincodeEvent(cbe *ChainCodeCBE) {
-	if !eventHub.connected {
+	if cbe == nil {
 		return
 	}
+	eventHub.mtx.Lock()
 	cbeArray := eventHub.chaincodeRegistrants[cbe.CCID]
 	if len(cbeArray) <= 0 {
+		eventHub.mtx.Unlock()
 		logger.Debugf("No event registration for ccid %s \n", cbe.CCID)
 		return
 	}
-	for i, v := range cbeArray {
-		if v.EventNameFilter == cbe.EventNameFilter {
-
-			cbeArray = append(cbeArray[:i], cbeArray[i+1:]...)
-
+	// build a new slice, the current one may be in use by a dispatch
+	remaining := make([]*ChainCodeCBE, 0, len(cbeArray))
+	for _, v := range cbeArray {
+		if v != cbe {
+			remaining = append(remaining, v)
 		}
 	}
+	cbeArray = remaining
 	if len(cbeArray) <= 0 {
 		delete(eventHub.chaincodeRegistrants, cbe.CCID)
+	} else {
+		eventHub.chaincodeRegistrants[cbe.CCID] = cbeArray
 	}
+	eventHub.mtx.Unlock()
+	eventHub.updateInterests()
+}
 
+// RegisterBlockEvent ...
+/**
+ * Register a callback function to receive the blocks.
+ * @param {function} callback Function called with each block received from the event source
+ * @returns {object} BlockCBE object that should be treated as an opaque
+ * handle used to unregister (see UnregisterBlockEvent)
+ */
+func (eventHub *EventHub) RegisterBlockEvent(callback func(*common.Block)) *BlockCBE {
+	cbe := BlockCBE{CallbackFunc: callback}
+
+	eventHub.mtx.Lock()
+	eventHub.blockCallbacks = append(eventHub.blockCallbacks, &cbe)
+	eventHub.mtx.Unlock()
+	eventHub.updateInterests()
+	return &cbe
+}
+
+// UnregisterBlockEvent ...
+/**
+ * Unregister block event registration
+ * @param {object} BlockCBE handle returned from call to
+ * RegisterBlockEvent.
+ */
+func (eventHub *EventHub) UnregisterBlockEvent(cbe *BlockCBE) {
+	eventHub.mtx.Lock()
+	// build a new slice, the current one may be in use by a dispatch
+	remaining := make([]*BlockCBE, 0, len(eventHub.blockCallbacks))
+	for _, v := range eventHub.blockCallbacks {
+		if v != cbe {
+			remaining = append(remaining, v)
+		}
+	}
+	eventHub.blockCallbacks = remaining
+	eventHub.mtx.Unlock()
+	eventHub.updateInterests()
 }
 
 // RegisterTxEvent ...
@@ -221,12 +439,60 @@ func (eventHub *EventHub) UnregisterChaincodeEvent(cbe *ChainCodeCBE) {
  * the sdk to track deploy and invoke completion events. Nodejs
  * clients generally should not need to call directly.
  * @param {string} txid string transaction id
- * @param {function} callback Function that takes a single parameter which
- * is a json object representation of type "message Transaction"
+ * @param {function} callback Function that takes the transaction id and
+ * a nil error once the transaction is committed as valid, or a *TxValidationError
+ * if the committing peer invalidated it
  */
 func (eventHub *EventHub) RegisterTxEvent(txID string, callback func(string, error)) {
 	logger.Debugf("reg txid %s\n", txID)
+	eventHub.registerTxEvent(txID, "", func(txEvent TxEvent) { callback(txEvent.TxID, txEvent.Err) })
+}
+
+// RegisterProposalTxEvent ...
+/**
+ * Register a callback function to receive the transactional events of the
+ * transaction created from a proposal. Unlike RegisterTxEvent, rejections of the
+ * transaction, which don't carry its id, are also reported to the callback.
+ * @param {Proposal} proposal The proposal the transaction is created from.
+ * @param {function} callback Function called like for RegisterTxEvent.
+ * @returns {string} The transaction id, to be used with UnregisterTxEvent.
+ */
+func (eventHub *EventHub) RegisterProposalTxEvent(proposal *pb.Proposal, callback func(string, error)) (string, error) {
+	txID, nonce, err := proposalTxID(proposal)
+	if err != nil {
+		return "", err
+	}
+	eventHub.registerTxEvent(txID, nonce, func(txEvent TxEvent) { callback(txEvent.TxID, txEvent.Err) })
+	return txID, nil
+}
+
+/**
+ * private internal registration of the status callback of a transaction
+ * @param {string} nonce The nonce of the proposal, used to match rejections, may be empty.
+ */
+func (eventHub *EventHub) registerTxEvent(txID string, nonce string, callback func(TxEvent)) {
+	eventHub.mtx.Lock()
 	eventHub.txRegistrants[txID] = callback
+	if nonce != "" {
+		eventHub.txNonces[nonce] = txID
+	}
+	eventHub.mtx.Unlock()
+	eventHub.updateInterests()
+}
+
+// proposalTxID returns the transaction id and the nonce of a proposal
+func proposalTxID(proposal *pb.Proposal) (string, string, error) {
+	if proposal == nil {
+		return "", "", fmt.Errorf("proposal is nil")
+	}
+	hdr, err := utils.GetHeader(proposal.Header)
+	if err != nil {
+		return "", "", fmt.Errorf("Could not unmarshal the proposal header: %s", err)
+	}
+	if hdr.ChainHeader == nil || hdr.SignatureHeader == nil {
+		return "", "", fmt.Errorf("proposal header is incomplete")
+	}
+	return hdr.ChainHeader.TxID, string(hdr.SignatureHeader.Nonce), nil
 }
 
 // UnregisterTxEvent ...
@@ -235,7 +501,15 @@ func (eventHub *EventHub) RegisterTxEvent(txID string, callback func(string, err
  * @param txid string transaction id
  */
 func (eventHub *EventHub) UnregisterTxEvent(txID string) {
+	eventHub.mtx.Lock()
 	delete(eventHub.txRegistrants, txID)
+	for nonce, id := range eventHub.txNonces {
+		if id == txID {
+			delete(eventHub.txNonces, nonce)
+		}
+	}
+	eventHub.mtx.Unlock()
+	eventHub.updateInterests()
 }
 
 /**
@@ -245,23 +519,203 @@ func (eventHub *EventHub) UnregisterTxEvent(txID string) {
  */
 func (eventHub *EventHub) txCallback(block *common.Block, txID string, errMsg string) {
 	logger.Debugf("txCallback block=%v\n", block)
+	if block == nil || block.Data == nil {
+		return
+	}
 
-	for _, v := range block.Data.Data {
-		if env, err := utils.GetEnvelopeFromBlock(v); err != nil {
-			return
-		} else if env != nil {
-			// get the payload from the envelope
-			payload, err := utils.GetPayload(env)
-			if err != nil {
-				return
-			}
+	codes, err := GetTxValidationCodes(block)
+	if err != nil {
+		logger.Errorf("Could not get the transaction validation codes: %s\n", err)
+		return
+	}
+	var blockNumber uint64
+	if block.Header != nil {
+		blockNumber = block.Header.Number
+	}
 
-			callback := eventHub.txRegistrants[payload.Header.ChainHeader.TxID]
-			if callback != nil {
-				callback(payload.Header.ChainHeader.TxID, nil)
+	for i, v := range block.Data.Data {
+		env, err := utils.GetEnvelopeFromBlock(v)
+		if err != nil {
+			continue
+		}
+		// get the payload from the envelope
+		payload, err := utils.GetPayload(env)
+		if err != nil || payload.Header == nil || payload.Header.ChainHeader == nil {
+			continue
+		}
+
+		txID := payload.Header.ChainHeader.TxID
+		eventHub.mtx.RLock()
+		callback := eventHub.txRegistrants[txID]
+		eventHub.mtx.RUnlock()
+		if callback == nil {
+			continue
+		}
+		txEvent := TxEvent{TxID: txID, BlockNumber: blockNumber, ValidationCode: codes[i]}
+		if codes[i] != TxValidationCode_VALID {
+			txEvent.Err = &TxValidationError{Code: codes[i], TxID: txID, BlockNumber: blockNumber}
+		}
+		callback(txEvent)
+	}
+}
+
+/**
+ * private internal callback for processing rejection events
+ * @param {object} rejection the rejected transaction and the reason of the rejection
+ */
+func (eventHub *EventHub) rejectionCallback(rejection *pb.Rejection) {
+	eventHub.mtx.RLock()
+	txID := eventHub.rejectedTxID(rejection.Tx)
+	callback := eventHub.txRegistrants[txID]
+	eventHub.mtx.RUnlock()
+	if txID == "" {
+		logger.Warningf("Could not match rejection to a transaction: %s\n", rejection.ErrorMsg)
+		return
+	}
+	if callback != nil {
+		callback(TxEvent{TxID: txID, ValidationCode: TxValidationCode_INVALID_OTHER_REASON,
+			Err: &TxValidationError{Code: TxValidationCode_INVALID_OTHER_REASON, TxID: txID, Message: rejection.ErrorMsg}})
+	}
+}
+
+// rejectedTxID finds the id of a rejected transaction, from the nonce of a proposal registered
+// with RegisterProposalTxEvent or from the chaincode event set by the transaction.
+// The caller must hold the lock.
+func (eventHub *EventHub) rejectedTxID(tx *pb.Transaction) string {
+	if tx == nil {
+		return ""
+	}
+	for _, action := range tx.Actions {
+		if sigHdr, err := utils.GetSignatureHeader(action.Header); err == nil {
+			if txID, ok := eventHub.txNonces[string(sigHdr.Nonce)]; ok {
+				return txID
 			}
 		}
+		if ccEvent, err := getActionChaincodeEvent(action); err == nil && ccEvent != nil && ccEvent.TxID != "" {
+			return ccEvent.TxID
+		}
+	}
+	return ""
+}
 
+/**
+ * private internal dispatch of the chaincode events of the valid transactions of a block
+ * @param {object} block the block from the fabric
+ */
+func (eventHub *EventHub) dispatchBlockChaincodeEvents(block *common.Block) {
+	eventHub.mtx.RLock()
+	registrants := len(eventHub.chaincodeRegistrants)
+	eventHub.mtx.RUnlock()
+	if registrants == 0 || block == nil || block.Data == nil {
+		return
 	}
+	codes, err := GetTxValidationCodes(block)
+	if err != nil {
+		logger.Errorf("Could not get the transaction validation codes: %s\n", err)
+		return
+	}
+	for i, v := range block.Data.Data {
+		// invalid transactions have no effect, their events are not delivered
+		if codes[i] != TxValidationCode_VALID {
+			continue
+		}
+		ccEvent, err := getChaincodeEvent(v)
+		if err != nil {
+			logger.Warningf("Could not extract chaincode event from block: %s\n", err)
+			continue
+		}
+		if ccEvent != nil {
+			eventHub.dispatchChaincodeEvent(ccEvent)
+		}
+	}
+}
+
+/**
+ * private internal dispatch of a chaincode event to the registrations matching its
+ * chaincode id and event name. An event already dispatched is ignored.
+ * @param {object} ccEvent the chaincode event
+ */
+func (eventHub *EventHub) dispatchChaincodeEvent(ccEvent *pb.ChaincodeEvent) {
+	key := ccEvent.TxID + "/" + ccEvent.ChaincodeID + "/" + ccEvent.EventName
+	eventHub.mtx.Lock()
+	if ccEvent.TxID != "" {
+		if eventHub.dispatchedChaincodeEvents[key] {
+			eventHub.mtx.Unlock()
+			return
+		}
+		eventHub.dispatchedChaincodeEvents[key] = true
+		eventHub.dispatchedOrder = append(eventHub.dispatchedOrder, key)
+		if len(eventHub.dispatchedOrder) > maxDispatchedChaincodeEvents {
+			delete(eventHub.dispatchedChaincodeEvents, eventHub.dispatchedOrder[0])
+			eventHub.dispatchedOrder = eventHub.dispatchedOrder[1:]
+		}
+	}
+
+	cbeArray := eventHub.chaincodeRegistrants[ccEvent.ChaincodeID]
+	eventHub.mtx.Unlock()
+
+	for _, cbe := range cbeArray {
+		if cbe.eventNameRegexp.MatchString(ccEvent.EventName) {
+			cbe.CallbackFunc(ccEvent)
+		}
+	}
+}
 
+// getChaincodeEvent returns the chaincode event set by the transaction held in the
+// block data, nil if the data is not an endorser transaction or sets no event
+func getChaincodeEvent(data []byte) (*pb.ChaincodeEvent, error) {
+	env, err := utils.GetEnvelopeFromBlock(data)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := utils.GetPayload(env)
+	if err != nil {
+		return nil, err
+	}
+	if payload.Header == nil || payload.Header.ChainHeader == nil ||
+		common.HeaderType(payload.Header.ChainHeader.Type) != common.HeaderType_ENDORSER_TRANSACTION {
+		return nil, nil
+	}
+	tx, err := utils.GetTransaction(payload.Data)
+	if err != nil {
+		return nil, err
+	}
+	for _, action := range tx.Actions {
+		ccEvent, err := getActionChaincodeEvent(action)
+		if err != nil {
+			return nil, err
+		}
+		if ccEvent == nil {
+			continue
+		}
+		// the event is bound to the transaction of the block
+		if ccEvent.TxID == "" {
+			ccEvent.TxID = payload.Header.ChainHeader.TxID
+		}
+		return ccEvent, nil
+	}
+	return nil, nil
+}
+
+// getActionChaincodeEvent returns the chaincode event set by a transaction action, nil if there is none
+func getActionChaincodeEvent(action *pb.TransactionAction) (*pb.ChaincodeEvent, error) {
+	cap, err := utils.GetChaincodeActionPayload(action.Payload)
+	if err != nil {
+		return nil, err
+	}
+	if cap.Action == nil {
+		return nil, nil
+	}
+	prp, err := utils.GetProposalResponsePayload(cap.Action.ProposalResponsePayload)
+	if err != nil {
+		return nil, err
+	}
+	chaincodeAction, err := utils.GetChaincodeAction(prp.Extension)
+	if err != nil {
+		return nil, err
+	}
+	if len(chaincodeAction.Events) == 0 {
+		return nil, nil
+	}
+	return utils.GetChaincodeEvents(chaincodeAction.Events)
 }
@@ -0,0 +1,195 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	common "github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func TestChaincodeEventDispatch(t *testing.T) {
+	eventHub := NewEventHub()
+	var received []string
+	eventHub.RegisterChaincodeEvent("mycc", "^transfer", func(ccEvent *pb.ChaincodeEvent) {
+		received = append(received, "transfer:"+ccEvent.EventName)
+	})
+	all := eventHub.RegisterChaincodeEvent("mycc", ".*", func(ccEvent *pb.ChaincodeEvent) {
+		received = append(received, "all:"+ccEvent.EventName)
+	})
+	eventHub.RegisterChaincodeEvent("othercc", ".*", func(ccEvent *pb.ChaincodeEvent) {
+		received = append(received, "other:"+ccEvent.EventName)
+	})
+	if eventHub.RegisterChaincodeEvent("mycc", "(", nil) != nil {
+		t.Fatalf("RegisterChaincodeEvent accepted an invalid regex")
+	}
+
+	eventHub.Recv(&pb.Event{Event: &pb.Event_ChaincodeEvent{ChaincodeEvent: &pb.ChaincodeEvent{ChaincodeID: "mycc", TxID: "tx1", EventName: "transferDone"}}})
+	expected := []string{"transfer:transferDone", "all:transferDone"}
+	if !reflect.DeepEqual(received, expected) {
+		t.Fatalf("Received %v, expected %v", received, expected)
+	}
+
+	// the event of tx1 is in the block too and is not delivered again
+	received = nil
+	block := &common.Block{Header: &common.BlockHeader{Number: 1}, Data: &common.BlockData{Data: [][]byte{
+		testTransaction(t, "tx1", &pb.ChaincodeEvent{ChaincodeID: "mycc", EventName: "transferDone"}),
+		testTransaction(t, "tx2", &pb.ChaincodeEvent{ChaincodeID: "mycc", EventName: "issued"}),
+		testTransaction(t, "tx3", nil),
+	}}}
+	eventHub.Recv(&pb.Event{Event: &pb.Event_Block{Block: block}})
+	expected = []string{"all:issued"}
+	if !reflect.DeepEqual(received, expected) {
+		t.Fatalf("Received %v, expected %v", received, expected)
+	}
+
+	received = nil
+	eventHub.UnregisterChaincodeEvent(all)
+	eventHub.Recv(&pb.Event{Event: &pb.Event_ChaincodeEvent{ChaincodeEvent: &pb.ChaincodeEvent{ChaincodeID: "mycc", TxID: "tx4", EventName: "transfer"}}})
+	expected = []string{"transfer:transfer"}
+	if !reflect.DeepEqual(received, expected) {
+		t.Fatalf("Received %v after unregistering, expected %v", received, expected)
+	}
+}
+
+func TestGetInterestedEvents(t *testing.T) {
+	eventHub := NewEventHub()
+	eventHub.RegisterChaincodeEvent("mycc", "a.*", func(*pb.ChaincodeEvent) {})
+	eventHub.RegisterChaincodeEvent("mycc", "b.*", func(*pb.ChaincodeEvent) {})
+	eventHub.RegisterChaincodeEvent("anothercc", "c", func(*pb.ChaincodeEvent) {})
+
+	interests, err := eventHub.GetInterestedEvents()
+	if err != nil {
+		t.Fatalf("GetInterestedEvents return error[%s]", err)
+	}
+	var chaincodeIDs []string
+	for _, interest := range interests {
+		if interest.EventType == pb.EventType_CHAINCODE {
+			chaincodeIDs = append(chaincodeIDs, interest.GetChaincodeRegInfo().ChaincodeID)
+		}
+	}
+	if !reflect.DeepEqual(chaincodeIDs, []string{"anothercc", "mycc"}) {
+		t.Fatalf("GetInterestedEvents return chaincode interests %v", chaincodeIDs)
+	}
+}
+
+func TestConcurrentRegistrationDuringDispatch(t *testing.T) {
+	eventHub := NewEventHub()
+	block := &common.Block{Header: &common.BlockHeader{Number: 1}, Data: &common.BlockData{Data: [][]byte{
+		testTransaction(t, "tx0", &pb.ChaincodeEvent{ChaincodeID: "mycc", EventName: "evt"}),
+	}}}
+
+	var wg, dispatcher sync.WaitGroup
+	done := make(chan struct{})
+	// dispatch continuously while other goroutines register and unregister
+	dispatcher.Add(1)
+	go func() {
+		defer dispatcher.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			eventHub.Recv(&pb.Event{Event: &pb.Event_Block{Block: block}})
+			eventHub.Recv(&pb.Event{Event: &pb.Event_ChaincodeEvent{ChaincodeEvent: &pb.ChaincodeEvent{
+				ChaincodeID: "mycc", TxID: fmt.Sprintf("tx%d", i), EventName: "evt"}}})
+		}
+	}()
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				cbe := eventHub.RegisterChaincodeEvent("mycc", "evt", func(*pb.ChaincodeEvent) {})
+				txID := fmt.Sprintf("tx-%d-%d", g, i)
+				eventHub.RegisterTxEvent(txID, func(string, error) {})
+				eventHub.GetInterestedEvents()
+				eventHub.UnregisterTxEvent(txID)
+				eventHub.UnregisterChaincodeEvent(cbe)
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(done)
+	dispatcher.Wait()
+}
+
+func TestCallbackUnregistersItself(t *testing.T) {
+	eventHub := NewEventHub()
+	var ccCalls, txCalls int32
+	var cbe *ChainCodeCBE
+	cbe = eventHub.RegisterChaincodeEvent("mycc", ".*", func(*pb.ChaincodeEvent) {
+		atomic.AddInt32(&ccCalls, 1)
+		eventHub.UnregisterChaincodeEvent(cbe)
+	})
+	other := int32(0)
+	eventHub.RegisterChaincodeEvent("mycc", ".*", func(*pb.ChaincodeEvent) {
+		atomic.AddInt32(&other, 1)
+	})
+	eventHub.RegisterTxEvent("tx1", func(txID string, err error) {
+		atomic.AddInt32(&txCalls, 1)
+		eventHub.UnregisterTxEvent(txID)
+	})
+
+	block := &common.Block{Header: &common.BlockHeader{Number: 1}, Data: &common.BlockData{Data: [][]byte{
+		testTransaction(t, "tx1", &pb.ChaincodeEvent{ChaincodeID: "mycc", EventName: "evt"}),
+	}}}
+	eventHub.Recv(&pb.Event{Event: &pb.Event_Block{Block: block}})
+	eventHub.Recv(&pb.Event{Event: &pb.Event_ChaincodeEvent{ChaincodeEvent: &pb.ChaincodeEvent{ChaincodeID: "mycc", TxID: "tx2", EventName: "evt"}}})
+	eventHub.Recv(&pb.Event{Event: &pb.Event_Block{Block: block}})
+
+	if ccCalls != 1 || txCalls != 1 {
+		t.Fatalf("Callbacks that unregistered themselves were called %d and %d times, expected once", ccCalls, txCalls)
+	}
+	if other != 2 {
+		t.Fatalf("Remaining callback was called %d times, expected 2", other)
+	}
+}
+
+// testTransaction returns the block data of an endorser transaction setting the chaincode event
+func testTransaction(t *testing.T, txID string, ccEvent *pb.ChaincodeEvent) []byte {
+	var events []byte
+	var err error
+	if ccEvent != nil {
+		if events, err = proto.Marshal(ccEvent); err != nil {
+			t.Fatalf("Marshal return error[%s]", err)
+		}
+	}
+	marshal := func(m proto.Message) []byte {
+		b, err := proto.Marshal(m)
+		if err != nil {
+			t.Fatalf("Marshal return error[%s]", err)
+		}
+		return b
+	}
+	prp := marshal(&pb.ProposalResponsePayload{Extension: marshal(&pb.ChaincodeAction{Events: events})})
+	cap := marshal(&pb.ChaincodeActionPayload{Action: &pb.ChaincodeEndorsedAction{ProposalResponsePayload: prp}})
+	tx := marshal(&pb.Transaction{Actions: []*pb.TransactionAction{{Payload: cap}}})
+	payload := marshal(&common.Payload{Header: &common.Header{ChainHeader: &common.ChainHeader{
+		Type: int32(common.HeaderType_ENDORSER_TRANSACTION), TxID: txID}}, Data: tx})
+	return marshal(&common.Envelope{Payload: payload})
+}
@@ -0,0 +1,134 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"sort"
+
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// interestKey identifies an interest registered with the peer
+func interestKey(interest *pb.Interest) string {
+	if interest.EventType == pb.EventType_CHAINCODE && interest.GetChaincodeRegInfo() != nil {
+		return interest.EventType.String() + "/" + interest.GetChaincodeRegInfo().ChaincodeID
+	}
+	return interest.EventType.String()
+}
+
+/**
+ * private internal number of listeners needing the blocks. Must be called with the lock held.
+ */
+func (eventHub *EventHub) blockListenersLocked() int {
+	return len(eventHub.txRegistrants) + len(eventHub.blockCallbacks) + len(eventHub.blockSubscriptions)
+}
+
+/**
+ * private internal interests needed by the current listeners. Must be called with the lock held.
+ * Blocks carry the transaction status and are needed by the transaction, block
+ * and block subscription listeners; rejections are needed by the transaction
+ * listeners; the chaincode events of a chaincode by its chaincode listeners.
+ * An interest is needed as long as one of its listeners is left, so it is
+ * unregistered when its last listener goes.
+ * @returns {map} The interests keyed by interestKey.
+ */
+func (eventHub *EventHub) interestsLocked() map[string]*pb.Interest {
+	interests := make(map[string]*pb.Interest)
+	add := func(interest *pb.Interest, listeners int) {
+		if listeners > 0 {
+			interests[interestKey(interest)] = interest
+		}
+	}
+	add(&pb.Interest{EventType: pb.EventType_BLOCK}, eventHub.blockListenersLocked())
+	add(&pb.Interest{EventType: pb.EventType_REJECTION}, len(eventHub.txRegistrants))
+	// the peer matches event names literally, so ask for all the events
+	// of the chaincode and apply the regex filters when dispatching
+	for ccid, cbes := range eventHub.chaincodeRegistrants {
+		add(&pb.Interest{EventType: pb.EventType_CHAINCODE,
+			RegInfo: &pb.Interest_ChaincodeRegInfo{ChaincodeRegInfo: &pb.ChaincodeReg{ChaincodeID: ccid, EventName: ""}}}, len(cbes))
+	}
+	return interests
+}
+
+/**
+ * private internal update of the interests registered on the live stream, after
+ * listeners came or went: the interests no longer referenced are unregistered and
+ * the new ones registered. The changes are computed under the lock, which is released
+ * while they are sent so that a slow stream doesn't hold up the registrations and the
+ * dispatch; updates are sent one at a time, in order. Must be called without the lock held.
+ */
+func (eventHub *EventHub) updateInterests() {
+	eventHub.interestsMtx.Lock()
+	defer eventHub.interestsMtx.Unlock()
+
+	eventHub.mtx.Lock()
+	if eventHub.blockListenersLocked() == 0 {
+		// nobody receives the blocks anymore, the first block received once a
+		// listener comes back is not a gap since the last delivered one
+		eventHub.hasLastBlock = false
+	}
+	client := eventHub.client
+	if !eventHub.connected || client == nil {
+		// the interests are registered when connecting
+		eventHub.mtx.Unlock()
+		return
+	}
+	interests := eventHub.interestsLocked()
+	var added, removed []*pb.Interest
+	for _, key := range sortedInterestKeys(interests) {
+		if _, ok := eventHub.streamInterests[key]; !ok {
+			added = append(added, interests[key])
+		}
+	}
+	for _, key := range sortedInterestKeys(eventHub.streamInterests) {
+		if _, ok := interests[key]; !ok {
+			removed = append(removed, eventHub.streamInterests[key])
+		}
+	}
+	eventHub.mtx.Unlock()
+
+	if len(added) > 0 {
+		if err := client.RegisterAsync(added); err != nil {
+			logger.Errorf("Could not register interests on the event stream: %s\n", err)
+			return
+		}
+	}
+	if len(removed) > 0 {
+		if err := client.UnregisterAsync(removed); err != nil {
+			logger.Errorf("Could not unregister interests on the event stream: %s\n", err)
+			return
+		}
+	}
+	eventHub.mtx.Lock()
+	if eventHub.client == client {
+		eventHub.streamInterests = interests
+	}
+	eventHub.mtx.Unlock()
+}
+
+// sortedInterestKeys returns the keys of the interests in order
+func sortedInterestKeys(interests map[string]*pb.Interest) []string {
+	keys := make([]string, 0, len(interests))
+	for key := range interests {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
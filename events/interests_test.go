@@ -0,0 +1,96 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func TestInterestsFollowListeners(t *testing.T) {
+	eventServer := newMockEventServer()
+	addr, grpcServer := startMockEventServer(t, eventServer)
+	defer grpcServer.Stop()
+
+	eventHub := NewEventHub()
+	eventHub.SetPeerAddr(addr)
+	eventHub.RegisterChaincodeEvent("mycc", ".*", func(*pb.ChaincodeEvent) {})
+	if err := eventHub.Connect(); err != nil {
+		t.Fatalf("Connect return error[%s]", err)
+	}
+	defer eventHub.Disconnect()
+	interests, _ := eventServer.getInterests()
+	if keys := interestKeys(interests); !reflect.DeepEqual(keys, []string{"CHAINCODE/mycc"}) {
+		t.Fatalf("Registered interests %v, expected [CHAINCODE/mycc]", keys)
+	}
+
+	// a second listener of the same chaincode shares the interest
+	second := eventHub.RegisterChaincodeEvent("mycc", "^a", func(*pb.ChaincodeEvent) {})
+	eventHub.RegisterTxEvent("tx1", func(string, error) {})
+	eventHub.UnregisterChaincodeEvent(second)
+	eventHub.UnregisterTxEvent("tx1")
+	expected := []string{"register [BLOCK REJECTION]", "unregister [BLOCK REJECTION]"}
+	waitForUpdates(t, eventServer, expected)
+
+	blocks, unsubscribe := eventHub.SubscribeBlocks(SubscriptionOptions{})
+	eventHub.RegisterTxEvent("tx2", func(string, error) {})
+	unsubscribe()
+	eventHub.UnregisterTxEvent("tx2")
+	for range blocks {
+	}
+	expected = append(expected, "register [BLOCK]", "register [REJECTION]", "unregister [BLOCK REJECTION]")
+	waitForUpdates(t, eventServer, expected)
+}
+
+func interestKeys(interests []*pb.Interest) []string {
+	var keys []string
+	for _, interest := range interests {
+		keys = append(keys, interestKey(interest))
+	}
+	return keys
+}
+
+func waitForUpdates(t *testing.T, eventServer *mockEventServer, expected []string) {
+	var received []string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		_, updates := eventServer.getInterests()
+		received = nil
+		for _, update := range updates {
+			switch e := update.Event.(type) {
+			case *pb.Event_Register:
+				received = append(received, "register "+fmt.Sprint(interestKeys(e.Register.Events)))
+			case *pb.Event_Unregister:
+				received = append(received, "unregister "+fmt.Sprint(interestKeys(e.Unregister.Events)))
+			}
+		}
+		if len(received) >= len(expected) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !reflect.DeepEqual(received, expected) {
+		t.Fatalf("Received interest updates %v, expected %v", received, expected)
+	}
+}
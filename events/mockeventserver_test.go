@@ -0,0 +1,113 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+
+	common "github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"google.golang.org/grpc"
+)
+
+// mockEventServer is an in-process Events server that accepts the registration of
+// each stream, records the interest updates, sends the blocks pushed to it and
+// ends the current stream on drop.
+type mockEventServer struct {
+	sync.Mutex
+	registrations int
+	interests     []*pb.Interest
+	updates       []*pb.Event
+	blocks        chan *common.Block
+	drop          chan struct{}
+}
+
+func newMockEventServer() *mockEventServer {
+	return &mockEventServer{blocks: make(chan *common.Block), drop: make(chan struct{})}
+}
+
+func (m *mockEventServer) Chat(stream pb.Events_ChatServer) error {
+	in, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	register, ok := in.Event.(*pb.Event_Register)
+	if !ok {
+		return fmt.Errorf("expected register event, got %T", in.Event)
+	}
+	if err := stream.Send(&pb.Event{Event: register}); err != nil {
+		return err
+	}
+	m.Lock()
+	m.registrations++
+	m.interests = register.Register.Events
+	m.Unlock()
+
+	go func() {
+		for {
+			update, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			m.Lock()
+			m.updates = append(m.updates, update)
+			m.Unlock()
+		}
+	}()
+
+	for {
+		select {
+		case block := <-m.blocks:
+			if err := stream.Send(&pb.Event{Event: &pb.Event_Block{Block: block}}); err != nil {
+				return err
+			}
+		case <-m.drop:
+			return fmt.Errorf("stream dropped")
+		}
+	}
+}
+
+// getInterests returns the interests of the last registration and the updates received since
+func (m *mockEventServer) getInterests() ([]*pb.Interest, []*pb.Event) {
+	m.Lock()
+	defer m.Unlock()
+	return m.interests, m.updates
+}
+
+func (m *mockEventServer) getRegistrations() int {
+	m.Lock()
+	defer m.Unlock()
+	return m.registrations
+}
+
+// startMockEventServer starts the mock server on a random local port and returns its address
+func startMockEventServer(t *testing.T, eventServer pb.EventsServer) (string, *grpc.Server) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	grpcServer := grpc.NewServer()
+	pb.RegisterEventsServer(grpcServer, eventServer)
+	go grpcServer.Serve(lis)
+	return lis.Addr().String(), grpcServer
+}
@@ -0,0 +1,358 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	common "github.com/hyperledger/fabric/protos/common"
+)
+
+// maxPendingBlocks is how far ahead of the next block to deliver the blocks
+// waiting for confirmations are kept, so that a peer can't fill the memory
+const maxPendingBlocks = 1000
+
+// UnconfirmableBlockError is the reason the subscriptions of a MultiEventHub end when the next
+// block to deliver can't be confirmed anymore: the peers which sent it don't agree on its content,
+// and the others are past it. No later block is delivered.
+type UnconfirmableBlockError struct {
+	Number        uint64
+	Versions      int
+	Confirmations int
+}
+
+// Error describes the block which can't be confirmed
+func (e *UnconfirmableBlockError) Error() string {
+	return fmt.Sprintf("Block %d can't be confirmed: the peers sent %d different versions and %d must agree", e.Number, e.Versions, e.Confirmations)
+}
+
+// MultiEventHub ...
+/**
+ * The MultiEventHub receives the blocks from the event sources of several peers,
+ * so that events keep coming while at least one of them is up. Each block is
+ * delivered once, when the same block (number, hash and transaction validation codes)
+ * has been received from the required number of peers, which protects the
+ * commit notifications from a single lying peer. Blocks are delivered strictly in
+ * order: a confirmed block waits until the blocks before it are confirmed. The delivery
+ * starts at the block set by SetStartBlock, or else at the lowest block received which
+ * can still be confirmed once a first block is confirmed. When the next block can't be
+ * confirmed anymore, the subscriptions end with an *UnconfirmableBlockError.
+ *
+ * The callbacks and subscriptions are registered on the embedded EventHub, which
+ * is not connected itself. Rejection events are not reported, as they come from a
+ * single peer.
+ */
+type MultiEventHub struct {
+	*EventHub
+	// event hubs of the peers, in the order of the peer addresses
+	peerAddrs []string
+	hubs      []*EventHub
+	// number of peers which must send a block before it is delivered
+	confirmations int
+	// serializes the receipt and delivery of blocks
+	receiveMtx sync.Mutex
+	// peers which sent each block, keyed by block number and block key
+	pending map[uint64]map[string]map[string]bool
+	// confirmed blocks waiting for the blocks before them to be confirmed
+	confirmed map[uint64]*common.Block
+	// next block to deliver, once the delivery started
+	next    uint64
+	started bool
+	// highest block received from each peer, a peer past a block doesn't send it anymore
+	lastReceived map[string]uint64
+	// set once the next block can't be confirmed
+	stalled *UnconfirmableBlockError
+}
+
+// NewMultiEventHub ...
+/**
+ * @param {[]string} peerAddrs The addresses of the peer event sources.
+ * @param {int} confirmations The number of peers which must send a block before its
+ * events are delivered, 1 to deliver the block received first.
+ */
+func NewMultiEventHub(peerAddrs []string, confirmations int) (*MultiEventHub, error) {
+	if len(peerAddrs) == 0 {
+		return nil, fmt.Errorf("peerAddrs is empty")
+	}
+	if confirmations < 1 || confirmations > len(peerAddrs) {
+		return nil, fmt.Errorf("confirmations must be between 1 and %d, got %d", len(peerAddrs), confirmations)
+	}
+	multiEventHub := &MultiEventHub{EventHub: NewEventHub(), confirmations: confirmations,
+		pending: make(map[uint64]map[string]map[string]bool), confirmed: make(map[uint64]*common.Block),
+		lastReceived: make(map[string]uint64)}
+	for _, peerAddr := range peerAddrs {
+		peerAddr := peerAddr
+		eventHub := NewEventHub()
+		eventHub.SetPeerAddr(peerAddr)
+		eventHub.RegisterBlockEvent(func(block *common.Block) {
+			multiEventHub.receive(peerAddr, block)
+		})
+		multiEventHub.peerAddrs = append(multiEventHub.peerAddrs, peerAddr)
+		multiEventHub.hubs = append(multiEventHub.hubs, eventHub)
+	}
+	return multiEventHub, nil
+}
+
+// Connect ...
+/**
+ * Establishes connection with the peer event sources. The peers which can't be
+ * connected are retried in the background according to the ReconnectConfig.
+ * @returns {error} An error if no peer could be connected.
+ */
+func (multiEventHub *MultiEventHub) Connect() error {
+	var errs []string
+	for i, eventHub := range multiEventHub.hubs {
+		if err := eventHub.Connect(); err != nil {
+			logger.Warningf("Could not connect to event source %s: %s\n", multiEventHub.peerAddrs[i], err)
+			errs = append(errs, err.Error())
+			eventHub.retryConnect()
+		}
+	}
+	if len(errs) == len(multiEventHub.hubs) {
+		// stop retrying, the registrations and subscriptions are kept for the next Connect
+		for _, eventHub := range multiEventHub.hubs {
+			eventHub.Disconnect()
+		}
+		return fmt.Errorf("Could not connect to any event source: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Disconnect ...
+/**
+ * Disconnects the peer event sources and ends the channel subscriptions.
+ */
+func (multiEventHub *MultiEventHub) Disconnect() {
+	for _, eventHub := range multiEventHub.hubs {
+		eventHub.Disconnect()
+	}
+	multiEventHub.EventHub.Disconnect()
+}
+
+// Isconnected ...
+/**
+ * Get connected state of the MultiEventHub
+ * @returns true if connected to at least one event source, false otherwise
+ */
+func (multiEventHub *MultiEventHub) Isconnected() bool {
+	return len(multiEventHub.GetConnectedPeers()) > 0
+}
+
+// GetConnectedPeers ...
+/**
+ * Get the peers whose event source is connected.
+ * @returns {[]string} The addresses of the connected event sources.
+ */
+func (multiEventHub *MultiEventHub) GetConnectedPeers() []string {
+	var connected []string
+	for i, eventHub := range multiEventHub.hubs {
+		if eventHub.Isconnected() {
+			connected = append(connected, multiEventHub.peerAddrs[i])
+		}
+	}
+	return connected
+}
+
+// SetReconnectConfig ...
+/**
+ * Set the automatic reconnection settings of each peer event source, see ReconnectConfig.
+ * @param {ReconnectConfig} config The reconnection settings.
+ */
+func (multiEventHub *MultiEventHub) SetReconnectConfig(config ReconnectConfig) {
+	for _, eventHub := range multiEventHub.hubs {
+		eventHub.SetReconnectConfig(config)
+	}
+}
+
+// SetStartBlock ...
+/**
+ * Set the first block to deliver, the blocks before it are ignored.
+ * @param {uint64} number The block number.
+ * @returns {error} An error if the delivery already started.
+ */
+func (multiEventHub *MultiEventHub) SetStartBlock(number uint64) error {
+	multiEventHub.receiveMtx.Lock()
+	defer multiEventHub.receiveMtx.Unlock()
+	if multiEventHub.started {
+		return fmt.Errorf("the delivery already started at block %d", multiEventHub.next)
+	}
+	multiEventHub.startAt(number)
+	multiEventHub.deliverConfirmed()
+	return nil
+}
+
+/**
+ * private internal receipt of a block from a peer, the block is delivered
+ * once received from enough peers
+ * @param {string} peerAddr the peer which sent the block
+ * @param {object} block the block from the fabric
+ */
+func (multiEventHub *MultiEventHub) receive(peerAddr string, block *common.Block) {
+	if block == nil || block.Header == nil {
+		return
+	}
+	multiEventHub.receiveMtx.Lock()
+	defer multiEventHub.receiveMtx.Unlock()
+
+	number := block.Header.Number
+	if last, ok := multiEventHub.lastReceived[peerAddr]; !ok || number > last {
+		multiEventHub.lastReceived[peerAddr] = number
+	}
+	if multiEventHub.stalled != nil {
+		// also end the subscriptions made since the delivery stalled
+		multiEventHub.EventHub.closeSubscriptions(multiEventHub.stalled)
+		return
+	}
+	if multiEventHub.started && number < multiEventHub.next {
+		return
+	}
+	if multiEventHub.started && number >= multiEventHub.next+maxPendingBlocks {
+		logger.Warningf("Ignoring block %d from %s, too far ahead of block %d\n", number, peerAddr, multiEventHub.next)
+		return
+	}
+	receipts := multiEventHub.pending[number]
+	if receipts == nil {
+		receipts = make(map[string]map[string]bool)
+		multiEventHub.pending[number] = receipts
+	}
+	key := blockKey(block)
+	if receipts[key] == nil {
+		if len(receipts) > 0 {
+			logger.Warningf("Block %d from %s differs from the block sent by other peers\n", number, peerAddr)
+		}
+		receipts[key] = make(map[string]bool)
+	}
+	receipts[key][peerAddr] = true
+	if _, ok := multiEventHub.confirmed[number]; !ok && len(receipts[key]) >= multiEventHub.confirmations {
+		multiEventHub.confirmed[number] = block
+		if !multiEventHub.started {
+			multiEventHub.start(number)
+		}
+	}
+	multiEventHub.deliverConfirmed()
+	multiEventHub.checkStalled()
+}
+
+/**
+ * private internal start of the delivery when the first block is confirmed: it starts
+ * at the lowest block received which can still be confirmed, so that a block confirmed
+ * after a later one is not skipped
+ * @param {uint64} number the confirmed block
+ */
+func (multiEventHub *MultiEventHub) start(number uint64) {
+	start := number
+	for n := range multiEventHub.pending {
+		if n < start && multiEventHub.confirmable(n) {
+			start = n
+		}
+	}
+	multiEventHub.startAt(start)
+}
+
+/**
+ * private internal start of the delivery at the given block, the blocks before it are dropped
+ * @param {uint64} number the first block to deliver
+ */
+func (multiEventHub *MultiEventHub) startAt(number uint64) {
+	multiEventHub.next = number
+	multiEventHub.started = true
+	for n := range multiEventHub.pending {
+		if n < number {
+			delete(multiEventHub.pending, n)
+			delete(multiEventHub.confirmed, n)
+		}
+	}
+}
+
+/**
+ * private internal delivery of the confirmed blocks following the last delivered one
+ */
+func (multiEventHub *MultiEventHub) deliverConfirmed() {
+	if !multiEventHub.started {
+		return
+	}
+	for {
+		next, ok := multiEventHub.confirmed[multiEventHub.next]
+		if !ok {
+			break
+		}
+		delete(multiEventHub.confirmed, multiEventHub.next)
+		delete(multiEventHub.pending, multiEventHub.next)
+		multiEventHub.next++
+		multiEventHub.EventHub.receiveBlock(next)
+	}
+	if len(multiEventHub.confirmed) > 0 {
+		logger.Debugf("Holding %d confirmed blocks until block %d is confirmed\n", len(multiEventHub.confirmed), multiEventHub.next)
+	}
+}
+
+/**
+ * private internal check that a block can still be confirmed: its most sent version, with
+ * the peers which didn't send it and are not past it yet, is enough
+ * @param {uint64} number the block number
+ */
+func (multiEventHub *MultiEventHub) confirmable(number uint64) bool {
+	agreeing := 0
+	sent := make(map[string]bool)
+	for _, peers := range multiEventHub.pending[number] {
+		if len(peers) > agreeing {
+			agreeing = len(peers)
+		}
+		for peerAddr := range peers {
+			sent[peerAddr] = true
+		}
+	}
+	undecided := 0
+	for _, peerAddr := range multiEventHub.peerAddrs {
+		if last, ok := multiEventHub.lastReceived[peerAddr]; !sent[peerAddr] && (!ok || last < number) {
+			undecided++
+		}
+	}
+	return agreeing+undecided >= multiEventHub.confirmations
+}
+
+/**
+ * private internal check that the next block can still be confirmed, otherwise no later block
+ * is delivered and the subscriptions are ended with an *UnconfirmableBlockError
+ */
+func (multiEventHub *MultiEventHub) checkStalled() {
+	if !multiEventHub.started || multiEventHub.confirmable(multiEventHub.next) {
+		return
+	}
+	multiEventHub.stalled = &UnconfirmableBlockError{Number: multiEventHub.next,
+		Versions: len(multiEventHub.pending[multiEventHub.next]), Confirmations: multiEventHub.confirmations}
+	logger.Errorf("%s, no later block is delivered\n", multiEventHub.stalled)
+	multiEventHub.EventHub.closeSubscriptions(multiEventHub.stalled)
+}
+
+// blockKey identifies the content of a block: its header, its data and
+// the validation codes of its transactions
+func blockKey(block *common.Block) string {
+	key := string(block.Header.Hash())
+	if block.Data != nil {
+		key += string(block.Data.Hash())
+	}
+	if block.Metadata != nil && len(block.Metadata.Metadata) > int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		key += string(block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER])
+	}
+	return key
+}
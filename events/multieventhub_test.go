@@ -0,0 +1,241 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	common "github.com/hyperledger/fabric/protos/common"
+)
+
+func TestNewMultiEventHub(t *testing.T) {
+	if _, err := NewMultiEventHub(nil, 1); err == nil || err.Error() != "peerAddrs is empty" {
+		t.Fatalf("NewMultiEventHub didn't return right error: %v", err)
+	}
+	if _, err := NewMultiEventHub([]string{"a", "b"}, 3); err == nil || err.Error() != "confirmations must be between 1 and 2, got 3" {
+		t.Fatalf("NewMultiEventHub didn't return right error: %v", err)
+	}
+}
+
+func TestMultiEventHubConfirmations(t *testing.T) {
+	multiEventHub, err := NewMultiEventHub([]string{"a", "b", "c"}, 2)
+	if err != nil {
+		t.Fatalf("NewMultiEventHub return error[%s]", err)
+	}
+	var committed []error
+	multiEventHub.RegisterTxEvent("tx1", func(txID string, err error) {
+		committed = append(committed, err)
+	})
+
+	block := &common.Block{Header: &common.BlockHeader{Number: 1}, Data: &common.BlockData{Data: [][]byte{testTransaction(t, "tx1", nil)}},
+		Metadata: &common.BlockMetadata{Metadata: [][]byte{{}, {}, {byte(TxValidationCode_VALID)}}}}
+	// the lying peer reports the transaction as invalid
+	lie := &common.Block{Header: block.Header, Data: block.Data,
+		Metadata: &common.BlockMetadata{Metadata: [][]byte{{}, {}, {byte(TxValidationCode_MVCC_READ_CONFLICT)}}}}
+
+	multiEventHub.receive("a", block)
+	multiEventHub.receive("a", block)
+	multiEventHub.receive("c", lie)
+	if len(committed) != 0 {
+		t.Fatalf("Transaction reported before being confirmed by 2 peers")
+	}
+	multiEventHub.receive("b", block)
+	multiEventHub.receive("c", block)
+	if len(committed) != 1 || committed[0] != nil {
+		t.Fatalf("Transaction reported %v, expected a single valid commit", committed)
+	}
+}
+
+func TestMultiEventHubInOrder(t *testing.T) {
+	multiEventHub, err := NewMultiEventHub([]string{"a", "b", "c"}, 2)
+	if err != nil {
+		t.Fatalf("NewMultiEventHub return error[%s]", err)
+	}
+	var delivered []uint64
+	multiEventHub.RegisterBlockEvent(func(block *common.Block) {
+		delivered = append(delivered, block.Header.Number)
+	})
+	block := func(number uint64, data string) *common.Block {
+		return &common.Block{Header: &common.BlockHeader{Number: number}, Data: &common.BlockData{Data: [][]byte{[]byte(data)}}}
+	}
+
+	multiEventHub.receive("a", block(1, "x"))
+	multiEventHub.receive("b", block(1, "x"))
+	// a and b disagree on block 2, then agree on block 3
+	multiEventHub.receive("a", block(2, "x"))
+	multiEventHub.receive("b", block(2, "y"))
+	multiEventHub.receive("a", block(3, "x"))
+	multiEventHub.receive("b", block(3, "x"))
+	if len(delivered) != 1 || delivered[0] != 1 {
+		t.Fatalf("Delivered blocks %v, expected block 3 to wait for block 2", delivered)
+	}
+	// c confirms the version of a, blocks 2 and 3 are delivered in order
+	multiEventHub.receive("c", block(2, "x"))
+	if len(delivered) != 3 || delivered[1] != 2 || delivered[2] != 3 {
+		t.Fatalf("Delivered blocks %v, expected [1 2 3]", delivered)
+	}
+	multiEventHub.receive("c", block(3, "x"))
+
+	// no version of block 4 gets 2 peers, later blocks are never delivered
+	// and the subscriptions end with the unconfirmable block
+	blocks, unsubscribe := multiEventHub.SubscribeBlocks(SubscriptionOptions{})
+	multiEventHub.receive("a", block(4, "x"))
+	multiEventHub.receive("b", block(4, "y"))
+	multiEventHub.receive("a", block(5, "x"))
+	multiEventHub.receive("b", block(5, "x"))
+	if len(delivered) != 3 {
+		t.Fatalf("Delivered blocks %v, expected block 5 to wait for block 4", delivered)
+	}
+	multiEventHub.receive("c", block(4, "z"))
+	if len(delivered) != 3 {
+		t.Fatalf("Delivered blocks %v, expected no block after the unconfirmed block 4", delivered)
+	}
+	checkUnconfirmable(t, blocks, unsubscribe, 4, 3)
+
+	// a later subscription ends at the next block received
+	blocks, unsubscribe = multiEventHub.SubscribeBlocks(SubscriptionOptions{})
+	multiEventHub.receive("c", block(5, "x"))
+	checkUnconfirmable(t, blocks, unsubscribe, 4, 3)
+}
+
+func TestMultiEventHubStart(t *testing.T) {
+	multiEventHub, err := NewMultiEventHub([]string{"a", "b", "c"}, 2)
+	if err != nil {
+		t.Fatalf("NewMultiEventHub return error[%s]", err)
+	}
+	var delivered []uint64
+	multiEventHub.RegisterBlockEvent(func(block *common.Block) {
+		delivered = append(delivered, block.Header.Number)
+	})
+	block := func(number uint64) *common.Block {
+		return &common.Block{Header: &common.BlockHeader{Number: number}, Data: &common.BlockData{}}
+	}
+
+	// b connected after block 4, which is confirmed after block 5
+	multiEventHub.receive("a", block(4))
+	multiEventHub.receive("a", block(5))
+	multiEventHub.receive("b", block(5))
+	if len(delivered) != 0 {
+		t.Fatalf("Delivered blocks %v, expected block 5 to wait for block 4", delivered)
+	}
+	multiEventHub.receive("c", block(4))
+	if !reflect.DeepEqual(delivered, []uint64{4, 5}) {
+		t.Fatalf("Delivered blocks %v, expected [4 5]", delivered)
+	}
+	if err := multiEventHub.SetStartBlock(1); err == nil || err.Error() != "the delivery already started at block 6" {
+		t.Fatalf("SetStartBlock didn't return right error: %v", err)
+	}
+
+	// with an explicit start block the blocks before it are ignored
+	multiEventHub, err = NewMultiEventHub([]string{"a", "b"}, 2)
+	if err != nil {
+		t.Fatalf("NewMultiEventHub return error[%s]", err)
+	}
+	delivered = nil
+	multiEventHub.RegisterBlockEvent(func(block *common.Block) {
+		delivered = append(delivered, block.Header.Number)
+	})
+	multiEventHub.receive("a", block(2))
+	if err := multiEventHub.SetStartBlock(3); err != nil {
+		t.Fatalf("SetStartBlock return error[%s]", err)
+	}
+	multiEventHub.receive("b", block(2))
+	multiEventHub.receive("a", block(3))
+	multiEventHub.receive("b", block(3))
+	if !reflect.DeepEqual(delivered, []uint64{3}) {
+		t.Fatalf("Delivered blocks %v, expected [3]", delivered)
+	}
+
+	// both peers skipped block 4, which can't be confirmed anymore
+	blocks, unsubscribe := multiEventHub.SubscribeBlocks(SubscriptionOptions{})
+	multiEventHub.receive("a", block(5))
+	multiEventHub.receive("b", block(5))
+	checkUnconfirmable(t, blocks, unsubscribe, 4, 0)
+}
+
+func checkUnconfirmable(t *testing.T, blocks <-chan *common.Block, unsubscribe Unsubscribe, number uint64, versions int) {
+	select {
+	case b, ok := <-blocks:
+		if ok {
+			t.Fatalf("Unexpected block %d", b.Header.Number)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timeout waiting for the end of the subscription")
+	}
+	err, ok := unsubscribe().(*UnconfirmableBlockError)
+	if !ok || err.Number != number || err.Versions != versions || err.Confirmations != 2 {
+		t.Fatalf("Subscription ended with %v, expected block %d to be unconfirmable", err, number)
+	}
+}
+
+func TestMultiEventHubFailover(t *testing.T) {
+	serverA := newMockEventServer()
+	addrA, grpcServerA := startMockEventServer(t, serverA)
+	serverB := newMockEventServer()
+	addrB, grpcServerB := startMockEventServer(t, serverB)
+	defer grpcServerB.Stop()
+
+	multiEventHub, err := NewMultiEventHub([]string{addrA, addrB}, 1)
+	if err != nil {
+		t.Fatalf("NewMultiEventHub return error[%s]", err)
+	}
+	blocks, unsubscribe := multiEventHub.SubscribeBlocks(SubscriptionOptions{})
+	defer unsubscribe()
+	if err := multiEventHub.Connect(); err != nil {
+		t.Fatalf("Connect return error[%s]", err)
+	}
+	defer multiEventHub.Disconnect()
+	if len(multiEventHub.GetConnectedPeers()) != 2 {
+		t.Fatalf("Connected to %v, expected both peers", multiEventHub.GetConnectedPeers())
+	}
+
+	block := func(number uint64) *common.Block {
+		return &common.Block{Header: &common.BlockHeader{Number: number}, Data: &common.BlockData{}}
+	}
+	serverA.blocks <- block(1)
+	serverB.blocks <- block(1)
+	waitForBlock(t, blocks, 1)
+
+	// peer A goes down, the blocks keep coming from peer B
+	grpcServerA.Stop()
+	serverB.blocks <- block(2)
+	waitForBlock(t, blocks, 2)
+	select {
+	case b := <-blocks:
+		t.Fatalf("Unexpected block %d", b.Header.Number)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if !multiEventHub.Isconnected() {
+		t.Fatalf("MultiEventHub is not connected with peer B up")
+	}
+}
+
+func waitForBlock(t *testing.T, blocks <-chan *common.Block, expected uint64) {
+	select {
+	case b := <-blocks:
+		if b.Header.Number != expected {
+			t.Fatalf("Received block %d, expected %d", b.Header.Number, expected)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timeout waiting for block %d", expected)
+	}
+}
@@ -0,0 +1,218 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"math/rand"
+	"time"
+
+	consumer "github.com/hyperledger/fabric-sdk-go/events/consumer"
+	common "github.com/hyperledger/fabric/protos/common"
+)
+
+// connectionAdapter delivers the events of one connection to the EventHub, so that
+// the late end of a replaced connection doesn't drop the current one
+type connectionAdapter struct {
+	*EventHub
+	client *consumer.EventsClient
+}
+
+// Disconnected implements consumer.EventAdapter interface for the loss of the event stream
+func (adapter *connectionAdapter) Disconnected(err error) {
+	adapter.EventHub.disconnected(adapter.client, err)
+}
+
+// ReconnectConfig ...
+/**
+ * Settings of the automatic reconnection of the EventHub when the event stream drops.
+ * The wait before an attempt starts at InitialBackoff and grows by Multiplier up to
+ * MaxBackoff; each wait is randomized by up to Jitter (a fraction of the wait) so that
+ * clients don't all reconnect at the same time after a peer restart.
+ */
+type ReconnectConfig struct {
+	// turns automatic reconnection off
+	Disabled bool
+	// number of attempts after a disconnection, 0 to retry until Disconnect is called
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	Jitter         float64
+}
+
+// DefaultReconnectConfig ...
+/**
+ * Returns the reconnection settings of a new EventHub.
+ */
+func DefaultReconnectConfig() ReconnectConfig {
+	return ReconnectConfig{InitialBackoff: 500 * time.Millisecond, MaxBackoff: 30 * time.Second, Multiplier: 2, Jitter: 0.2}
+}
+
+// backoff returns the wait before the attempt (starting at 0), random is in [0, 1)
+func (c ReconnectConfig) backoff(attempt int, random float64) time.Duration {
+	backoff := float64(c.InitialBackoff)
+	for i := 0; i < attempt && backoff < float64(c.MaxBackoff); i++ {
+		backoff *= c.Multiplier
+	}
+	if c.MaxBackoff > 0 && backoff > float64(c.MaxBackoff) {
+		backoff = float64(c.MaxBackoff)
+	}
+	backoff += backoff * c.Jitter * (2*random - 1)
+	if backoff < 0 {
+		return 0
+	}
+	return time.Duration(backoff)
+}
+
+// SetReconnectConfig ...
+/**
+ * Set the automatic reconnection settings, see ReconnectConfig.
+ * @param {ReconnectConfig} config The reconnection settings.
+ */
+func (eventHub *EventHub) SetReconnectConfig(config ReconnectConfig) {
+	eventHub.mtx.Lock()
+	defer eventHub.mtx.Unlock()
+	eventHub.reconnectConfig = config
+}
+
+// SetBlockSource ...
+/**
+ * Set the function used to fetch the blocks missed while the event stream was down,
+ * for example a query of the chain ledger. Without a block source, missed blocks are
+ * only reported in the log.
+ * @param {function} blockSource Function returning the block with the given number.
+ */
+func (eventHub *EventHub) SetBlockSource(blockSource func(number uint64) (*common.Block, error)) {
+	eventHub.mtx.Lock()
+	defer eventHub.mtx.Unlock()
+	eventHub.blockSource = blockSource
+}
+
+/**
+ * private internal loop reconnecting to the event source after a disconnection.
+ * It stops when connected, when the attempts are exhausted or when stop is closed.
+ * @param {chan} stop closed by Disconnect
+ */
+func (eventHub *EventHub) reconnect(stop chan struct{}) {
+	eventHub.mtx.RLock()
+	config := eventHub.reconnectConfig
+	eventHub.mtx.RUnlock()
+
+	for attempt := 0; config.MaxAttempts == 0 || attempt < config.MaxAttempts; attempt++ {
+		wait := config.backoff(attempt, rand.Float64())
+		logger.Infof("Reconnecting to event source in %s (attempt %d)\n", wait, attempt+1)
+		select {
+		case <-stop:
+			return
+		case <-time.After(wait):
+		}
+
+		// the interests are registered again when connecting
+		if err := eventHub.connect(stop); err != nil {
+			logger.Warningf("Reconnection to event source failed: %s\n", err)
+			continue
+		}
+		logger.Infof("Reconnected to event source\n")
+		eventHub.catchUp()
+		return
+	}
+	logger.Errorf("Giving up reconnecting to event source after %d attempts\n", config.MaxAttempts)
+	eventHub.closeSubscriptions(ErrEventHubDisconnected)
+}
+
+/**
+ * private internal start of the reconnection loop after Connect failed,
+ * unless reconnection is disabled or Disconnect was called
+ */
+func (eventHub *EventHub) retryConnect() {
+	eventHub.mtx.RLock()
+	stop := eventHub.stopReconnect
+	disabled := eventHub.reconnectConfig.Disabled
+	eventHub.mtx.RUnlock()
+	if !disabled && stop != nil {
+		go eventHub.reconnect(stop)
+	}
+}
+
+/**
+ * private internal replay of the blocks committed since the last delivered block,
+ * up to the current height of the block source
+ */
+func (eventHub *EventHub) catchUp() {
+	eventHub.dispatchMtx.Lock()
+	defer eventHub.dispatchMtx.Unlock()
+
+	eventHub.mtx.RLock()
+	blockSource := eventHub.blockSource
+	next, delivered := eventHub.lastBlock+1, eventHub.hasLastBlock
+	eventHub.mtx.RUnlock()
+	if blockSource == nil || !delivered {
+		return
+	}
+	for {
+		block, err := blockSource(next)
+		if err != nil || block == nil {
+			// the block source has no more blocks
+			return
+		}
+		logger.Infof("Replaying block %d missed while disconnected\n", next)
+		eventHub.dispatchBlock(block)
+		next++
+	}
+}
+
+/**
+ * private internal delivery of a block received from the event source. Blocks already
+ * delivered are ignored, and the blocks missed since the last delivered one are replayed first.
+ * @param {object} block the block from the fabric
+ */
+func (eventHub *EventHub) receiveBlock(block *common.Block) {
+	eventHub.dispatchMtx.Lock()
+	defer eventHub.dispatchMtx.Unlock()
+
+	if block == nil || block.Header == nil {
+		eventHub.dispatchBlock(block)
+		return
+	}
+	number := block.Header.Number
+	eventHub.mtx.RLock()
+	blockSource := eventHub.blockSource
+	last, delivered := eventHub.lastBlock, eventHub.hasLastBlock
+	eventHub.mtx.RUnlock()
+
+	if delivered && number <= last {
+		logger.Debugf("Ignoring block %d, already delivered\n", number)
+		return
+	}
+	for missed := last + 1; delivered && missed < number; missed++ {
+		if blockSource == nil {
+			logger.Errorf("Blocks %d to %d were missed and no block source is set\n", missed, number-1)
+			break
+		}
+		missedBlock, err := blockSource(missed)
+		if err != nil || missedBlock == nil {
+			logger.Errorf("Could not fetch missed block %d: %v\n", missed, err)
+			continue
+		}
+		logger.Infof("Replaying missed block %d\n", missed)
+		eventHub.dispatchBlock(missedBlock)
+	}
+	eventHub.dispatchBlock(block)
+}
@@ -0,0 +1,166 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	common "github.com/hyperledger/fabric/protos/common"
+)
+
+func TestReconnectBackoff(t *testing.T) {
+	config := ReconnectConfig{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second, Multiplier: 2, Jitter: 0.5}
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for attempt, backoff := range expected {
+		if b := config.backoff(attempt, 0.5); b != backoff {
+			t.Fatalf("Backoff of attempt %d is %s, expected %s", attempt, b, backoff)
+		}
+	}
+	if b := config.backoff(0, 0); b != 500*time.Millisecond {
+		t.Fatalf("Backoff with lowest jitter is %s, expected 500ms", b)
+	}
+	if b := config.backoff(3, 0.99); b <= 5*time.Second || b > 7500*time.Millisecond {
+		t.Fatalf("Backoff with highest jitter is %s, expected in (5s, 7.5s]", b)
+	}
+}
+
+func TestReconnectReplaysMissedBlocks(t *testing.T) {
+	eventServer := newMockEventServer()
+	addr, grpcServer := startMockEventServer(t, eventServer)
+	defer grpcServer.Stop()
+
+	block := func(number uint64) *common.Block {
+		return &common.Block{Header: &common.BlockHeader{Number: number},
+			Data: &common.BlockData{Data: [][]byte{testTransaction(t, fmt.Sprintf("tx%d", number), nil)}}}
+	}
+	// the ledger has the blocks committed while the stream was down
+	ledger := map[uint64]*common.Block{1: block(1), 2: block(2), 3: block(3)}
+
+	eventHub := NewEventHub()
+	eventHub.SetPeerAddr(addr)
+	eventHub.SetReconnectConfig(ReconnectConfig{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 100 * time.Millisecond, Multiplier: 2})
+	eventHub.SetBlockSource(func(number uint64) (*common.Block, error) {
+		if b, ok := ledger[number]; ok {
+			return b, nil
+		}
+		return nil, fmt.Errorf("block %d not found", number)
+	})
+	committed := make(chan string, 10)
+	for i := 1; i <= 4; i++ {
+		eventHub.RegisterTxEvent(fmt.Sprintf("tx%d", i), func(txID string, err error) {
+			if err != nil {
+				t.Errorf("Tx %s failed: %s", txID, err)
+			}
+			committed <- txID
+		})
+	}
+	if err := eventHub.Connect(); err != nil {
+		t.Fatalf("Connect return error[%s]", err)
+	}
+	defer eventHub.Disconnect()
+
+	eventServer.blocks <- block(1)
+	waitForTx(t, committed, "tx1")
+
+	eventServer.drop <- struct{}{}
+	deadline := time.Now().Add(5 * time.Second)
+	for eventServer.getRegistrations() < 2 || !eventHub.Isconnected() {
+		if time.Now().After(deadline) {
+			t.Fatalf("EventHub did not reconnect")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// blocks 2 and 3 are replayed before block 4, which is delivered once
+	eventServer.blocks <- block(4)
+	eventServer.blocks <- block(4)
+	for _, txID := range []string{"tx2", "tx3", "tx4"} {
+		waitForTx(t, committed, txID)
+	}
+	select {
+	case txID := <-committed:
+		t.Fatalf("Unexpected commit of %s", txID)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// no reconnection after Disconnect
+	eventHub.Disconnect()
+	time.Sleep(50 * time.Millisecond)
+	if eventHub.Isconnected() || eventServer.getRegistrations() != 2 {
+		t.Fatalf("EventHub reconnected after Disconnect")
+	}
+}
+
+func TestBlockListenerReAddedIsNotAGap(t *testing.T) {
+	eventServer := newMockEventServer()
+	addr, grpcServer := startMockEventServer(t, eventServer)
+	defer grpcServer.Stop()
+
+	block := func(number uint64) *common.Block {
+		return &common.Block{Header: &common.BlockHeader{Number: number},
+			Data: &common.BlockData{Data: [][]byte{testTransaction(t, fmt.Sprintf("tx%d", number), nil)}}}
+	}
+	fetched := make(chan uint64, 10)
+
+	eventHub := NewEventHub()
+	eventHub.SetPeerAddr(addr)
+	eventHub.SetBlockSource(func(number uint64) (*common.Block, error) {
+		fetched <- number
+		return block(number), nil
+	})
+	if err := eventHub.Connect(); err != nil {
+		t.Fatalf("Connect return error[%s]", err)
+	}
+	defer eventHub.Disconnect()
+
+	received := make(chan *common.Block, 10)
+	listener := func(b *common.Block) {
+		received <- b
+	}
+	cbe := eventHub.RegisterBlockEvent(listener)
+	eventServer.blocks <- block(1)
+	waitForBlock(t, received, 1)
+
+	// the blocks committed while nobody listens are not replayed to the next listener
+	eventHub.UnregisterBlockEvent(cbe)
+	eventHub.RegisterBlockEvent(listener)
+	eventServer.blocks <- block(5)
+	waitForBlock(t, received, 5)
+	select {
+	case number := <-fetched:
+		t.Fatalf("Unexpected fetch of block %d from the block source", number)
+	case b := <-received:
+		t.Fatalf("Unexpected delivery of block %d", b.Header.Number)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func waitForTx(t *testing.T, committed chan string, expected string) {
+	select {
+	case txID := <-committed:
+		if txID != expected {
+			t.Fatalf("Commit of %s, expected %s", txID, expected)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timeout waiting for commit of %s", expected)
+	}
+}
@@ -0,0 +1,348 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sync"
+
+	common "github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// OverflowPolicy tells what a subscription does with an event when its buffer is full
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits for the subscriber to receive, which holds up the delivery of all events
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest discards the oldest buffered event to make room
+	OverflowDropOldest
+	// OverflowError ends the subscription with ErrSubscriptionOverflow
+	OverflowError
+)
+
+// defaultSubscriptionBufferSize is the buffer size of subscriptions which don't set one
+const defaultSubscriptionBufferSize = 100
+
+// ErrSubscriptionOverflow is returned by Unsubscribe when the subscription ended because its buffer was full
+var ErrSubscriptionOverflow = fmt.Errorf("Subscription buffer overflow")
+
+// ErrEventHubDisconnected is returned by Unsubscribe when the subscription ended because the EventHub disconnected
+var ErrEventHubDisconnected = fmt.Errorf("EventHub disconnected")
+
+// SubscriptionOptions ...
+/**
+ * Options of a channel subscription. BufferSize defaults to 100 events and
+ * Overflow to OverflowBlock.
+ */
+type SubscriptionOptions struct {
+	BufferSize int
+	Overflow   OverflowPolicy
+}
+
+// TxEvent is the status of a transaction sent by SubscribeTxEvent: Err is nil if
+// the transaction is committed as valid, a *TxValidationError otherwise. The block
+// number is not set for rejected transactions.
+type TxEvent struct {
+	TxID           string
+	Err            error
+	BlockNumber    uint64
+	ValidationCode TxValidationCode
+}
+
+// Unsubscribe ends a subscription and closes its channel. It returns the reason the subscription
+// ended before, ErrSubscriptionOverflow, ErrEventHubDisconnected or, for a MultiEventHub, an
+// *UnconfirmableBlockError, nil otherwise.
+type Unsubscribe func() error
+
+// subscription delivers events to a buffered channel of any event type
+type subscription struct {
+	mtx      sync.Mutex
+	ch       reflect.Value
+	overflow OverflowPolicy
+	// closed before taking mtx to release a blocked delivery
+	done     chan struct{}
+	doneOnce sync.Once
+	closed   bool
+	err      error
+	// the EventHub the subscription is tracked by, ending it on overflow
+	hub *EventHub
+	// removes the registration feeding the subscription
+	unregister func()
+	// set once the subscription ended, a registration set later is removed right away
+	ended bool
+}
+
+func newSubscription(ch interface{}, overflow OverflowPolicy) *subscription {
+	return &subscription{ch: reflect.ValueOf(ch), overflow: overflow, done: make(chan struct{})}
+}
+
+// setUnregister sets the function removing the registration feeding the subscription,
+// or calls it if the subscription already ended
+func (s *subscription) setUnregister(unregister func()) {
+	s.mtx.Lock()
+	if !s.ended {
+		s.unregister = unregister
+		s.mtx.Unlock()
+		return
+	}
+	s.mtx.Unlock()
+	unregister()
+}
+
+// takeUnregister marks the subscription ended and returns the function removing its
+// registration, nil if there is none or it was already taken
+func (s *subscription) takeUnregister() func() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.ended = true
+	unregister := s.unregister
+	s.unregister = nil
+	return unregister
+}
+
+// bufferSize returns the buffer size set in the options, or the default one
+func (options SubscriptionOptions) bufferSize() int {
+	if options.BufferSize <= 0 {
+		return defaultSubscriptionBufferSize
+	}
+	return options.BufferSize
+}
+
+// deliver sends the event to the channel according to the overflow policy
+func (s *subscription) deliver(event interface{}) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.closed {
+		return
+	}
+	value := reflect.ValueOf(event)
+	switch s.overflow {
+	case OverflowDropOldest:
+		for !s.ch.TrySend(value) {
+			s.ch.TryRecv()
+		}
+	case OverflowError:
+		if !s.ch.TrySend(value) {
+			logger.Warningf("Subscription buffer of %d events is full, ending the subscription\n", s.ch.Cap())
+			s.closeLocked(ErrSubscriptionOverflow)
+			// remove the registration without waiting for the subscriber to unsubscribe, outside
+			// of the delivery which may hold the EventHub lock
+			if s.hub != nil {
+				go s.hub.endSubscription(s, ErrSubscriptionOverflow)
+			}
+		}
+	default:
+		reflect.Select([]reflect.SelectCase{
+			{Dir: reflect.SelectSend, Chan: s.ch, Send: value},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(s.done)},
+		})
+	}
+}
+
+// close ends the subscription, err is the reason reported by Unsubscribe
+func (s *subscription) close(err error) {
+	s.doneOnce.Do(func() { close(s.done) })
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.closeLocked(err)
+}
+
+func (s *subscription) closeLocked(err error) {
+	if s.closed {
+		return
+	}
+	s.doneOnce.Do(func() { close(s.done) })
+	s.closed = true
+	s.err = err
+	s.ch.Close()
+}
+
+// reason returns the reason the subscription ended, nil if it is open or was unsubscribed
+func (s *subscription) reason() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.err
+}
+
+// SubscribeBlocks ...
+/**
+ * Subscribe to the blocks received from the event source.
+ * @param {SubscriptionOptions} options The buffer size and overflow policy.
+ * @returns {chan} The channel of blocks, closed when the subscription ends.
+ * @returns {Unsubscribe} The function ending the subscription.
+ */
+func (eventHub *EventHub) SubscribeBlocks(options SubscriptionOptions) (<-chan *common.Block, Unsubscribe) {
+	ch := make(chan *common.Block, options.bufferSize())
+	s := newSubscription(ch, options.Overflow)
+	unsubscribe := eventHub.addSubscription(s)
+
+	eventHub.mtx.Lock()
+	eventHub.blockSubscriptions = append(eventHub.blockSubscriptions, s)
+	eventHub.mtx.Unlock()
+	eventHub.updateInterests()
+	s.setUnregister(func() {
+		eventHub.mtx.Lock()
+		// build a new slice, the current one may be in use by a dispatch
+		remaining := make([]*subscription, 0, len(eventHub.blockSubscriptions))
+		for _, v := range eventHub.blockSubscriptions {
+			if v != s {
+				remaining = append(remaining, v)
+			}
+		}
+		eventHub.blockSubscriptions = remaining
+		eventHub.mtx.Unlock()
+		eventHub.updateInterests()
+	})
+	return ch, unsubscribe
+}
+
+// SubscribeChaincodeEvents ...
+/**
+ * Subscribe to chaincode events, filtered like for RegisterChaincodeEvent.
+ * @param {string} ccid The chaincode id.
+ * @param {string} eventname The regex used to filter the event names.
+ * @param {SubscriptionOptions} options The buffer size and overflow policy.
+ * @returns {chan} The channel of chaincode events, closed when the subscription ends.
+ * @returns {Unsubscribe} The function ending the subscription.
+ */
+func (eventHub *EventHub) SubscribeChaincodeEvents(ccid string, eventname string, options SubscriptionOptions) (<-chan *pb.ChaincodeEvent, Unsubscribe, error) {
+	if _, err := regexp.Compile(eventname); err != nil {
+		return nil, nil, fmt.Errorf("Invalid event name filter %s: %s", eventname, err)
+	}
+	ch := make(chan *pb.ChaincodeEvent, options.bufferSize())
+	s := newSubscription(ch, options.Overflow)
+	unsubscribe := eventHub.addSubscription(s)
+	cbe := eventHub.RegisterChaincodeEvent(ccid, eventname, func(ccEvent *pb.ChaincodeEvent) {
+		s.deliver(ccEvent)
+	})
+	s.setUnregister(func() { eventHub.UnregisterChaincodeEvent(cbe) })
+	return ch, unsubscribe, nil
+}
+
+// SubscribeTxEvent ...
+/**
+ * Subscribe to the status of a transaction. The channel receives a single
+ * TxEvent and is then closed, so it needs no buffer options.
+ * Like RegisterTxEvent, it replaces any callback registered for the transaction.
+ * @param {string} txID The transaction id.
+ * @returns {chan} The channel of the transaction status.
+ * @returns {Unsubscribe} The function ending the subscription.
+ */
+func (eventHub *EventHub) SubscribeTxEvent(txID string) (<-chan TxEvent, Unsubscribe) {
+	ch := make(chan TxEvent, 1)
+	s := newSubscription(ch, OverflowBlock)
+	unsubscribe := eventHub.addSubscription(s)
+	eventHub.registerTxEvent(txID, "", func(txEvent TxEvent) {
+		s.deliver(txEvent)
+		unsubscribe()
+	})
+	s.setUnregister(func() { eventHub.UnregisterTxEvent(txID) })
+	return ch, unsubscribe
+}
+
+// SubscribeProposalTxEvent ...
+/**
+ * Subscribe to the status of the transaction created from a proposal. Unlike
+ * SubscribeTxEvent, rejections of the transaction are also reported.
+ * @param {Proposal} proposal The proposal the transaction is created from.
+ * @returns {string} The transaction id.
+ * @returns {chan} The channel of the transaction status.
+ * @returns {Unsubscribe} The function ending the subscription.
+ */
+func (eventHub *EventHub) SubscribeProposalTxEvent(proposal *pb.Proposal) (string, <-chan TxEvent, Unsubscribe, error) {
+	txID, nonce, err := proposalTxID(proposal)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	ch := make(chan TxEvent, 1)
+	s := newSubscription(ch, OverflowBlock)
+	unsubscribe := eventHub.addSubscription(s)
+	eventHub.registerTxEvent(txID, nonce, func(txEvent TxEvent) {
+		s.deliver(txEvent)
+		unsubscribe()
+	})
+	s.setUnregister(func() { eventHub.UnregisterTxEvent(txID) })
+	return txID, ch, unsubscribe, nil
+}
+
+/**
+ * private internal tracking of a subscription, to close it on disconnection
+ * @returns {Unsubscribe} The function ending the subscription.
+ */
+func (eventHub *EventHub) addSubscription(s *subscription) Unsubscribe {
+	s.mtx.Lock()
+	s.hub = eventHub
+	s.mtx.Unlock()
+	eventHub.mtx.Lock()
+	eventHub.subscriptions[s] = true
+	eventHub.mtx.Unlock()
+	return func() error {
+		eventHub.endSubscription(s, nil)
+		return s.reason()
+	}
+}
+
+/**
+ * private internal end of a subscription
+ * @param {error} err The reason reported by Unsubscribe, nil when unsubscribed.
+ */
+func (eventHub *EventHub) endSubscription(s *subscription, err error) {
+	eventHub.mtx.Lock()
+	delete(eventHub.subscriptions, s)
+	eventHub.mtx.Unlock()
+	// close first, it releases a delivery blocked on the subscription lock
+	s.close(err)
+	if unregister := s.takeUnregister(); unregister != nil {
+		unregister()
+	}
+}
+
+/**
+ * private internal end of all the subscriptions, when the EventHub disconnects
+ * @param {error} err The reason reported by Unsubscribe.
+ */
+func (eventHub *EventHub) closeSubscriptions(err error) {
+	eventHub.mtx.RLock()
+	subscriptions := make([]*subscription, 0, len(eventHub.subscriptions))
+	for s := range eventHub.subscriptions {
+		subscriptions = append(subscriptions, s)
+	}
+	eventHub.mtx.RUnlock()
+	for _, s := range subscriptions {
+		eventHub.endSubscription(s, err)
+	}
+}
+
+/**
+ * private internal delivery of a block to the block subscriptions
+ * @param {object} block the block from the fabric
+ */
+func (eventHub *EventHub) deliverBlock(block *common.Block) {
+	eventHub.mtx.RLock()
+	blockSubscriptions := eventHub.blockSubscriptions
+	eventHub.mtx.RUnlock()
+	for _, s := range blockSubscriptions {
+		s.deliver(block)
+	}
+}
@@ -0,0 +1,189 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	common "github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func TestSubscribeBlocksOverflow(t *testing.T) {
+	eventHub := NewEventHub()
+	dropOldest, unsubscribeDropOldest := eventHub.SubscribeBlocks(SubscriptionOptions{BufferSize: 2, Overflow: OverflowDropOldest})
+	overflowError, unsubscribeError := eventHub.SubscribeBlocks(SubscriptionOptions{BufferSize: 2, Overflow: OverflowError})
+	blocking, unsubscribeBlocking := eventHub.SubscribeBlocks(SubscriptionOptions{BufferSize: 2})
+	defer unsubscribeDropOldest()
+
+	recvBlock := func(number uint64) {
+		eventHub.Recv(&pb.Event{Event: &pb.Event_Block{Block: &common.Block{Header: &common.BlockHeader{Number: number}}}})
+	}
+	recvBlock(1)
+	recvBlock(2)
+	dispatched := make(chan struct{})
+	go func() {
+		defer close(dispatched)
+		recvBlock(3)
+	}()
+	select {
+	case <-dispatched:
+		t.Fatalf("Dispatch did not wait for the blocking subscriber")
+	case <-time.After(50 * time.Millisecond):
+	}
+	for _, expected := range []uint64{1, 2, 3} {
+		if block := <-blocking; block.Header.Number != expected {
+			t.Fatalf("Blocking subscription received block %d, expected %d", block.Header.Number, expected)
+		}
+	}
+	<-dispatched
+	if err := unsubscribeBlocking(); err != nil {
+		t.Fatalf("Unsubscribe return error[%s]", err)
+	}
+
+	for _, expected := range []uint64{2, 3} {
+		if block := <-dropOldest; block.Header.Number != expected {
+			t.Fatalf("Drop oldest subscription received block %d, expected %d", block.Header.Number, expected)
+		}
+	}
+
+	var received int
+	for range overflowError {
+		received++
+	}
+	if received != 2 {
+		t.Fatalf("Error subscription received %d blocks, expected 2", received)
+	}
+	if err := unsubscribeError(); err != ErrSubscriptionOverflow {
+		t.Fatalf("Unsubscribe returned %v, expected %v", err, ErrSubscriptionOverflow)
+	}
+}
+
+func TestSubscriptionOverflowUnregisters(t *testing.T) {
+	eventHub := NewEventHub()
+	blocks, unsubscribeBlocks := eventHub.SubscribeBlocks(SubscriptionOptions{BufferSize: 1, Overflow: OverflowError})
+	ccEvents, unsubscribeCC, err := eventHub.SubscribeChaincodeEvents("mycc", ".*", SubscriptionOptions{BufferSize: 1, Overflow: OverflowError})
+	if err != nil {
+		t.Fatalf("SubscribeChaincodeEvents return error[%s]", err)
+	}
+	for i := uint64(1); i <= 2; i++ {
+		eventHub.Recv(&pb.Event{Event: &pb.Event_Block{Block: &common.Block{Header: &common.BlockHeader{Number: i}}}})
+		eventHub.Recv(&pb.Event{Event: &pb.Event_ChaincodeEvent{ChaincodeEvent: &pb.ChaincodeEvent{ChaincodeID: "mycc", TxID: fmt.Sprintf("tx%d", i)}}})
+	}
+	for range blocks {
+	}
+	for range ccEvents {
+	}
+
+	// the stalled subscriptions are removed without waiting for Unsubscribe
+	for i := 0; ; i++ {
+		eventHub.mtx.RLock()
+		interests := eventHub.interestsLocked()
+		remaining := len(eventHub.subscriptions) + len(eventHub.blockSubscriptions) + len(eventHub.chaincodeRegistrants)
+		eventHub.mtx.RUnlock()
+		if remaining == 0 && len(interests) == 0 {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("Overflowed subscriptions are still registered, interests %v", interests)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := unsubscribeBlocks(); err != ErrSubscriptionOverflow {
+		t.Fatalf("Unsubscribe returned %v, expected %v", err, ErrSubscriptionOverflow)
+	}
+	if err := unsubscribeCC(); err != ErrSubscriptionOverflow {
+		t.Fatalf("Unsubscribe returned %v, expected %v", err, ErrSubscriptionOverflow)
+	}
+}
+
+func TestSubscribeChaincodeEvents(t *testing.T) {
+	eventHub := NewEventHub()
+	if _, _, err := eventHub.SubscribeChaincodeEvents("mycc", "(", SubscriptionOptions{}); err == nil {
+		t.Fatalf("SubscribeChaincodeEvents accepted an invalid regex")
+	}
+	events, unsubscribe, err := eventHub.SubscribeChaincodeEvents("mycc", "^transfer", SubscriptionOptions{})
+	if err != nil {
+		t.Fatalf("SubscribeChaincodeEvents return error[%s]", err)
+	}
+	for i, name := range []string{"transfer", "issue", "transferred"} {
+		eventHub.Recv(&pb.Event{Event: &pb.Event_ChaincodeEvent{ChaincodeEvent: &pb.ChaincodeEvent{ChaincodeID: "mycc", TxID: fmt.Sprintf("tx%d", i), EventName: name}}})
+	}
+	if err := unsubscribe(); err != nil {
+		t.Fatalf("Unsubscribe return error[%s]", err)
+	}
+	var received []string
+	for ccEvent := range events {
+		received = append(received, ccEvent.EventName)
+	}
+	if len(received) != 2 || received[0] != "transfer" || received[1] != "transferred" {
+		t.Fatalf("Received %v, expected [transfer transferred]", received)
+	}
+	if len(eventHub.chaincodeRegistrants) != 0 {
+		t.Fatalf("Unsubscribe did not unregister the chaincode event")
+	}
+}
+
+func TestSubscribeTxEvent(t *testing.T) {
+	eventHub := NewEventHub()
+	txEvents, unsubscribe := eventHub.SubscribeTxEvent("tx1")
+	block := &common.Block{Header: &common.BlockHeader{Number: 1}, Data: &common.BlockData{Data: [][]byte{testTransaction(t, "tx1", nil)}},
+		Metadata: &common.BlockMetadata{Metadata: [][]byte{{}, {}, {byte(TxValidationCode_MVCC_READ_CONFLICT)}}}}
+	eventHub.Recv(&pb.Event{Event: &pb.Event_Block{Block: block}})
+
+	txEvent, ok := <-txEvents
+	if !ok || txEvent.TxID != "tx1" {
+		t.Fatalf("Received %v, expected the event of tx1", txEvent)
+	}
+	if err, ok := txEvent.Err.(*TxValidationError); !ok || err.Code != TxValidationCode_MVCC_READ_CONFLICT {
+		t.Fatalf("Received error %v, expected MVCC_READ_CONFLICT", txEvent.Err)
+	}
+	if _, ok := <-txEvents; ok {
+		t.Fatalf("Tx event channel is not closed after the event")
+	}
+	if err := unsubscribe(); err != nil {
+		t.Fatalf("Unsubscribe return error[%s]", err)
+	}
+	if len(eventHub.txRegistrants) != 0 {
+		t.Fatalf("Tx event is still registered")
+	}
+}
+
+func TestSubscriptionsClosedOnDisconnect(t *testing.T) {
+	eventHub := NewEventHub()
+	blocks, unsubscribeBlocks := eventHub.SubscribeBlocks(SubscriptionOptions{})
+	txEvents, unsubscribeTx := eventHub.SubscribeTxEvent("tx1")
+	eventHub.Disconnect()
+
+	if _, ok := <-blocks; ok {
+		t.Fatalf("Block channel is not closed on disconnection")
+	}
+	if _, ok := <-txEvents; ok {
+		t.Fatalf("Tx event channel is not closed on disconnection")
+	}
+	if err := unsubscribeBlocks(); err != ErrEventHubDisconnected {
+		t.Fatalf("Unsubscribe returned %v, expected %v", err, ErrEventHubDisconnected)
+	}
+	if err := unsubscribeTx(); err != ErrEventHubDisconnected {
+		t.Fatalf("Unsubscribe returned %v, expected %v", err, ErrEventHubDisconnected)
+	}
+}
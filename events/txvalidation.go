@@ -0,0 +1,143 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"fmt"
+
+	common "github.com/hyperledger/fabric/protos/common"
+)
+
+// TxValidationCode is the validation result the committing peer recorded for a transaction.
+// The values follow the TxValidationCode enum of the fabric protos.
+type TxValidationCode int32
+
+// Transaction validation codes
+const (
+	TxValidationCode_VALID                        TxValidationCode = 0
+	TxValidationCode_NIL_ENVELOPE                 TxValidationCode = 1
+	TxValidationCode_BAD_PAYLOAD                  TxValidationCode = 2
+	TxValidationCode_BAD_COMMON_HEADER            TxValidationCode = 3
+	TxValidationCode_BAD_CREATOR_SIGNATURE        TxValidationCode = 4
+	TxValidationCode_INVALID_ENDORSER_TRANSACTION TxValidationCode = 5
+	TxValidationCode_INVALID_CONFIG_TRANSACTION   TxValidationCode = 6
+	TxValidationCode_UNSUPPORTED_TX_PAYLOAD       TxValidationCode = 7
+	TxValidationCode_BAD_PROPOSAL_TXID            TxValidationCode = 8
+	TxValidationCode_DUPLICATE_TXID               TxValidationCode = 9
+	TxValidationCode_ENDORSEMENT_POLICY_FAILURE   TxValidationCode = 10
+	TxValidationCode_MVCC_READ_CONFLICT           TxValidationCode = 11
+	TxValidationCode_PHANTOM_READ_CONFLICT        TxValidationCode = 12
+	TxValidationCode_UNKNOWN_TX_TYPE              TxValidationCode = 13
+	TxValidationCode_TARGET_CHAIN_NOT_FOUND       TxValidationCode = 14
+	TxValidationCode_MARSHAL_TX_ERROR             TxValidationCode = 15
+	TxValidationCode_NIL_TXACTION                 TxValidationCode = 16
+	TxValidationCode_INVALID_OTHER_REASON         TxValidationCode = 255
+)
+
+var txValidationCodeNames = map[TxValidationCode]string{
+	TxValidationCode_VALID:                        "VALID",
+	TxValidationCode_NIL_ENVELOPE:                 "NIL_ENVELOPE",
+	TxValidationCode_BAD_PAYLOAD:                  "BAD_PAYLOAD",
+	TxValidationCode_BAD_COMMON_HEADER:            "BAD_COMMON_HEADER",
+	TxValidationCode_BAD_CREATOR_SIGNATURE:        "BAD_CREATOR_SIGNATURE",
+	TxValidationCode_INVALID_ENDORSER_TRANSACTION: "INVALID_ENDORSER_TRANSACTION",
+	TxValidationCode_INVALID_CONFIG_TRANSACTION:   "INVALID_CONFIG_TRANSACTION",
+	TxValidationCode_UNSUPPORTED_TX_PAYLOAD:       "UNSUPPORTED_TX_PAYLOAD",
+	TxValidationCode_BAD_PROPOSAL_TXID:            "BAD_PROPOSAL_TXID",
+	TxValidationCode_DUPLICATE_TXID:               "DUPLICATE_TXID",
+	TxValidationCode_ENDORSEMENT_POLICY_FAILURE:   "ENDORSEMENT_POLICY_FAILURE",
+	TxValidationCode_MVCC_READ_CONFLICT:           "MVCC_READ_CONFLICT",
+	TxValidationCode_PHANTOM_READ_CONFLICT:        "PHANTOM_READ_CONFLICT",
+	TxValidationCode_UNKNOWN_TX_TYPE:              "UNKNOWN_TX_TYPE",
+	TxValidationCode_TARGET_CHAIN_NOT_FOUND:       "TARGET_CHAIN_NOT_FOUND",
+	TxValidationCode_MARSHAL_TX_ERROR:             "MARSHAL_TX_ERROR",
+	TxValidationCode_NIL_TXACTION:                 "NIL_TXACTION",
+	TxValidationCode_INVALID_OTHER_REASON:         "INVALID_OTHER_REASON",
+}
+
+// String returns the name of the validation code
+func (code TxValidationCode) String() string {
+	if name, ok := txValidationCodeNames[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("TxValidationCode(%d)", int32(code))
+}
+
+// TxValidationError ...
+/**
+ * The error passed to transaction callbacks when the transaction was invalidated
+ * by the committing peer or rejected before being committed.
+ */
+type TxValidationError struct {
+	// validation code of the transaction
+	Code TxValidationCode
+	// transaction id
+	TxID string
+	// number of the block holding the transaction, not set for rejections
+	BlockNumber uint64
+	// error message of a rejection
+	Message string
+}
+
+// Error describes the invalid transaction
+func (e *TxValidationError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("Transaction %s was rejected with code %s: %s", e.TxID, e.Code, e.Message)
+	}
+	return fmt.Sprintf("Transaction %s in block %d is invalid with code %s", e.TxID, e.BlockNumber, e.Code)
+}
+
+// GetTxValidationCodes ...
+/**
+ * Decodes the validation code of each transaction of a block from its TRANSACTIONS_FILTER metadata.
+ * The filter holds either one validation code byte per transaction, or a bit array where a set bit
+ * marks an invalid transaction; transactions marked in a bit array get TxValidationCode_INVALID_OTHER_REASON.
+ * All the transactions are valid when the block has no filter.
+ * @param {Block} block The committed block.
+ * @returns {[]TxValidationCode} The validation codes, indexed like the block data.
+ */
+func GetTxValidationCodes(block *common.Block) ([]TxValidationCode, error) {
+	if block == nil || block.Data == nil {
+		return nil, fmt.Errorf("block is nil")
+	}
+	count := len(block.Data.Data)
+	codes := make([]TxValidationCode, count)
+
+	var filter []byte
+	if block.Metadata != nil && len(block.Metadata.Metadata) > int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		filter = block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+	}
+	switch {
+	case len(filter) == 0:
+	case len(filter) == count:
+		for i, code := range filter {
+			codes[i] = TxValidationCode(code)
+		}
+	case len(filter) == (count+7)/8:
+		for i := range codes {
+			if filter[i/8]&(1<<uint(i%8)) != 0 {
+				codes[i] = TxValidationCode_INVALID_OTHER_REASON
+			}
+		}
+	default:
+		return nil, fmt.Errorf("transactions filter has %d bytes for %d transactions", len(filter), count)
+	}
+	return codes, nil
+}
@@ -0,0 +1,132 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	common "github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func TestGetTxValidationCodes(t *testing.T) {
+	data := make([][]byte, 10)
+	tests := []struct {
+		filter   []byte
+		expected []TxValidationCode
+		err      string
+	}{
+		{nil, make([]TxValidationCode, 10), ""},
+		{[]byte{0, 11, 0, 0, 0, 0, 0, 0, 0, 10}, []TxValidationCode{0, 11, 0, 0, 0, 0, 0, 0, 0, 10}, ""},
+		{[]byte{0x04, 0x02}, []TxValidationCode{0, 0, 255, 0, 0, 0, 0, 0, 0, 255}, ""},
+		{[]byte{0, 0, 0}, nil, "transactions filter has 3 bytes for 10 transactions"},
+	}
+	for _, test := range tests {
+		block := &common.Block{Data: &common.BlockData{Data: data},
+			Metadata: &common.BlockMetadata{Metadata: [][]byte{nil, nil, test.filter}}}
+		codes, err := GetTxValidationCodes(block)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Fatalf("GetTxValidationCodes didn't return the expected error, got %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("GetTxValidationCodes return error[%s]", err)
+		}
+		if !reflect.DeepEqual(codes, test.expected) {
+			t.Fatalf("GetTxValidationCodes return %v, expected %v", codes, test.expected)
+		}
+	}
+	if TxValidationCode_MVCC_READ_CONFLICT.String() != "MVCC_READ_CONFLICT" || TxValidationCode(42).String() != "TxValidationCode(42)" {
+		t.Fatalf("Unexpected TxValidationCode names")
+	}
+}
+
+func TestTxCallbackValidationCodes(t *testing.T) {
+	eventHub := NewEventHub()
+	results := make(map[string]error)
+	for _, txID := range []string{"tx1", "tx2"} {
+		eventHub.RegisterTxEvent(txID, func(txID string, err error) {
+			results[txID] = err
+		})
+	}
+	block := &common.Block{Header: &common.BlockHeader{Number: 7}, Data: &common.BlockData{Data: [][]byte{
+		testTransaction(t, "tx1", nil),
+		testTransaction(t, "tx2", &pb.ChaincodeEvent{ChaincodeID: "mycc", EventName: "evt"}),
+	}}, Metadata: &common.BlockMetadata{Metadata: [][]byte{nil, nil, {0, byte(TxValidationCode_MVCC_READ_CONFLICT)}}}}
+
+	var events int
+	eventHub.RegisterChaincodeEvent("mycc", ".*", func(*pb.ChaincodeEvent) { events++ })
+	eventHub.Recv(&pb.Event{Event: &pb.Event_Block{Block: block}})
+
+	if err, ok := results["tx1"]; !ok || err != nil {
+		t.Fatalf("tx1 was not reported as valid, got %v", err)
+	}
+	expected := &TxValidationError{Code: TxValidationCode_MVCC_READ_CONFLICT, TxID: "tx2", BlockNumber: 7}
+	if !reflect.DeepEqual(results["tx2"], expected) {
+		t.Fatalf("tx2 was reported with %v, expected %v", results["tx2"], expected)
+	}
+	if results["tx2"].Error() != "Transaction tx2 in block 7 is invalid with code MVCC_READ_CONFLICT" {
+		t.Fatalf("Unexpected error message %s", results["tx2"])
+	}
+	if events != 0 {
+		t.Fatalf("The chaincode event of an invalid transaction was delivered")
+	}
+}
+
+func TestTxCallbackRejection(t *testing.T) {
+	eventHub := NewEventHub()
+	nonce := []byte("nonce")
+	header, err := proto.Marshal(&common.Header{ChainHeader: &common.ChainHeader{TxID: "tx1"},
+		SignatureHeader: &common.SignatureHeader{Nonce: nonce}})
+	if err != nil {
+		t.Fatalf("Marshal return error[%s]", err)
+	}
+	var rejected error
+	txID, err := eventHub.RegisterProposalTxEvent(&pb.Proposal{Header: header}, func(txID string, err error) {
+		rejected = err
+	})
+	if err != nil || txID != "tx1" {
+		t.Fatalf("RegisterProposalTxEvent return %s, error[%v]", txID, err)
+	}
+
+	sigHdr, err := proto.Marshal(&common.SignatureHeader{Nonce: nonce})
+	if err != nil {
+		t.Fatalf("Marshal return error[%s]", err)
+	}
+	eventHub.Recv(&pb.Event{Event: &pb.Event_Rejection{Rejection: &pb.Rejection{
+		Tx: &pb.Transaction{Actions: []*pb.TransactionAction{{Header: sigHdr}}}, ErrorMsg: "bad signature"}}})
+	expected := &TxValidationError{Code: TxValidationCode_INVALID_OTHER_REASON, TxID: "tx1", Message: "bad signature"}
+	if !reflect.DeepEqual(rejected, expected) {
+		t.Fatalf("Rejection was reported with %v, expected %v", rejected, expected)
+	}
+
+	// once unregistered the rejection can't be matched anymore
+	rejected = nil
+	eventHub.UnregisterTxEvent("tx1")
+	eventHub.Recv(&pb.Event{Event: &pb.Event_Rejection{Rejection: &pb.Rejection{
+		Tx: &pb.Transaction{Actions: []*pb.TransactionAction{{Header: sigHdr}}}, ErrorMsg: "bad signature"}}})
+	if rejected != nil || len(eventHub.txNonces) != 0 {
+		t.Fatalf("Rejection was reported after unregistering")
+	}
+}
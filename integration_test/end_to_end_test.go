@@ -20,7 +20,6 @@ limitations under the License.
 package integration_test
 
 import (
-	"encoding/pem"
 	"fmt"
 	"strconv"
 	"testing"
@@ -32,11 +31,8 @@ import (
 	config "github.com/hyperledger/fabric-sdk-go/config"
 	kvs "github.com/hyperledger/fabric-sdk-go/keyvaluestore"
 	msp "github.com/hyperledger/fabric-sdk-go/msp"
-	"github.com/hyperledger/fabric/bccsp"
-	bccspFactory "github.com/hyperledger/fabric/bccsp/factory"
 	"github.com/hyperledger/fabric/common/util"
 
-	"github.com/hyperledger/fabric/bccsp/sw"
 	pb "github.com/hyperledger/fabric/protos/peer"
 )
 
@@ -51,15 +47,9 @@ func TestChainCodeInvoke(t *testing.T) {
 		t.Fatalf("Failed eventHub.Connect() [%s]", err)
 	}
 	client := fabric_sdk.NewClient()
-	ks := &sw.FileBasedKeyStore{}
-	if err := ks.Init(nil, config.GetKeyStorePath(), false); err != nil {
-		t.Fatalf("Failed initializing key store [%s]", err)
-	}
-
-	cryptoSuite, err := bccspFactory.GetBCCSP(&bccspFactory.SwOpts{Ephemeral_: true, SecLevel: config.GetSecurityLevel(),
-		HashFamily: config.GetSecurityAlgorithm(), KeyStore: ks})
+	cryptoSuite, err := fabric_sdk.NewCryptoSuiteFromConfig()
 	if err != nil {
-		t.Fatalf("Failed getting ephemeral software-based BCCSP [%s]", err)
+		t.Fatalf("NewCryptoSuiteFromConfig return error[%s]", err)
 	}
 	client.SetCryptoSuite(cryptoSuite)
 	stateStore, err := kvs.CreateNewFileKeyValueStore("/tmp/enroll_user")
@@ -76,17 +66,14 @@ func TestChainCodeInvoke(t *testing.T) {
 		if err1 != nil {
 			t.Fatalf("NewFabricCOPServices return error: %v", err)
 		}
-		key, cert, err1 := msps.Enroll("testUser", "user1")
-		keyPem, _ := pem.Decode(key)
+		msps.SetCryptoSuite(client.GetCryptoSuite())
+		msps.SetKeyStorePath(config.GetKeyStorePath())
+		key, cert, err1 := msps.EnrollWithCryptoSuite("testUser", "user1")
 		if err1 != nil {
-			t.Fatalf("Enroll return error: %v", err)
+			t.Fatalf("EnrollWithCryptoSuite return error: %v", err1)
 		}
 		user := fabric_sdk.NewUser("testUser")
-		k, err1 := client.GetCryptoSuite().KeyImport(keyPem.Bytes, &bccsp.ECDSAPrivateKeyImportOpts{Temporary: false})
-		if err1 != nil {
-			t.Fatalf("KeyImport return error: %v", err)
-		}
-		user.SetPrivateKey(k)
+		user.SetPrivateKey(key)
 		user.SetEnrollmentCertificate(cert)
 		err = client.SetUserContext(user, false)
 		if err != nil {
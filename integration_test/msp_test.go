@@ -27,9 +27,6 @@ import (
 	fabric_sdk "github.com/hyperledger/fabric-sdk-go"
 	config "github.com/hyperledger/fabric-sdk-go/config"
 	kvs "github.com/hyperledger/fabric-sdk-go/keyvaluestore"
-	"github.com/hyperledger/fabric/bccsp"
-	bccspFactory "github.com/hyperledger/fabric/bccsp/factory"
-	"github.com/hyperledger/fabric/bccsp/sw"
 
 	msp "github.com/hyperledger/fabric-sdk-go/msp"
 )
@@ -41,15 +38,9 @@ import (
 func TestEnroll(t *testing.T) {
 	InitConfigForMsp()
 	client := fabric_sdk.NewClient()
-	ks := &sw.FileBasedKeyStore{}
-	if err := ks.Init(nil, config.GetKeyStorePath(), false); err != nil {
-		t.Fatalf("Failed initializing key store [%s]", err)
-	}
-
-	cryptoSuite, err := bccspFactory.GetBCCSP(&bccspFactory.SwOpts{Ephemeral_: true, SecLevel: config.GetSecurityLevel(),
-		HashFamily: config.GetSecurityAlgorithm(), KeyStore: ks})
+	cryptoSuite, err := fabric_sdk.NewCryptoSuiteFromConfig()
 	if err != nil {
-		t.Fatalf("Failed getting ephemeral software-based BCCSP [%s]", err)
+		t.Fatalf("NewCryptoSuiteFromConfig return error[%s]", err)
 	}
 	client.SetCryptoSuite(cryptoSuite)
 	stateStore, err := kvs.CreateNewFileKeyValueStore("/tmp/enroll_user")
@@ -62,15 +53,17 @@ func TestEnroll(t *testing.T) {
 	if err != nil {
 		t.Fatalf("NewMSPServices return error: %v", err)
 	}
-	key, cert, err := msps.Enroll("testUser2", "user2")
+	msps.SetCryptoSuite(client.GetCryptoSuite())
+	msps.SetKeyStorePath(config.GetKeyStorePath())
+	key, cert, err := msps.EnrollWithCryptoSuite("testUser2", "user2")
 	if err != nil {
-		t.Fatalf("Enroll return error: %v", err)
+		t.Fatalf("EnrollWithCryptoSuite return error: %v", err)
 	}
 	if key == nil {
-		t.Fatalf("private key return from Enroll is nil")
+		t.Fatalf("private key return from EnrollWithCryptoSuite is nil")
 	}
 	if cert == nil {
-		t.Fatalf("cert return from Enroll is nil")
+		t.Fatalf("cert return from EnrollWithCryptoSuite is nil")
 	}
 
 	certPem, _ := pem.Decode(cert)
@@ -86,16 +79,8 @@ func TestEnroll(t *testing.T) {
 		t.Fatalf("CommonName in x509 cert is not the enrollmentID")
 	}
 
-	keyPem, _ := pem.Decode(key)
-	if err != nil {
-		t.Fatalf("pem Decode return error: %v", err)
-	}
 	user := fabric_sdk.NewUser("testUser2")
-	k, err := client.GetCryptoSuite().KeyImport(keyPem.Bytes, &bccsp.ECDSAPrivateKeyImportOpts{Temporary: false})
-	if err != nil {
-		t.Fatalf("KeyImport return error: %v", err)
-	}
-	user.SetPrivateKey(k)
+	user.SetPrivateKey(key)
 	user.SetEnrollmentCertificate(cert)
 	err = client.SetUserContext(user, false)
 	if err != nil {
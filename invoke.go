@@ -0,0 +1,152 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"fmt"
+
+	events "github.com/hyperledger/fabric-sdk-go/events"
+	"github.com/hyperledger/fabric/common/util"
+	"github.com/hyperledger/fabric/protos/common"
+	"golang.org/x/net/context"
+)
+
+// InvokeRequest ...
+/**
+ * The chaincode invocation sent by Chain.Invoke.
+ */
+type InvokeRequest struct {
+	ChaincodeName string
+	Args          []string
+	TransientData []byte
+	// EventHub notified of the commit, the event source of the chain if nil
+	EventHub *events.EventHub
+	// Policy the endorsements must satisfy, optional
+	Policy *common.SignaturePolicyEnvelope
+	// Consistency tells whether to fail or to drop the minority endorsers when their responses diverge
+	Consistency ResponseConsistency
+	// User invoking the chaincode, the user context of the client if nil
+	User *User
+}
+
+// InvokeResult ...
+/**
+ * The outcome of a transaction sent by Chain.Invoke.
+ */
+type InvokeResult struct {
+	TxID string
+	// Payload of the chaincode response
+	Payload []byte
+	// BlockNumber of the block holding the transaction, not set for rejected transactions
+	BlockNumber    uint64
+	ValidationCode events.TxValidationCode
+}
+
+// Invoke ...
+/**
+ * Invokes a chaincode and waits for the transaction to be committed: the proposal
+ * is endorsed by the peers of the chain, the transaction sent to the orderers, and
+ * the commit reported by the event hub.
+ * @param {Context} ctx The context used to cancel the invocation or set its deadline.
+ * @param {InvokeRequest} request The chaincode invocation.
+ * @returns {InvokeResult} The transaction outcome. It is also returned, with a
+ * *events.TxValidationError, when the transaction is invalid, and with the context
+ * error, holding only the transaction id and payload, when the context is done
+ * before the commit.
+ */
+func (c *Chain) Invoke(ctx context.Context, request InvokeRequest) (*InvokeResult, error) {
+	if request.ChaincodeName == "" {
+		return nil, fmt.Errorf("ChaincodeName is empty")
+	}
+	eventHub := request.EventHub
+	if eventHub == nil {
+		eventSource, err := c.GetEventSource()
+		if err != nil {
+			return nil, err
+		}
+		eventHub = eventSource.GetEventHub()
+	}
+
+	user := request.User
+	if user == nil {
+		var err error
+		if user, err = c.clientContext.GetUserContext(""); err != nil {
+			return nil, fmt.Errorf("GetUserContext return error: %s", err)
+		}
+	}
+	signedProposal, proposal, err := c.CreateTransactionProposalForUser(user, request.ChaincodeName, c.name, request.Args, true,
+		util.GenerateUUID(), request.TransientData)
+	if err != nil {
+		return nil, fmt.Errorf("CreateTransactionProposal return error: %v", err)
+	}
+	// listen before sending, so that the commit can't be missed
+	txID, txEvents, unsubscribe, err := eventHub.SubscribeProposalTxEvent(proposal)
+	if err != nil {
+		return nil, err
+	}
+	defer unsubscribe()
+
+	responses, err := c.SendTransactionProposal(signedProposal, 0)
+	if err != nil {
+		return nil, fmt.Errorf("SendTransactionProposal return error: %v", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var policies []*common.SignaturePolicyEnvelope
+	if request.Policy != nil {
+		policies = append(policies, request.Policy)
+	}
+	tx, endorsements, err := c.CreateTransactionFromResponses(proposal, responses, request.Consistency, policies...)
+	if err != nil {
+		return nil, fmt.Errorf("CreateTransaction return error: %v", err)
+	}
+	result := &InvokeResult{TxID: txID, Payload: endorsements[0].ProposalResponse.Response.Payload}
+	transactionResponses, err := c.SendTransactionForUser(user, proposal, tx)
+	if err != nil {
+		return nil, fmt.Errorf("SendTransaction return error: %v", err)
+	}
+	// the transaction is ordered if any orderer accepted it
+	var ordered bool
+	var ordererErr error
+	for _, v := range transactionResponses {
+		if v.Err != nil {
+			logger.Warningf("Orderer %s return error: %v", v.Orderer, v.Err)
+			ordererErr = v.Err
+		} else {
+			ordered = true
+		}
+	}
+	if !ordered {
+		return nil, fmt.Errorf("SendTransaction return error: %v", ordererErr)
+	}
+
+	select {
+	case txEvent, ok := <-txEvents:
+		if !ok {
+			return nil, fmt.Errorf("Stopped waiting for the commit of transaction %s: %v", txID, unsubscribe())
+		}
+		result.BlockNumber = txEvent.BlockNumber
+		result.ValidationCode = txEvent.ValidationCode
+		return result, txEvent.Err
+	case <-ctx.Done():
+		return result, ctx.Err()
+	}
+}
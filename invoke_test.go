@@ -0,0 +1,115 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	events "github.com/hyperledger/fabric-sdk-go/events"
+	"github.com/hyperledger/fabric/protos/common"
+	mb "github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"golang.org/x/net/context"
+)
+
+func TestInvoke(t *testing.T) {
+	client := setupTestClient(t)
+	chain, err := client.NewChain("testChain-invoke")
+	if err != nil {
+		t.Fatalf("NewChain return error[%s]", err)
+	}
+	response, mspConfig := signedProposalResponse(t, client.GetCryptoSuite(), "Org1MSP", []byte("payload"))
+	response.Response.Payload = []byte("result")
+	chain.SetMSPs([]*mb.MSPConfig{mspConfig})
+	endorserAddr, endorserGrpcServer := startMockEndorserServer(t, &mockEndorserServer{response: response})
+	defer endorserGrpcServer.Stop()
+	broadcastServer := &mockBroadcastServer{status: common.Status_SUCCESS}
+	ordererAddr, ordererGrpcServer := startMockBroadcastServer(t, broadcastServer)
+	defer ordererGrpcServer.Stop()
+	chain.AddPeer(CreateNewPeer(endorserAddr))
+	chain.AddOrderer(CreateNewOrderer(ordererAddr))
+
+	eventHub := events.NewEventHub()
+	request := InvokeRequest{ChaincodeName: "mycc", Args: []string{"invoke", "move", "a", "b", "1"}, EventHub: eventHub}
+	if _, err := chain.Invoke(context.Background(), InvokeRequest{EventHub: eventHub}); err == nil || err.Error() != "ChaincodeName is empty" {
+		t.Fatalf("Invoke didn't return right error: %v", err)
+	}
+
+	// the transaction is committed as valid in block 7
+	go commitTransactions(t, broadcastServer, eventHub, 1, events.TxValidationCode_VALID)
+	result, err := chain.Invoke(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Invoke return error[%s]", err)
+	}
+	if result.TxID == "" || string(result.Payload) != "result" || result.BlockNumber != 7 || result.ValidationCode != events.TxValidationCode_VALID {
+		t.Fatalf("Invoke returned wrong result %v", result)
+	}
+	checkNoInterests(t, eventHub)
+
+	// the transaction is invalidated
+	go commitTransactions(t, broadcastServer, eventHub, 2, events.TxValidationCode_MVCC_READ_CONFLICT)
+	result, err = chain.Invoke(context.Background(), request)
+	if _, ok := err.(*events.TxValidationError); !ok {
+		t.Fatalf("Invoke didn't return a validation error: %v", err)
+	}
+	if result == nil || result.ValidationCode != events.TxValidationCode_MVCC_READ_CONFLICT {
+		t.Fatalf("Invoke returned wrong result %v", result)
+	}
+	checkNoInterests(t, eventHub)
+
+	// the transaction is never committed
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	result, err = chain.Invoke(ctx, request)
+	if err != context.DeadlineExceeded || result == nil || result.TxID == "" {
+		t.Fatalf("Invoke returned %v, %v, expected the transaction id and %v", result, err, context.DeadlineExceeded)
+	}
+	checkNoInterests(t, eventHub)
+}
+
+// commitTransactions waits for the orderer to receive the given number of transactions
+// and reports the last one to the event hub as committed with the validation code
+func commitTransactions(t *testing.T, broadcastServer *mockBroadcastServer, eventHub *events.EventHub, count int, code events.TxValidationCode) {
+	for len(broadcastServer.getEnvelopes()) < count {
+		time.Sleep(10 * time.Millisecond)
+	}
+	envelopes := broadcastServer.getEnvelopes()
+	data, err := proto.Marshal(envelopes[count-1])
+	if err != nil {
+		t.Errorf("Marshal return error[%s]", err)
+		return
+	}
+	block := &common.Block{Header: &common.BlockHeader{Number: uint64(6 + count)}, Data: &common.BlockData{Data: [][]byte{data}},
+		Metadata: &common.BlockMetadata{Metadata: [][]byte{{}, {}, {byte(code)}}}}
+	eventHub.Recv(&pb.Event{Event: &pb.Event_Block{Block: block}})
+}
+
+// checkNoInterests verifies that no listener is left on the event hub
+func checkNoInterests(t *testing.T, eventHub *events.EventHub) {
+	interests, err := eventHub.GetInterestedEvents()
+	if err != nil {
+		t.Fatalf("GetInterestedEvents return error[%s]", err)
+	}
+	if len(interests) != 0 {
+		t.Fatalf("Invoke left listeners on the event hub: %v", interests)
+	}
+}
@@ -51,10 +51,14 @@ func CreateNewFileKeyValueStore(path string) (*FileKeyValueStore, error) {
  * Get the value associated with name.
  * @param {string} name
  * @returns []byte for the value
+ * @returns {error} ErrNotFound if no value is associated with name
  */
 func (fkvs *FileKeyValueStore) GetValue(key string) ([]byte, error) {
 	file := path.Join(fkvs.path, key+".json")
 	value, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
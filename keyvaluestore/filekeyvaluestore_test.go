@@ -36,5 +36,8 @@ func TestFKVSMethods(t *testing.T) {
 	if string(value) != "data" {
 		t.Fatalf("stateStore.GetValue didn't return the right value")
 	}
+	if _, err := stateStore.GetValue("missingvalue"); err != ErrNotFound {
+		t.Fatalf("stateStore.GetValue returned %v for a missing key, expected ErrNotFound", err)
+	}
 
 }
@@ -19,6 +19,11 @@ limitations under the License.
 
 package keyvaluestore
 
+import "fmt"
+
+// ErrNotFound is returned by GetValue when no value is associated with the key
+var ErrNotFound = fmt.Errorf("key not found in the key value store")
+
 // KeyValueStore ...
 /**
  * Abstract class for a Key-Value store. The Chain class uses this store
@@ -32,6 +37,7 @@ type KeyValueStore interface {
 	 *
 	 * @param {string} name of the key
 	 * @returns {[]byte}
+	 * @returns {error} ErrNotFound if no value is associated with name
 	 */
 	GetValue(key string) ([]byte, error)
 
@@ -0,0 +1,126 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/protos/common"
+	ab "github.com/hyperledger/fabric/protos/orderer"
+	protos_utils "github.com/hyperledger/fabric/protos/utils"
+	"google.golang.org/grpc"
+)
+
+// mockBroadcastServer is an in-process AtomicBroadcast server that records
+// the envelopes it receives and replies with a configurable status. Deliver
+// serves the configured blocks.
+type mockBroadcastServer struct {
+	sync.Mutex
+	status    common.Status
+	envelopes []*common.Envelope
+	blocks    []*common.Block
+}
+
+func (m *mockBroadcastServer) Broadcast(server ab.AtomicBroadcast_BroadcastServer) error {
+	for {
+		envelope, err := server.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		m.Lock()
+		m.envelopes = append(m.envelopes, envelope)
+		status := m.status
+		m.Unlock()
+		if err := server.Send(&ab.BroadcastResponse{Status: status}); err != nil {
+			return err
+		}
+	}
+}
+
+func (m *mockBroadcastServer) Deliver(server ab.AtomicBroadcast_DeliverServer) error {
+	envelope, err := server.Recv()
+	if err != nil {
+		return err
+	}
+	m.Lock()
+	m.envelopes = append(m.envelopes, envelope)
+	blocks := m.blocks
+	m.Unlock()
+
+	payload, err := protos_utils.GetPayload(envelope)
+	if err != nil {
+		return err
+	}
+	seekInfo := &ab.SeekInfo{}
+	if err := proto.Unmarshal(payload.Data, seekInfo); err != nil {
+		return err
+	}
+	if len(blocks) == 0 {
+		return server.Send(&ab.DeliverResponse{Type: &ab.DeliverResponse_Status{Status: common.Status_NOT_FOUND}})
+	}
+	start := seekPositionToNumber(seekInfo.Start, blocks)
+	stop := seekPositionToNumber(seekInfo.Stop, blocks)
+	if start > stop || stop >= uint64(len(blocks)) {
+		return server.Send(&ab.DeliverResponse{Type: &ab.DeliverResponse_Status{Status: common.Status_BAD_REQUEST}})
+	}
+	for _, block := range blocks[start : stop+1] {
+		if err := server.Send(&ab.DeliverResponse{Type: &ab.DeliverResponse_Block{Block: block}}); err != nil {
+			return err
+		}
+	}
+	return server.Send(&ab.DeliverResponse{Type: &ab.DeliverResponse_Status{Status: common.Status_SUCCESS}})
+}
+
+func seekPositionToNumber(position *ab.SeekPosition, blocks []*common.Block) uint64 {
+	switch t := position.Type.(type) {
+	case *ab.SeekPosition_Oldest:
+		return 0
+	case *ab.SeekPosition_Newest:
+		return uint64(len(blocks) - 1)
+	case *ab.SeekPosition_Specified:
+		return t.Specified.Number
+	}
+	return 0
+}
+
+func (m *mockBroadcastServer) getEnvelopes() []*common.Envelope {
+	m.Lock()
+	defer m.Unlock()
+	return m.envelopes
+}
+
+// startMockBroadcastServer starts the mock server on a random local port and returns its address
+func startMockBroadcastServer(t *testing.T, broadcastServer ab.AtomicBroadcastServer) (string, *grpc.Server) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	grpcServer := grpc.NewServer()
+	ab.RegisterAtomicBroadcastServer(grpcServer, broadcastServer)
+	go grpcServer.Serve(lis)
+	return lis.Addr().String(), grpcServer
+}
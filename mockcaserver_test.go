@@ -0,0 +1,165 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	cfsslapi "github.com/cloudflare/cfssl/api"
+	"github.com/hyperledger/fabric-ca/api"
+	"github.com/hyperledger/fabric-ca/lib/tcert"
+	"github.com/hyperledger/fabric-ca/util"
+	mspservices "github.com/hyperledger/fabric-sdk-go/msp"
+	"github.com/hyperledger/fabric/bccsp"
+)
+
+// mockCAServer is a fabric-ca stand-in issuing TCert batches to the users it enrolled
+type mockCAServer struct {
+	sync.Mutex
+	server  *httptest.Server
+	key     *ecdsa.PrivateKey
+	cert    *x509.Certificate
+	serial  int64
+	batches int
+	// hold, when set, delays the batches until it is closed
+	hold chan struct{}
+}
+
+// startMockCAServer starts the mock CA on a random local port
+func startMockCAServer(t *testing.T) *mockCAServer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey return error[%s]", err)
+	}
+	ca := &mockCAServer{key: key}
+	ca.cert, err = x509.ParseCertificate(ca.issue(t, "ca", &key.PublicKey))
+	if err != nil {
+		t.Fatalf("x509 ParseCertificate return error[%s]", err)
+	}
+	ca.server = httptest.NewServer(http.HandlerFunc(ca.handle))
+	return ca
+}
+
+// newMSPServices returns msp services of the mock CA signing with the crypto suite
+func (ca *mockCAServer) newMSPServices(t *testing.T, cryptoSuite bccsp.BCCSP) *mspservices.Services {
+	// the fabric-ca client reads its TLS settings from the client config of its home directory
+	if err := os.MkdirAll("/tmp/msptest", 0755); err != nil {
+		t.Fatalf("MkdirAll return error[%s]", err)
+	}
+	if err := ioutil.WriteFile("/tmp/msptest/client-config.json", []byte("{}"), 0644); err != nil {
+		t.Fatalf("WriteFile return error[%s]", err)
+	}
+	msps, err := mspservices.NewMSPServices(ca.server.URL, "/tmp/msptest")
+	if err != nil {
+		t.Fatalf("NewMSPServices return error[%s]", err)
+	}
+	msps.SetCryptoSuite(cryptoSuite)
+	msps.SetKeyStorePath("/tmp/keystoretest")
+	return msps
+}
+
+// enroll sets a new private key of the crypto suite and its enrollment certificate to the user
+func (ca *mockCAServer) enroll(t *testing.T, cryptoSuite bccsp.BCCSP, user *User) {
+	key, err := cryptoSuite.KeyGen(&bccsp.ECDSAKeyGenOpts{Temporary: false})
+	if err != nil {
+		t.Fatalf("KeyGen return error[%s]", err)
+	}
+	publicKey, err := key.PublicKey()
+	if err != nil {
+		t.Fatalf("PublicKey return error[%s]", err)
+	}
+	raw, err := publicKey.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes return error[%s]", err)
+	}
+	pub, err := x509.ParsePKIXPublicKey(raw)
+	if err != nil {
+		t.Fatalf("ParsePKIXPublicKey return error[%s]", err)
+	}
+	user.SetPrivateKey(key)
+	user.SetEnrollmentCertificate(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.issue(t, user.GetName(), pub)}))
+}
+
+func (ca *mockCAServer) issue(t *testing.T, name string, pub interface{}) []byte {
+	ca.Lock()
+	ca.serial++
+	template := &x509.Certificate{SerialNumber: big.NewInt(ca.serial), Subject: pkix.Name{CommonName: name},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour), IsCA: ca.cert == nil,
+		BasicConstraintsValid: true, KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign}
+	parent := ca.cert
+	ca.Unlock()
+	if parent == nil {
+		parent = template
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, parent, pub, ca.key)
+	if err != nil {
+		t.Fatalf("CreateCertificate return error[%s]", err)
+	}
+	return cert
+}
+
+func (ca *mockCAServer) getBatches() int {
+	ca.Lock()
+	defer ca.Unlock()
+	return ca.batches
+}
+
+func (ca *mockCAServer) handle(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	cert, err := util.VerifyToken(r.Header.Get("authorization"), body)
+	if err != nil || r.URL.Path != "/api/v1/cfssl/tcert" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(cfsslapi.NewErrorResponse("Authorization failure", 20))
+		return
+	}
+	ca.Lock()
+	hold := ca.hold
+	ca.Unlock()
+	if hold != nil {
+		<-hold
+	}
+	req := &api.GetTCertBatchRequest{}
+	json.Unmarshal(body, req)
+	mgr, _ := tcert.NewMgr(ca.key, ca.cert)
+	batch, err := mgr.GetBatch(&tcert.GetBatchRequest{Count: req.Count, PreKey: "prekey"}, cert)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(cfsslapi.NewErrorResponse(err.Error(), 40))
+		return
+	}
+	ca.Lock()
+	ca.batches++
+	ca.Unlock()
+	json.NewEncoder(w).Encode(cfsslapi.NewSuccessResponse(&api.GetTCertBatchResponse{GetBatchResponse: *batch}))
+}
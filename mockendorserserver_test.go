@@ -0,0 +1,149 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/bccsp"
+	"github.com/hyperledger/fabric/common/util"
+	msp "github.com/hyperledger/fabric/msp"
+	mb "github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// mockEndorserServer is an in-process Endorser server that records the
+// proposals it receives and replies with a configurable response.
+type mockEndorserServer struct {
+	sync.Mutex
+	response  *pb.ProposalResponse
+	proposals []*pb.SignedProposal
+}
+
+func (m *mockEndorserServer) ProcessProposal(ctx context.Context, signedProposal *pb.SignedProposal) (*pb.ProposalResponse, error) {
+	m.Lock()
+	defer m.Unlock()
+	m.proposals = append(m.proposals, signedProposal)
+	return m.response, nil
+}
+
+func (m *mockEndorserServer) getProposals() []*pb.SignedProposal {
+	m.Lock()
+	defer m.Unlock()
+	return m.proposals
+}
+
+// startMockEndorserServer starts the mock server on a random local port and returns its address
+func startMockEndorserServer(t *testing.T, endorserServer pb.EndorserServer) (string, *grpc.Server) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	grpcServer := grpc.NewServer()
+	pb.RegisterEndorserServer(grpcServer, endorserServer)
+	go grpcServer.Serve(lis)
+	return lis.Addr().String(), grpcServer
+}
+
+// signedProposalResponse returns a successful proposal response endorsed by a new identity of the MSP,
+// along with the configuration of an MSP trusting the CA that issued the endorser certificate
+func signedProposalResponse(t *testing.T, cryptoSuite bccsp.BCCSP, mspID string, payload []byte) (*pb.ProposalResponse, *mb.MSPConfig) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey return error[%s]", err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: mspID + " CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caCert, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate return error[%s]", err)
+	}
+
+	endorserKey, err := cryptoSuite.KeyGen(&bccsp.ECDSAKeyGenOpts{Temporary: true})
+	if err != nil {
+		t.Fatalf("KeyGen return error[%s]", err)
+	}
+	publicKey, err := endorserKey.PublicKey()
+	if err != nil {
+		t.Fatalf("PublicKey return error[%s]", err)
+	}
+	publicKeyBytes, err := publicKey.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes return error[%s]", err)
+	}
+	endorserPublicKey, err := x509.ParsePKIXPublicKey(publicKeyBytes)
+	if err != nil {
+		t.Fatalf("ParsePKIXPublicKey return error[%s]", err)
+	}
+	endorserTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "peer0"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	endorserCert, err := x509.CreateCertificate(rand.Reader, endorserTemplate, caTemplate, endorserPublicKey, caKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate return error[%s]", err)
+	}
+
+	endorser, err := proto.Marshal(&msp.SerializedIdentity{Mspid: mspID,
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: endorserCert})})
+	if err != nil {
+		t.Fatalf("Marshal return error[%s]", err)
+	}
+	digest, err := cryptoSuite.Hash(util.ConcatenateBytes(payload, endorser), &bccsp.SHAOpts{})
+	if err != nil {
+		t.Fatalf("Hash return error[%s]", err)
+	}
+	signature, err := cryptoSuite.Sign(endorserKey, digest, nil)
+	if err != nil {
+		t.Fatalf("Sign return error[%s]", err)
+	}
+
+	fabricMSPConfig, err := proto.Marshal(&mb.FabricMSPConfig{Name: mspID,
+		RootCerts: [][]byte{pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caCert})}})
+	if err != nil {
+		t.Fatalf("Marshal return error[%s]", err)
+	}
+	response := &pb.ProposalResponse{Response: &pb.Response{Status: 200}, Payload: payload,
+		Endorsement: &pb.Endorsement{Endorser: endorser, Signature: signature}}
+	return response, &mb.MSPConfig{Type: int32(msp.FABRIC), Config: fabricMSPConfig}
+}
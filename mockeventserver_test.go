@@ -0,0 +1,64 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"google.golang.org/grpc"
+)
+
+// mockEventServer is an in-process Events server that accepts the registration
+// of each stream and keeps it open until the client leaves.
+type mockEventServer struct{}
+
+func (m *mockEventServer) Chat(stream pb.Events_ChatServer) error {
+	in, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	register, ok := in.Event.(*pb.Event_Register)
+	if !ok {
+		return fmt.Errorf("expected register event, got %T", in.Event)
+	}
+	if err := stream.Send(&pb.Event{Event: register}); err != nil {
+		return err
+	}
+	for {
+		if _, err := stream.Recv(); err != nil {
+			return nil
+		}
+	}
+}
+
+// startMockEventServer starts the mock server on a random local port and returns its address
+func startMockEventServer(t *testing.T) (string, *grpc.Server) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	grpcServer := grpc.NewServer()
+	pb.RegisterEventsServer(grpcServer, &mockEventServer{})
+	go grpcServer.Serve(lis)
+	return lis.Addr().String(), grpcServer
+}
@@ -20,10 +20,29 @@ limitations under the License.
 package msp
 
 import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 
+	"github.com/cloudflare/cfssl/signer"
 	"github.com/hyperledger/fabric-ca/api"
 	msp "github.com/hyperledger/fabric-ca/lib"
+	"github.com/hyperledger/fabric-ca/lib/tcert"
+	"github.com/hyperledger/fabric/bccsp"
+	bccspSigner "github.com/hyperledger/fabric/bccsp/signer"
+	"github.com/hyperledger/fabric/bccsp/sw"
 
 	"github.com/op/go-logging"
 )
@@ -32,12 +51,98 @@ var logger = logging.MustGetLogger("fabric_sdk_go")
 
 // Services ...
 type Services struct {
-	mspClient *msp.Client
+	mspClient    *msp.Client
+	cryptoSuite  bccsp.BCCSP
+	keyStorePath string
+}
+
+// User ...
+/**
+ * The identity authenticating a request to the msp services, such as the registrar
+ * of a new user. The fabricsdk User satisfies this interface.
+ */
+type User interface {
+	GetName() string
+	GetEnrollmentCertificate() []byte
+	GetPrivateKey() bccsp.Key
+}
+
+// RegistrationRequest ...
+/**
+ * A request to register a new identity.
+ * Secret is optional, a random secret is generated by the server when it is empty.
+ * MaxEnrollments is the number of times the secret can be used to enroll, 0 uses the server default.
+ */
+type RegistrationRequest struct {
+	Name           string
+	Type           string
+	Secret         string
+	MaxEnrollments int
+	Group          string
+	Attributes     []Attribute
+}
+
+// Attribute ...
+/**
+ * A name and value pair registered with an identity.
+ */
+type Attribute struct {
+	Name  string
+	Value string
+}
+
+// RevocationRequest ...
+/**
+ * A request to revoke either all the certificates of the identity Name, or the
+ * single certificate identified by Serial and AKI.
+ * Reason is one of the revocation reason codes of RFC 5280 (see golang.org/x/crypto/ocsp).
+ */
+type RevocationRequest struct {
+	Name   string
+	Serial string
+	AKI    string
+	Reason int
+}
+
+// TCert ...
+/**
+ * A transaction certificate and its private key, derived from the key of the
+ * enrollment certificate it was issued for.
+ */
+type TCert struct {
+	Certificate []byte
+	PrivateKey  bccsp.Key
+}
+
+// Error ...
+/**
+ * Error returned when the msp server rejects a request or cannot be reached.
+ * Message is the error reported by the server, and StatusCode the HTTP status
+ * code of a failure reported without an error, 0 otherwise.
+ */
+type Error struct {
+	Operation  string
+	StatusCode int
+	Message    string
+}
+
+// the errors of the fabric-ca client, followed by the request they failed
+var (
+	serverErrorPattern = regexp.MustCompile(`^Error response from server was '(.*)' for request:$`)
+	statusCodePattern  = regexp.MustCompile(`^Failed with server status code (\d+) for request:$`)
+)
+
+func (e *Error) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("%s failed with status %d: %s", e.Operation, e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("%s failed: %s", e.Operation, e.Message)
 }
 
 // NewMSPServices ...
 /**
  * @param {string} url The endpoint URL for msp services of the form: "http://host:port" or "https://host:port"
+ * @param {string} clientConfigFile The directory of the client-config.json holding the TLS settings of the msp client
  */
 func NewMSPServices(url string, clientConfigFile string) (*Services, error) {
 	if url == "" {
@@ -80,3 +185,444 @@ func (msps *Services) Enroll(enrollmentID string, enrollmentSecret string) ([]by
 	}
 	return id.GetECert().GetKey(), id.GetECert().GetCert(), nil
 }
+
+// EnrollWithCryptoSuite ...
+/**
+ * Enroll a registered user with a private key generated by the crypto suite, so that
+ * the key never leaves it. With a hardware backed crypto suite the key stays in the HSM
+ * and the returned key only references it by its SKI.
+ * @param {string} enrollmentID The registered ID to use for enrollment
+ * @param {string} enrollmentSecret The secret associated with the enrollment ID
+ * @returns {bccsp.Key} The private key, stored by the crypto suite
+ * @returns {[]byte} X509 certificate
+ */
+func (msps *Services) EnrollWithCryptoSuite(enrollmentID string, enrollmentSecret string) (bccsp.Key, []byte, error) {
+	if enrollmentID == "" {
+		return nil, nil, fmt.Errorf("enrollmentID is empty")
+	}
+	if enrollmentSecret == "" {
+		return nil, nil, fmt.Errorf("enrollmentSecret is empty")
+	}
+	if msps.cryptoSuite == nil {
+		return nil, nil, fmt.Errorf("cryptoSuite is nil")
+	}
+	key, err := msps.cryptoSuite.KeyGen(&bccsp.ECDSAKeyGenOpts{Temporary: false})
+	if err != nil {
+		return nil, nil, fmt.Errorf("KeyGen failed: %s", err)
+	}
+	csrPEM, err := msps.createCSR(enrollmentID, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err := json.Marshal(&signer.SignRequest{Request: string(csrPEM)})
+	if err != nil {
+		return nil, nil, fmt.Errorf("Marshal Enroll request failed: %s", err)
+	}
+	req, err := msps.mspClient.NewPost("enroll", body)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.SetBasicAuth(enrollmentID, enrollmentSecret)
+	result, err := msps.mspClient.SendPost(req)
+	if err != nil {
+		return nil, nil, newError("Enroll", err)
+	}
+	cert, err := decodeCertificate("Enroll", result)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, cert, nil
+}
+
+// SetCryptoSuite ...
+/**
+ * Set the crypto suite signing the requests of registrars and enrolled users.
+ * @param {bccsp.BCCSP} cryptoSuite The crypto suite holding the users' private keys
+ */
+func (msps *Services) SetCryptoSuite(cryptoSuite bccsp.BCCSP) {
+	msps.cryptoSuite = cryptoSuite
+}
+
+// GetCryptoSuite ...
+/**
+ * @returns {bccsp.BCCSP} The crypto suite signing the requests
+ */
+func (msps *Services) GetCryptoSuite() bccsp.BCCSP {
+	return msps.cryptoSuite
+}
+
+// SetKeyStorePath ...
+/**
+ * Set the directory of the software key store holding the private keys of the registrars and
+ * enrolled users. The fabric-ca client signs their requests with the PEM encoded key read from it.
+ * @param {string} keyStorePath The directory of the key store of the crypto suite
+ */
+func (msps *Services) SetKeyStorePath(keyStorePath string) {
+	msps.keyStorePath = keyStorePath
+}
+
+// GetKeyStorePath ...
+/**
+ * @returns {string} The directory of the key store holding the users' private keys
+ */
+func (msps *Services) GetKeyStorePath() string {
+	return msps.keyStorePath
+}
+
+// PrivateKeyPEM ...
+/**
+ * Read a private key kept by a software file key store, which stores it PEM encoded
+ * in the <SKI>_sk file of its directory. The keys of an HSM and the temporary keys
+ * are not in the key store and cannot be exported.
+ * @param {string} keyStorePath The directory of the key store
+ * @param {bccsp.Key} key The private key
+ * @returns {[]byte} The PEM encoded private key
+ */
+func PrivateKeyPEM(keyStorePath string, key bccsp.Key) ([]byte, error) {
+	if keyStorePath == "" {
+		return nil, fmt.Errorf("key store path is empty")
+	}
+	if key == nil || !key.Private() {
+		return nil, fmt.Errorf("key is not a private key")
+	}
+	raw, err := ioutil.ReadFile(filepath.Join(keyStorePath, hex.EncodeToString(key.SKI())+"_sk"))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("Private key %x is not exportable, it is not in the key store %s", key.SKI(), keyStorePath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read private key %x: %s", key.SKI(), err)
+	}
+	return raw, nil
+}
+
+// Register ...
+/**
+ * Register a new identity with the msp server
+ * @param {User} registrar The enrolled user registering the identity, it needs the hf.Registrar.Roles attribute
+ * @param {RegistrationRequest} request The identity to register
+ * @returns {string} The enrollment secret of the new identity
+ */
+func (msps *Services) Register(registrar User, request *RegistrationRequest) (string, error) {
+	if request == nil {
+		return "", fmt.Errorf("registration request is nil")
+	}
+	if request.Name == "" {
+		return "", fmt.Errorf("registration request name is empty")
+	}
+	if request.Group == "" {
+		return "", fmt.Errorf("registration request group is empty")
+	}
+	attributes := make([]api.Attribute, len(request.Attributes))
+	for i, attribute := range request.Attributes {
+		attributes[i] = api.Attribute{Name: attribute.Name, Value: attribute.Value}
+	}
+	req := &api.RegistrationRequest{
+		Name:           request.Name,
+		Type:           request.Type,
+		Secret:         request.Secret,
+		MaxEnrollments: request.MaxEnrollments,
+		Group:          request.Group,
+		Attributes:     attributes,
+	}
+	identity, err := msps.newIdentity(registrar)
+	if err != nil {
+		return "", err
+	}
+	response, err := identity.Register(req)
+	if err != nil {
+		return "", newError("Register", err)
+	}
+	return response.Secret, nil
+}
+
+// Reenroll ...
+/**
+ * Reenroll an enrolled user in order to receive a new X509 certificate, for example before
+ * the current one expires. The user is authenticated with its current certificate. The new
+ * private key is generated by the crypto suite, as with EnrollWithCryptoSuite.
+ * @param {User} user The enrolled user
+ * @returns {bccsp.Key} The new private key, stored by the crypto suite
+ * @returns {[]byte} The new X509 certificate
+ */
+func (msps *Services) Reenroll(user User) (bccsp.Key, []byte, error) {
+	if msps.cryptoSuite == nil {
+		return nil, nil, fmt.Errorf("cryptoSuite is nil")
+	}
+	identity, err := msps.newIdentity(user)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := msps.cryptoSuite.KeyGen(&bccsp.ECDSAKeyGenOpts{Temporary: false})
+	if err != nil {
+		return nil, nil, fmt.Errorf("KeyGen failed: %s", err)
+	}
+	csrPEM, err := msps.createCSR(user.GetName(), key)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the identity generates the key of its reenrollment request itself, so the
+	// request with the key of the crypto suite is posted as the identity
+	body, err := json.Marshal(&signer.SignRequest{Request: string(csrPEM)})
+	if err != nil {
+		return nil, nil, fmt.Errorf("Marshal Reenroll request failed: %s", err)
+	}
+	result, err := identity.Post("reenroll", body)
+	if err != nil {
+		return nil, nil, newError("Reenroll", err)
+	}
+	cert, err := decodeCertificate("Reenroll", result)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, cert, nil
+}
+
+// Revoke ...
+/**
+ * Revoke an identity, or one of its certificates
+ * @param {User} registrar The enrolled user revoking the certificates, it needs the hf.Revoker attribute
+ * @param {RevocationRequest} request The identity or certificate to revoke
+ */
+func (msps *Services) Revoke(registrar User, request *RevocationRequest) error {
+	if request == nil {
+		return fmt.Errorf("revocation request is nil")
+	}
+	if request.Name == "" && (request.Serial == "" || request.AKI == "") {
+		return fmt.Errorf("revocation request needs either a name or a serial and AKI")
+	}
+	req := &api.RevocationRequest{
+		Name:   request.Name,
+		Serial: request.Serial,
+		AKI:    request.AKI,
+		Reason: request.Reason,
+	}
+	identity, err := msps.newIdentity(registrar)
+	if err != nil {
+		return err
+	}
+	if err := identity.Revoke(req); err != nil {
+		return newError("Revoke", err)
+	}
+	return nil
+}
+
+// RevokeSelf ...
+/**
+ * Revoke the identity of an enrolled user, and all its certificates
+ * @param {User} user The enrolled user
+ * @param {int} reason The revocation reason code
+ */
+func (msps *Services) RevokeSelf(user User, reason int) error {
+	if user == nil {
+		return fmt.Errorf("user is nil")
+	}
+	return msps.Revoke(user, &RevocationRequest{Name: user.GetName(), Reason: reason})
+}
+
+/**
+ * private internal method returning the fabric-ca identity of a user, signing
+ * its requests with the private key read from the key store
+ */
+func (msps *Services) newIdentity(user User) (*msp.Identity, error) {
+	if user == nil {
+		return nil, fmt.Errorf("user is nil")
+	}
+	cert := user.GetEnrollmentCertificate()
+	if len(cert) == 0 {
+		return nil, fmt.Errorf("User %s has no enrollment certificate", user.GetName())
+	}
+	if user.GetPrivateKey() == nil {
+		return nil, fmt.Errorf("User %s has no private key", user.GetName())
+	}
+	key, err := PrivateKeyPEM(msps.keyStorePath, user.GetPrivateKey())
+	if err != nil {
+		return nil, err
+	}
+	identity, err := msps.mspClient.NewIdentity(key, cert)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create the identity of user %s: %s", user.GetName(), err)
+	}
+	return identity, nil
+}
+
+/**
+ * private internal method mapping an error of the fabric-ca client to an Error. The
+ * request it appends is left out, as it carries the authorization token.
+ */
+func newError(operation string, err error) *Error {
+	message := strings.SplitN(err.Error(), "\n", 2)[0]
+	if match := serverErrorPattern.FindStringSubmatch(message); match != nil {
+		return &Error{Operation: operation, Message: match[1]}
+	}
+	if match := statusCodePattern.FindStringSubmatch(message); match != nil {
+		statusCode, _ := strconv.Atoi(match[1])
+		return &Error{Operation: operation, StatusCode: statusCode, Message: "server returned failure"}
+	}
+	return &Error{Operation: operation, Message: message}
+}
+
+/**
+ * private internal method creating a certificate signing request signed by the
+ * crypto suite with the given key
+ */
+func (msps *Services) createCSR(enrollmentID string, key bccsp.Key) ([]byte, error) {
+	cryptoSigner := &bccspSigner.CryptoSigner{}
+	if err := cryptoSigner.Init(msps.cryptoSuite, key); err != nil {
+		return nil, fmt.Errorf("Init signer failed: %s", err)
+	}
+	template := &x509.CertificateRequest{Subject: pkix.Name{CommonName: enrollmentID}}
+	if hostname, _ := os.Hostname(); hostname != "" {
+		template.DNSNames = []string{hostname}
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, template, cryptoSigner)
+	if err != nil {
+		return nil, fmt.Errorf("CreateCertificateRequest failed: %s", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}), nil
+}
+
+/**
+ * private internal method decoding the certificate returned by enroll and reenroll
+ */
+func decodeCertificate(operation string, result interface{}) ([]byte, error) {
+	encoded, ok := result.(string)
+	if !ok {
+		return nil, &Error{Operation: operation, Message: fmt.Sprintf("invalid response from server: %v", result)}
+	}
+	cert, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, &Error{Operation: operation, Message: fmt.Sprintf("invalid certificate from server: %s", err)}
+	}
+	return cert, nil
+}
+
+// GetTCerts ...
+/**
+ * Get a batch of transaction certificates for an enrolled user, and derive their
+ * private keys from the user's private key
+ * @param {User} user The enrolled user
+ * @param {int} count The number of TCerts in the batch, 0 for the maximum allowed by the server
+ * @param {[]string} attributes The names of the user's attributes to include in the TCerts
+ * @returns {[]*TCert} The TCerts
+ */
+func (msps *Services) GetTCerts(user User, count int, attributes []string) ([]*TCert, error) {
+	if count < 0 {
+		return nil, fmt.Errorf("count is negative")
+	}
+	if msps.cryptoSuite == nil {
+		return nil, fmt.Errorf("cryptoSuite is nil")
+	}
+	identity, err := msps.newIdentity(user)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(&api.GetTCertBatchRequest{Count: count, AttrNames: attributes})
+	if err != nil {
+		return nil, fmt.Errorf("Marshal GetTCertBatch request failed: %s", err)
+	}
+	// the GetTCertBatch of the identity drops the batch, so the request is posted as the identity
+	result, err := identity.Post("tcert", body)
+	if err != nil {
+		return nil, newError("GetTCertBatch", err)
+	}
+	// the result was decoded as a generic JSON value, decode it again as a batch
+	resultBytes, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("Marshal GetTCertBatch result failed: %s", err)
+	}
+	batch := &api.GetTCertBatchResponse{}
+	if err := json.Unmarshal(resultBytes, batch); err != nil {
+		return nil, &Error{Operation: "GetTCertBatch", Message: fmt.Sprintf("invalid response from server: %s", err)}
+	}
+	return msps.deriveTCerts(user, batch.Key, batch.TCerts)
+}
+
+/**
+ * private internal method deriving the private keys of a TCert batch. The batch key is the
+ * root of a key tree: its child 1 encrypts the TCert indexes and the child of its child 2
+ * named by the index of a TCert expands the user's private key into the TCert private key.
+ */
+func (msps *Services) deriveTCerts(user User, batchKey []byte, tcerts []tcert.TCert) ([]*TCert, error) {
+	if len(batchKey) == 0 {
+		return nil, fmt.Errorf("TCert batch key is empty")
+	}
+	// the server derives the key tree with HMAC-SHA384, whatever the level of the user's crypto suite
+	kdfSuite, err := sw.New(384, "SHA2", &sw.DummyKeyStore{})
+	if err != nil {
+		return nil, fmt.Errorf("Failed getting key derivation BCCSP [%s]", err)
+	}
+	rootKey, err := kdfSuite.KeyImport(batchKey, &bccsp.HMACImportKeyOpts{Temporary: true})
+	if err != nil {
+		return nil, fmt.Errorf("KeyImport return error: %v", err)
+	}
+	keyTree := tcert.NewKeyTree(kdfSuite, rootKey)
+	indexKey, err := keyBytes(keyTree, []string{"\x01"})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*TCert, len(tcerts))
+	for i, tc := range tcerts {
+		certPem, _ := pem.Decode(tc.Cert)
+		if certPem == nil {
+			return nil, fmt.Errorf("TCert %d is not PEM encoded", i)
+		}
+		cert, err := x509.ParseCertificate(certPem.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("x509 ParseCertificate of TCert %d return error: %v", i, err)
+		}
+		var index []byte
+		for _, extension := range cert.Extensions {
+			if extension.Id.Equal(tcert.TCertEncTCertIndex) {
+				index, err = tcert.CBCPKCS7Decrypt(indexKey[:32], extension.Value)
+				if err != nil {
+					return nil, fmt.Errorf("Failed to decrypt the index of TCert %d: %v", i, err)
+				}
+			}
+		}
+		if index == nil {
+			return nil, fmt.Errorf("TCert %d has no index", i)
+		}
+		expansion, err := keyBytes(keyTree, []string{"\x02", string(index)})
+		if err != nil {
+			return nil, err
+		}
+		key, err := msps.cryptoSuite.KeyDeriv(user.GetPrivateKey(), &bccsp.ECDSAReRandKeyOpts{Temporary: true, Expansion: expansion})
+		if err != nil {
+			return nil, fmt.Errorf("KeyDeriv return error: %v", err)
+		}
+		// the derived key must match the key the server certified
+		publicKey, err := key.PublicKey()
+		if err != nil {
+			return nil, err
+		}
+		derived, err := publicKey.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		certified, err := x509.MarshalPKIXPublicKey(cert.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(derived, certified) {
+			return nil, fmt.Errorf("The derived private key doesn't match TCert %d", i)
+		}
+		result[i] = &TCert{Certificate: tc.Cert, PrivateKey: key}
+	}
+	return result, nil
+}
+
+/**
+ * private internal method returning the raw key at a path of the key tree
+ */
+func keyBytes(keyTree *tcert.KeyTree, path []string) ([]byte, error) {
+	key, err := keyTree.GetKey(path)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := key.Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to export derived key: %v", err)
+	}
+	return raw, nil
+}
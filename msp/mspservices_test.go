@@ -20,7 +20,33 @@ limitations under the License.
 package msp
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	cfsslapi "github.com/cloudflare/cfssl/api"
+	"github.com/cloudflare/cfssl/signer"
+	"github.com/hyperledger/fabric-ca/api"
+	"github.com/hyperledger/fabric-ca/lib/tcert"
+	"github.com/hyperledger/fabric-ca/util"
+	"github.com/hyperledger/fabric/bccsp"
+	bccspFactory "github.com/hyperledger/fabric/bccsp/factory"
+	"github.com/hyperledger/fabric/bccsp/sw"
 )
 
 func TestEnrollWithMissingParameters(t *testing.T) {
@@ -43,3 +69,447 @@ func TestEnrollWithMissingParameters(t *testing.T) {
 		t.Fatalf("Enroll didn't return right error")
 	}
 }
+
+func TestRegister(t *testing.T) {
+	ca, msps := startMockCA(t)
+	defer ca.server.Close()
+	registrar := ca.newUser(t, msps.GetCryptoSuite(), "admin")
+
+	secret, err := msps.Register(registrar, &RegistrationRequest{Name: "user1", Type: "user", MaxEnrollments: 2,
+		Group: "bank_a", Attributes: []Attribute{{Name: "role", Value: "teller"}}})
+	if err != nil {
+		t.Fatalf("Register return error[%s]", err)
+	}
+	if secret != "secret-user1" {
+		t.Fatalf("Register returned wrong secret %s", secret)
+	}
+	registered := ca.getRegistered("user1")
+	if registered == nil || registered.Type != "user" || registered.MaxEnrollments != 2 || registered.Group != "bank_a" ||
+		len(registered.Attributes) != 1 || registered.Attributes[0].Name != "role" || registered.Attributes[0].Value != "teller" {
+		t.Fatalf("CA received wrong registration %v", registered)
+	}
+
+	// the CA rejects a second registration of the same identity
+	_, err = msps.Register(registrar, &RegistrationRequest{Name: "user1", Group: "bank_a"})
+	caErr, ok := err.(*Error)
+	if !ok || caErr.Operation != "Register" || caErr.Message != "Identity already registered" {
+		t.Fatalf("Register didn't return right error: %v", err)
+	}
+
+	// an unknown registrar is not authorized
+	_, err = msps.Register(ca.newUser(t, msps.GetCryptoSuite(), "unknown"), &RegistrationRequest{Name: "user2", Group: "bank_a"})
+	if caErr, ok := err.(*Error); !ok || caErr.Message != "Authorization failure" {
+		t.Fatalf("Register didn't return right error: %v", err)
+	}
+}
+
+func TestRegisterWithMissingParameters(t *testing.T) {
+	ca, msps := startMockCA(t)
+	defer ca.server.Close()
+	registrar := ca.newUser(t, msps.GetCryptoSuite(), "admin")
+
+	if _, err := msps.Register(registrar, &RegistrationRequest{Group: "bank_a"}); err == nil || err.Error() != "registration request name is empty" {
+		t.Fatalf("Register didn't return right error: %v", err)
+	}
+	if _, err := msps.Register(registrar, &RegistrationRequest{Name: "user1"}); err == nil || err.Error() != "registration request group is empty" {
+		t.Fatalf("Register didn't return right error: %v", err)
+	}
+	// a temporary key is not in the key store
+	temporary := ca.newUser(t, msps.GetCryptoSuite(), "admin")
+	temporary.key, _ = msps.GetCryptoSuite().KeyGen(&bccsp.ECDSAKeyGenOpts{Temporary: true})
+	if _, err := msps.Register(temporary, &RegistrationRequest{Name: "user1", Group: "bank_a"}); err == nil ||
+		!strings.Contains(err.Error(), "is not exportable") {
+		t.Fatalf("Register didn't return right error: %v", err)
+	}
+	msps.SetKeyStorePath("")
+	if _, err := msps.Register(registrar, &RegistrationRequest{Name: "user1", Group: "bank_a"}); err == nil || err.Error() != "key store path is empty" {
+		t.Fatalf("Register didn't return right error: %v", err)
+	}
+}
+
+func TestReenroll(t *testing.T) {
+	ca, msps := startMockCA(t)
+	defer ca.server.Close()
+	user := ca.newUser(t, msps.GetCryptoSuite(), "user1")
+
+	key, cert, err := msps.Reenroll(user)
+	if err != nil {
+		t.Fatalf("Reenroll return error[%s]", err)
+	}
+	certPem, _ := pem.Decode(cert)
+	if certPem == nil {
+		t.Fatalf("Reenroll didn't return a PEM certificate")
+	}
+	cert509, err := x509.ParseCertificate(certPem.Bytes)
+	if err != nil {
+		t.Fatalf("x509 ParseCertificate return error[%s]", err)
+	}
+	if cert509.Subject.CommonName != "user1" {
+		t.Fatalf("CommonName in x509 cert is not the enrollmentID")
+	}
+	publicKey, err := key.PublicKey()
+	if err != nil {
+		t.Fatalf("PublicKey return error[%s]", err)
+	}
+	raw, err := publicKey.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes return error[%s]", err)
+	}
+	certKey, err := x509.MarshalPKIXPublicKey(cert509.PublicKey)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey return error[%s]", err)
+	}
+	if !bytes.Equal(raw, certKey) {
+		t.Fatalf("Reenroll returned a private key not matching the certificate")
+	}
+	// the new key is kept by the crypto suite
+	if _, err := msps.GetCryptoSuite().GetKey(key.SKI()); err != nil {
+		t.Fatalf("GetKey return error[%s]", err)
+	}
+}
+
+func TestEnrollWithCryptoSuite(t *testing.T) {
+	ca, msps := startMockCA(t)
+	defer ca.server.Close()
+	admin := ca.newUser(t, msps.GetCryptoSuite(), "admin")
+	secret, err := msps.Register(admin, &RegistrationRequest{Name: "user2", Group: "bank_a"})
+	if err != nil {
+		t.Fatalf("Register return error[%s]", err)
+	}
+
+	if _, _, err := msps.EnrollWithCryptoSuite("user2", "wrong"); err == nil {
+		t.Fatalf("EnrollWithCryptoSuite didn't return error with a wrong secret")
+	}
+	key, cert, err := msps.EnrollWithCryptoSuite("user2", secret)
+	if err != nil {
+		t.Fatalf("EnrollWithCryptoSuite return error[%s]", err)
+	}
+	if !key.Private() {
+		t.Fatalf("EnrollWithCryptoSuite didn't return a private key")
+	}
+	certPem, _ := pem.Decode(cert)
+	if certPem == nil {
+		t.Fatalf("EnrollWithCryptoSuite didn't return a PEM certificate")
+	}
+	cert509, err := x509.ParseCertificate(certPem.Bytes)
+	if err != nil {
+		t.Fatalf("x509 ParseCertificate return error[%s]", err)
+	}
+	if cert509.Subject.CommonName != "user2" {
+		t.Fatalf("CommonName in x509 cert is not the enrollmentID")
+	}
+	publicKey, err := key.PublicKey()
+	if err != nil {
+		t.Fatalf("PublicKey return error[%s]", err)
+	}
+	raw, err := publicKey.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes return error[%s]", err)
+	}
+	certKey, err := x509.MarshalPKIXPublicKey(cert509.PublicKey)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey return error[%s]", err)
+	}
+	if !bytes.Equal(raw, certKey) {
+		t.Fatalf("EnrollWithCryptoSuite returned a private key not matching the certificate")
+	}
+
+	// the key is kept by the crypto suite and can be retrieved by its SKI
+	storedKey, err := msps.GetCryptoSuite().GetKey(key.SKI())
+	if err != nil {
+		t.Fatalf("GetKey return error[%s]", err)
+	}
+	if !bytes.Equal(storedKey.SKI(), key.SKI()) || !storedKey.Private() {
+		t.Fatalf("GetKey didn't return the enrollment key")
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	ca, msps := startMockCA(t)
+	defer ca.server.Close()
+	registrar := ca.newUser(t, msps.GetCryptoSuite(), "admin")
+	user1 := ca.newUser(t, msps.GetCryptoSuite(), "user1")
+	user2 := ca.newUser(t, msps.GetCryptoSuite(), "user2")
+
+	if err := msps.Revoke(registrar, &RevocationRequest{Reason: 1}); err == nil {
+		t.Fatalf("Revoke didn't return error")
+	}
+	if err := msps.Revoke(registrar, &RevocationRequest{Name: "user1", Reason: 1}); err != nil {
+		t.Fatalf("Revoke return error[%s]", err)
+	}
+	if reason, ok := ca.getRevoked("user1"); !ok || reason != 1 {
+		t.Fatalf("CA didn't revoke user1 with reason 1")
+	}
+	// a failure without an error response reports the status code
+	err := msps.Revoke(registrar, &RevocationRequest{Name: "unavailable"})
+	if caErr, ok := err.(*Error); !ok || caErr.Operation != "Revoke" || caErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Revoke didn't return right error: %v", err)
+	}
+	// a revoked user is not authorized anymore
+	_, _, err = msps.Reenroll(user1)
+	if caErr, ok := err.(*Error); !ok || caErr.Operation != "Reenroll" || caErr.Message != "Authorization failure" {
+		t.Fatalf("Reenroll didn't return right error: %v", err)
+	}
+
+	if err := msps.RevokeSelf(user2, 4); err != nil {
+		t.Fatalf("RevokeSelf return error[%s]", err)
+	}
+	if reason, ok := ca.getRevoked("user2"); !ok || reason != 4 {
+		t.Fatalf("CA didn't revoke user2 with reason 4")
+	}
+}
+
+func TestGetTCerts(t *testing.T) {
+	ca, msps := startMockCA(t)
+	defer ca.server.Close()
+	user := ca.newUser(t, msps.GetCryptoSuite(), "user1")
+
+	if _, err := msps.GetTCerts(user, -1, nil); err == nil || err.Error() != "count is negative" {
+		t.Fatalf("GetTCerts didn't return right error: %v", err)
+	}
+	tcerts, err := msps.GetTCerts(user, 3, nil)
+	if err != nil {
+		t.Fatalf("GetTCerts return error[%s]", err)
+	}
+	if len(tcerts) != 3 {
+		t.Fatalf("GetTCerts returned %d TCerts, expected 3", len(tcerts))
+	}
+	cryptoSuite := msps.GetCryptoSuite()
+	digest := []byte("0123456789abcdef0123456789abcdef")
+	for i, tc := range tcerts {
+		if bytes.Equal(tc.Certificate, user.GetEnrollmentCertificate()) || (i > 0 && bytes.Equal(tc.Certificate, tcerts[i-1].Certificate)) {
+			t.Fatalf("GetTCerts didn't return distinct TCerts")
+		}
+		// a signature by the derived key is verified by the TCert
+		signature, err := cryptoSuite.Sign(tc.PrivateKey, digest, nil)
+		if err != nil {
+			t.Fatalf("Sign return error[%s]", err)
+		}
+		certPem, _ := pem.Decode(tc.Certificate)
+		cert, err := x509.ParseCertificate(certPem.Bytes)
+		if err != nil {
+			t.Fatalf("x509 ParseCertificate return error[%s]", err)
+		}
+		publicKey, err := cryptoSuite.KeyImport(cert, &bccsp.X509PublicKeyImportOpts{Temporary: true})
+		if err != nil {
+			t.Fatalf("KeyImport return error[%s]", err)
+		}
+		valid, err := cryptoSuite.Verify(publicKey, signature, digest, nil)
+		if err != nil || !valid {
+			t.Fatalf("TCert %d doesn't verify the signature of its private key", i)
+		}
+	}
+}
+
+// mockCA is a fabric-ca stand-in authenticating requests with their token
+type mockCA struct {
+	server     *httptest.Server
+	key        *ecdsa.PrivateKey
+	cert       *x509.Certificate
+	mtx        sync.Mutex
+	serial     int64
+	registered map[string]*api.RegistrationRequest
+	revoked    map[string]int
+}
+
+type testUser struct {
+	name string
+	cert []byte
+	key  bccsp.Key
+}
+
+func (u *testUser) GetName() string {
+	return u.name
+}
+
+func (u *testUser) GetEnrollmentCertificate() []byte {
+	return u.cert
+}
+
+func (u *testUser) GetPrivateKey() bccsp.Key {
+	return u.key
+}
+
+func startMockCA(t *testing.T) (*mockCA, *Services) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey return error[%s]", err)
+	}
+	ca := &mockCA{key: key, registered: make(map[string]*api.RegistrationRequest), revoked: make(map[string]int)}
+	ca.cert, err = x509.ParseCertificate(ca.issue(t, "ca", &key.PublicKey, true))
+	if err != nil {
+		t.Fatalf("x509 ParseCertificate return error[%s]", err)
+	}
+	ca.server = httptest.NewServer(http.HandlerFunc(ca.handle))
+
+	// the fabric-ca client reads its TLS settings from the client config of its home directory
+	if err := os.MkdirAll("/tmp/msptest", 0755); err != nil {
+		t.Fatalf("MkdirAll return error[%s]", err)
+	}
+	if err := ioutil.WriteFile("/tmp/msptest/client-config.json", []byte("{}"), 0644); err != nil {
+		t.Fatalf("WriteFile return error[%s]", err)
+	}
+	msps, err := NewMSPServices(ca.server.URL, "/tmp/msptest")
+	if err != nil {
+		t.Fatalf("NewMSPServices return error[%s]", err)
+	}
+	ks := &sw.FileBasedKeyStore{}
+	if err := ks.Init(nil, "/tmp/keystoretest", false); err != nil {
+		t.Fatalf("Failed initializing key store [%s]", err)
+	}
+	cryptoSuite, err := bccspFactory.GetBCCSP(&bccspFactory.SwOpts{Ephemeral_: true, SecLevel: 256,
+		HashFamily: "SHA2", KeyStore: ks})
+	if err != nil {
+		t.Fatalf("Failed getting ephemeral software-based BCCSP [%s]", err)
+	}
+	msps.SetCryptoSuite(cryptoSuite)
+	msps.SetKeyStorePath("/tmp/keystoretest")
+	return ca, msps
+}
+
+// newUser returns a user enrolled by the CA, with its private key in the key store of the crypto suite
+func (ca *mockCA) newUser(t *testing.T, cryptoSuite bccsp.BCCSP, name string) *testUser {
+	key, err := cryptoSuite.KeyGen(&bccsp.ECDSAKeyGenOpts{Temporary: false})
+	if err != nil {
+		t.Fatalf("KeyGen return error[%s]", err)
+	}
+	publicKey, err := key.PublicKey()
+	if err != nil {
+		t.Fatalf("PublicKey return error[%s]", err)
+	}
+	raw, err := publicKey.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes return error[%s]", err)
+	}
+	pub, err := x509.ParsePKIXPublicKey(raw)
+	if err != nil {
+		t.Fatalf("ParsePKIXPublicKey return error[%s]", err)
+	}
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.issue(t, name, pub, false)})
+	return &testUser{name: name, cert: cert, key: key}
+}
+
+func (ca *mockCA) issue(t *testing.T, name string, pub interface{}, isCA bool) []byte {
+	ca.mtx.Lock()
+	ca.serial++
+	template := &x509.Certificate{SerialNumber: big.NewInt(ca.serial), Subject: pkix.Name{CommonName: name},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour), IsCA: isCA, BasicConstraintsValid: true,
+		KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign}
+	ca.mtx.Unlock()
+	parent := ca.cert
+	if parent == nil {
+		parent = template
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, parent, pub, ca.key)
+	if err != nil {
+		t.Fatalf("CreateCertificate return error[%s]", err)
+	}
+	return cert
+}
+
+func (ca *mockCA) getRegistered(name string) *api.RegistrationRequest {
+	ca.mtx.Lock()
+	defer ca.mtx.Unlock()
+	return ca.registered[name]
+}
+
+func (ca *mockCA) getRevoked(name string) (int, bool) {
+	ca.mtx.Lock()
+	defer ca.mtx.Unlock()
+	reason, ok := ca.revoked[name]
+	return reason, ok
+}
+
+func (ca *mockCA) handle(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	if r.URL.Path == "/api/v1/cfssl/enroll" {
+		ca.mtx.Lock()
+		defer ca.mtx.Unlock()
+		name, secret, ok := r.BasicAuth()
+		if _, registered := ca.registered[name]; !ok || !registered || secret != "secret-"+name {
+			ca.respond(w, http.StatusUnauthorized, cfsslapi.NewErrorResponse("Authorization failure", 20))
+			return
+		}
+		ca.sign(w, body, name)
+		return
+	}
+	cert, err := util.VerifyToken(r.Header.Get("authorization"), body)
+	if err == nil {
+		err = cert.CheckSignatureFrom(ca.cert)
+	}
+	if err != nil {
+		ca.respond(w, http.StatusUnauthorized, cfsslapi.NewErrorResponse("Invalid token", 20))
+		return
+	}
+	caller := cert.Subject.CommonName
+	ca.mtx.Lock()
+	defer ca.mtx.Unlock()
+	if _, revoked := ca.revoked[caller]; revoked || caller == "unknown" {
+		ca.respond(w, http.StatusUnauthorized, cfsslapi.NewErrorResponse("Authorization failure", 20))
+		return
+	}
+	switch r.URL.Path {
+	case "/api/v1/cfssl/register":
+		req := &api.RegistrationRequest{}
+		json.Unmarshal(body, req)
+		if _, ok := ca.registered[req.Name]; ok {
+			ca.respond(w, http.StatusBadRequest, cfsslapi.NewErrorResponse("Identity already registered", 74))
+			return
+		}
+		ca.registered[req.Name] = req
+		ca.respond(w, http.StatusOK, cfsslapi.NewSuccessResponse("secret-"+req.Name))
+	case "/api/v1/cfssl/reenroll":
+		ca.sign(w, body, caller)
+	case "/api/v1/cfssl/tcert":
+		req := &api.GetTCertBatchRequest{}
+		json.Unmarshal(body, req)
+		mgr, _ := tcert.NewMgr(ca.key, ca.cert)
+		batch, err := mgr.GetBatch(&tcert.GetBatchRequest{Count: req.Count, PreKey: "prekey"}, cert)
+		if err != nil {
+			ca.respond(w, http.StatusBadRequest, cfsslapi.NewErrorResponse(err.Error(), 40))
+			return
+		}
+		ca.respond(w, http.StatusOK, cfsslapi.NewSuccessResponse(&api.GetTCertBatchResponse{GetBatchResponse: *batch}))
+	case "/api/v1/cfssl/revoke":
+		req := &api.RevocationRequest{}
+		json.Unmarshal(body, req)
+		if req.Name == "unavailable" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		ca.revoked[req.Name] = req.Reason
+		ca.respond(w, http.StatusOK, cfsslapi.NewSuccessResponse(nil))
+	default:
+		ca.respond(w, http.StatusNotFound, cfsslapi.NewErrorResponse("Not found", 0))
+	}
+}
+
+// sign issues a certificate for the request of an enroll or reenroll, the caller holds ca.mtx
+func (ca *mockCA) sign(w http.ResponseWriter, body []byte, name string) {
+	req := &signer.SignRequest{}
+	json.Unmarshal(body, req)
+	csrPem, _ := pem.Decode([]byte(req.Request))
+	if csrPem == nil {
+		ca.respond(w, http.StatusBadRequest, cfsslapi.NewErrorResponse("Invalid certificate request", 40))
+		return
+	}
+	csr, err := x509.ParseCertificateRequest(csrPem.Bytes)
+	if err == nil {
+		err = csr.CheckSignature()
+	}
+	if err != nil || csr.Subject.CommonName != name {
+		ca.respond(w, http.StatusBadRequest, cfsslapi.NewErrorResponse("Invalid certificate request", 40))
+		return
+	}
+	ca.serial++
+	template := &x509.Certificate{SerialNumber: big.NewInt(ca.serial), Subject: csr.Subject,
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	der, _ := x509.CreateCertificate(rand.Reader, template, ca.cert, csr.PublicKey, ca.key)
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	ca.respond(w, http.StatusOK, cfsslapi.NewSuccessResponse(base64.StdEncoding.EncodeToString(cert)))
+}
+
+func (ca *mockCA) respond(w http.ResponseWriter, status int, response cfsslapi.Response) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,287 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	mspservices "github.com/hyperledger/fabric-sdk-go/msp"
+	"github.com/hyperledger/fabric/bccsp"
+	"github.com/hyperledger/fabric/bccsp/utils"
+	"gopkg.in/yaml.v2"
+)
+
+// The folders of the MSP directory layout
+const (
+	signCertsDir  = "signcerts"
+	keystoreDir   = "keystore"
+	caCertsDir    = "cacerts"
+	adminCertsDir = "admincerts"
+	tlsCACertsDir = "tlscacerts"
+	mspConfigFile = "config.yaml"
+)
+
+// mspConfig is the config.yaml of an MSP directory, naming the MSP of its identity
+type mspConfig struct {
+	MSPID string `yaml:"MSPID"`
+}
+
+// LoadUserFromMSPDir ...
+/**
+ * Load a user from a directory with the MSP layout: its enrollment certificate is the certificate
+ * in signcerts, its private key the matching key in keystore, which is imported in the client's
+ * crypto suite. The certificates of cacerts, admincerts and tlscacerts, which are optional, are
+ * set on the user. The user is named after the common name of its certificate, and its MSP ID
+ * is the MSPID of the config.yaml of the directory, the configured MSP when there is none.
+ * @param {string} mspDir The path of the MSP directory
+ * @returns {User} The user
+ */
+func (c *Client) LoadUserFromMSPDir(mspDir string) (*User, error) {
+	if c.cryptoSuite == nil {
+		return nil, fmt.Errorf("cryptoSuite is nil")
+	}
+	mspID, err := readMSPID(mspDir)
+	if err != nil {
+		return nil, err
+	}
+	signCerts, err := readPEMFiles(filepath.Join(mspDir, signCertsDir), true)
+	if err != nil {
+		return nil, err
+	}
+	if len(signCerts) == 0 {
+		return nil, fmt.Errorf("No certificate in %s", filepath.Join(mspDir, signCertsDir))
+	}
+	cert, err := parseCertificate(signCerts[0])
+	if err != nil {
+		return nil, err
+	}
+	keys, err := readPEMFiles(filepath.Join(mspDir, keystoreDir), true)
+	if err != nil {
+		return nil, err
+	}
+	var der []byte
+	for _, key := range keys {
+		block, _ := pem.Decode(key)
+		if block == nil {
+			continue
+		}
+		if matchesCertificate(block.Bytes, cert) {
+			der = block.Bytes
+			break
+		}
+	}
+	if der == nil {
+		return nil, fmt.Errorf("No private key of %s matches the certificate", filepath.Join(mspDir, keystoreDir))
+	}
+	privateKey, err := c.cryptoSuite.KeyImport(der, &bccsp.ECDSAPrivateKeyImportOpts{Temporary: false})
+	if err != nil {
+		return nil, fmt.Errorf("KeyImport return error: %v", err)
+	}
+
+	user := NewUser(cert.Subject.CommonName)
+	user.SetMspID(mspID)
+	user.SetEnrollmentCertificate(signCerts[0])
+	user.SetPrivateKey(privateKey)
+	if user.caCertificates, err = readPEMFiles(filepath.Join(mspDir, caCertsDir), false); err != nil {
+		return nil, err
+	}
+	if user.adminCertificates, err = readPEMFiles(filepath.Join(mspDir, adminCertsDir), false); err != nil {
+		return nil, err
+	}
+	if user.tlsCACertificates, err = readPEMFiles(filepath.Join(mspDir, tlsCACertsDir), false); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ExportUserToMSPDir ...
+/**
+ * Write a user to a directory with the MSP layout, to be used for example by the peer CLI.
+ * The private key is read from the software key store of the crypto suite, the keys of
+ * an HSM can't be exported. The MSP ID of the user is written to the config.yaml.
+ * @param {User} user The user
+ * @param {string} keyStorePath The directory of the key store holding the user's private key
+ * @param {string} mspDir The path of the MSP directory, created if it doesn't exist
+ */
+func (c *Client) ExportUserToMSPDir(user *User, keyStorePath string, mspDir string) error {
+	if user == nil {
+		return fmt.Errorf("user is nil")
+	}
+	if user.GetPrivateKey() == nil {
+		return fmt.Errorf("User %s has no private key", user.GetName())
+	}
+	cert, err := parseCertificate(user.GetEnrollmentCertificate())
+	if err != nil {
+		return err
+	}
+	privateKey, err := mspservices.PrivateKeyPEM(keyStorePath, user.GetPrivateKey())
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(privateKey)
+	if block == nil {
+		return fmt.Errorf("The private key is not PEM encoded")
+	}
+	if !matchesCertificate(block.Bytes, cert) {
+		return fmt.Errorf("The private key doesn't match the certificate of user %s", user.GetName())
+	}
+
+	// the key is named after its SKI like in the keystore of the BCCSP
+	keyName := hex.EncodeToString(user.GetPrivateKey().SKI()) + "_sk"
+	if err := writePEMFiles(filepath.Join(mspDir, signCertsDir), user.GetName()+"-cert", [][]byte{user.GetEnrollmentCertificate()}, 0644); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(mspDir, keystoreDir), 0700); err != nil {
+		return fmt.Errorf("Failed to create %s: %v", filepath.Join(mspDir, keystoreDir), err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(mspDir, keystoreDir, keyName), privateKey, 0600); err != nil {
+		return fmt.Errorf("Failed to write the private key: %v", err)
+	}
+	if err := writePEMFiles(filepath.Join(mspDir, caCertsDir), "cacert", user.GetCACertificates(), 0644); err != nil {
+		return err
+	}
+	if err := writePEMFiles(filepath.Join(mspDir, adminCertsDir), "admincert", user.GetAdminCertificates(), 0644); err != nil {
+		return err
+	}
+	if err := writePEMFiles(filepath.Join(mspDir, tlsCACertsDir), "tlscacert", user.GetTLSCACertificates(), 0644); err != nil {
+		return err
+	}
+	if user.GetMspID() == "" {
+		return nil
+	}
+	config, err := yaml.Marshal(&mspConfig{MSPID: user.GetMspID()})
+	if err != nil {
+		return fmt.Errorf("Failed to marshal %s: %v", mspConfigFile, err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(mspDir, mspConfigFile), config, 0644); err != nil {
+		return fmt.Errorf("Failed to write %s: %v", filepath.Join(mspDir, mspConfigFile), err)
+	}
+	return nil
+}
+
+/**
+ * private internal method reading the MSP ID of the config.yaml of an MSP directory,
+ * empty when there is no config.yaml or it has no MSP ID
+ */
+func readMSPID(mspDir string) (string, error) {
+	raw, err := ioutil.ReadFile(filepath.Join(mspDir, mspConfigFile))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("Failed to read %s: %v", filepath.Join(mspDir, mspConfigFile), err)
+	}
+	config := &mspConfig{}
+	if err := yaml.Unmarshal(raw, config); err != nil {
+		return "", fmt.Errorf("Failed to parse %s: %v", filepath.Join(mspDir, mspConfigFile), err)
+	}
+	return config.MSPID, nil
+}
+
+/**
+ * private internal method reading the files of a directory sorted by name, a missing
+ * directory is an error only when it is required
+ */
+func readPEMFiles(dir string, required bool) ([][]byte, error) {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) && !required {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s: %v", dir, err)
+	}
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		if !file.IsDir() {
+			names = append(names, file.Name())
+		}
+	}
+	sort.Strings(names)
+	contents := make([][]byte, 0, len(names))
+	for _, name := range names {
+		content, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read %s: %v", filepath.Join(dir, name), err)
+		}
+		contents = append(contents, content)
+	}
+	return contents, nil
+}
+
+/**
+ * private internal method writing PEM files named prefix.pem, or prefix-i.pem when there are several
+ */
+func writePEMFiles(dir string, prefix string, contents [][]byte, perm os.FileMode) error {
+	if len(contents) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("Failed to create %s: %v", dir, err)
+	}
+	for i, content := range contents {
+		name := prefix + ".pem"
+		if len(contents) > 1 {
+			name = fmt.Sprintf("%s-%d.pem", prefix, i)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), content, perm); err != nil {
+			return fmt.Errorf("Failed to write %s: %v", filepath.Join(dir, name), err)
+		}
+	}
+	return nil
+}
+
+/**
+ * private internal method parsing a PEM encoded certificate
+ */
+func parseCertificate(certPEM []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, fmt.Errorf("The certificate is not PEM encoded")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("x509 ParseCertificate return error: %v", err)
+	}
+	return cert, nil
+}
+
+/**
+ * private internal method checking that a DER encoded ECDSA private key is the key of the certificate
+ */
+func matchesCertificate(der []byte, cert *x509.Certificate) bool {
+	key, err := utils.DERToPrivateKey(der)
+	if err != nil {
+		return false
+	}
+	privateKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return false
+	}
+	publicKey, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	return ok && privateKey.X.Cmp(publicKey.X) == 0 && privateKey.Y.Cmp(publicKey.Y) == 0
+}
@@ -0,0 +1,176 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/bccsp"
+)
+
+func TestLoadUserFromMSPDir(t *testing.T) {
+	client := setupTestClient(t)
+	dir, err := ioutil.TempDir("", "mspdir")
+	if err != nil {
+		t.Fatalf("TempDir return error[%s]", err)
+	}
+	defer os.RemoveAll(dir)
+	caCert, cert := writeTestMSPDir(t, dir)
+
+	user, err := client.LoadUserFromMSPDir(dir)
+	if err != nil {
+		t.Fatalf("LoadUserFromMSPDir return error[%s]", err)
+	}
+	if user.GetName() != "peeradmin" || user.GetMspID() != "Org1MSP" || !bytes.Equal(user.GetEnrollmentCertificate(), cert) {
+		t.Fatalf("LoadUserFromMSPDir loaded the wrong user")
+	}
+	if len(user.GetCACertificates()) != 1 || !bytes.Equal(user.GetCACertificates()[0], caCert) ||
+		len(user.GetAdminCertificates()) != 1 || !bytes.Equal(user.GetAdminCertificates()[0], cert) || len(user.GetTLSCACertificates()) != 0 {
+		t.Fatalf("LoadUserFromMSPDir loaded the wrong MSP certificates")
+	}
+	// the imported key signs for the certificate
+	digest := []byte("0123456789abcdef0123456789abcdef")
+	signature, err := client.GetCryptoSuite().Sign(user.GetPrivateKey(), digest, nil)
+	if err != nil {
+		t.Fatalf("Sign return error[%s]", err)
+	}
+	x509Cert, err := parseCertificate(cert)
+	if err != nil {
+		t.Fatalf("parseCertificate return error[%s]", err)
+	}
+	publicKey, err := client.GetCryptoSuite().KeyImport(x509Cert, &bccsp.X509PublicKeyImportOpts{Temporary: true})
+	if err != nil {
+		t.Fatalf("KeyImport return error[%s]", err)
+	}
+	if valid, err := client.GetCryptoSuite().Verify(publicKey, signature, digest, nil); err != nil || !valid {
+		t.Fatalf("The private key of the user doesn't match its certificate")
+	}
+
+	// the user is exported to the same layout, with the private key of the key store
+	exportDir := filepath.Join(dir, "export")
+	if err := client.ExportUserToMSPDir(user, "/tmp/keystoretest", exportDir); err != nil {
+		t.Fatalf("ExportUserToMSPDir return error[%s]", err)
+	}
+	exported, err := client.LoadUserFromMSPDir(exportDir)
+	if err != nil {
+		t.Fatalf("LoadUserFromMSPDir return error[%s]", err)
+	}
+	if exported.GetName() != "peeradmin" || exported.GetMspID() != "Org1MSP" || !bytes.Equal(exported.GetEnrollmentCertificate(), cert) ||
+		!bytes.Equal(exported.GetPrivateKey().SKI(), user.GetPrivateKey().SKI()) ||
+		len(exported.GetCACertificates()) != 1 || len(exported.GetAdminCertificates()) != 1 {
+		t.Fatalf("The exported user differs from the loaded user")
+	}
+
+	// a key which is not in the key store can't be exported
+	temporaryKey, err := client.GetCryptoSuite().KeyGen(&bccsp.ECDSAKeyGenOpts{Temporary: true})
+	if err != nil {
+		t.Fatalf("KeyGen return error[%s]", err)
+	}
+	user.SetPrivateKey(temporaryKey)
+	if err := client.ExportUserToMSPDir(user, "/tmp/keystoretest", filepath.Join(dir, "other")); err == nil ||
+		!strings.Contains(err.Error(), "is not exportable") {
+		t.Fatalf("ExportUserToMSPDir didn't return right error: %v", err)
+	}
+
+	// without a config.yaml the user is of the configured MSP
+	os.Remove(filepath.Join(exportDir, "config.yaml"))
+	if exported, err := client.LoadUserFromMSPDir(exportDir); err != nil || exported.mspID != "" {
+		t.Fatalf("LoadUserFromMSPDir didn't load a user of the configured MSP: %v", err)
+	}
+
+	// the keystore has no key of the certificate
+	os.RemoveAll(filepath.Join(exportDir, "keystore"))
+	os.Mkdir(filepath.Join(exportDir, "keystore"), 0700)
+	if _, err := client.LoadUserFromMSPDir(exportDir); err == nil {
+		t.Fatalf("LoadUserFromMSPDir didn't return error")
+	}
+	if _, err := client.LoadUserFromMSPDir(filepath.Join(dir, "missing")); err == nil {
+		t.Fatalf("LoadUserFromMSPDir didn't return error")
+	}
+}
+
+// writeTestMSPDir writes an MSP directory of Org1MSP whose keystore holds the key of the signing
+// certificate and another key, and returns the CA certificate and signing certificate
+func writeTestMSPDir(t *testing.T, dir string) ([]byte, []byte) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey return error[%s]", err)
+	}
+	caTemplate := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "ca.org1"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour), IsCA: true,
+		BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate return error[%s]", err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey return error[%s]", err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: "peeradmin"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour), KeyUsage: x509.KeyUsageDigitalSignature}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, caTemplate, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate return error[%s]", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey return error[%s]", err)
+	}
+	otherDER, err := x509.MarshalECPrivateKey(caKey)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey return error[%s]", err)
+	}
+
+	caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	files := map[string][]byte{
+		"cacerts/ca.org1-cert.pem":      caCert,
+		"admincerts/peeradmin-cert.pem": cert,
+		"signcerts/peeradmin-cert.pem":  cert,
+		"keystore/a_sk":                 pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: otherDER}),
+		"keystore/b_sk":                 keyPEM,
+		"config.yaml":                   []byte("MSPID: Org1MSP\n"),
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("MkdirAll return error[%s]", err)
+		}
+		if err := ioutil.WriteFile(path, content, 0600); err != nil {
+			t.Fatalf("WriteFile return error[%s]", err)
+		}
+	}
+	return caCert, cert
+}
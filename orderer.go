@@ -25,7 +25,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/golang/protobuf/proto"
 	config "github.com/hyperledger/fabric-sdk-go/config"
+	events "github.com/hyperledger/fabric-sdk-go/events"
 	"github.com/hyperledger/fabric/protos/common"
 	ab "github.com/hyperledger/fabric/protos/orderer"
 	"golang.org/x/net/context"
@@ -42,6 +44,7 @@ import (
 type Orderer struct {
 	url            string
 	grpcDialOption []grpc.DialOption
+	clientContext  *Client
 }
 
 // CreateNewOrderer ...
@@ -69,6 +72,25 @@ func (o *Orderer) GetURL() string {
 	return o.url
 }
 
+// SetClientContext ...
+/**
+ * Set the client whose user context signs the requests sent by the Orderer, such as
+ * the seek requests of Deliver. Chain.AddOrderer sets the client of the chain when
+ * none is set.
+ * @param {Client} client The client context.
+ */
+func (o *Orderer) SetClientContext(client *Client) {
+	o.clientContext = client
+}
+
+// GetClientContext ...
+/**
+ * @returns {Client} The client signing the requests sent by the Orderer.
+ */
+func (o *Orderer) GetClientContext() *Client {
+	return o.clientContext
+}
+
 // SendBroadcast ...
 /**
  * Send the created transaction to Orderer.
@@ -110,3 +132,162 @@ func (o *Orderer) SendBroadcast(envelope *common.Envelope) error {
 	<-done
 	return broadcastErr
 }
+
+// Deliver ...
+/**
+ * Retrieves the blocks of a chain between the start and the stop positions (both inclusive)
+ * from the Orderer. The seek request is signed with the user context of the client context.
+ * The blocks are sent on the returned block channel in order. Both channels are closed once
+ * the Orderer has delivered the stop block, an error has occurred or the context is done.
+ * @param {Context} ctx The context used to cancel the delivery.
+ * @param {string} chainID The chain to retrieve blocks from.
+ * @param {SeekPosition} start The position of the first block to deliver.
+ * @param {SeekPosition} stop The position of the last block to deliver.
+ * @returns {chan Block} The channel the blocks are delivered on.
+ * @returns {chan error} The channel errors are reported on.
+ */
+func (o *Orderer) Deliver(ctx context.Context, chainID string, start *ab.SeekPosition, stop *ab.SeekPosition) (<-chan *common.Block, <-chan error) {
+	blocks := make(chan *common.Block)
+	errs := make(chan error, 1)
+
+	envelope, err := o.createSeekEnvelope(chainID, start, stop)
+	if err != nil {
+		errs <- err
+		close(blocks)
+		close(errs)
+		return blocks, errs
+	}
+
+	go func() {
+		defer close(errs)
+		defer close(blocks)
+
+		conn, err := grpc.Dial(o.url, o.grpcDialOption...)
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer conn.Close()
+
+		deliverStream, err := ab.NewAtomicBroadcastClient(conn).Deliver(ctx)
+		if err != nil {
+			errs <- fmt.Errorf("Error Create NewAtomicBroadcastClient %v", err)
+			return
+		}
+		if err := deliverStream.Send(envelope); err != nil {
+			errs <- fmt.Errorf("Failed to send a seek envelope to orderer: %v", err)
+			return
+		}
+		deliverStream.CloseSend()
+
+		for {
+			deliverResponse, err := deliverStream.Recv()
+			logger.Debugf("Orderer.deliverStream - response:%v, error:%v\n", deliverResponse, err)
+			if err != nil {
+				if err != io.EOF && ctx.Err() == nil {
+					errs <- fmt.Errorf("Error deliver response : %v", err)
+				}
+				return
+			}
+			switch t := deliverResponse.Type.(type) {
+			case *ab.DeliverResponse_Block:
+				select {
+				case blocks <- t.Block:
+				case <-ctx.Done():
+					return
+				}
+			case *ab.DeliverResponse_Status:
+				if t.Status != common.Status_SUCCESS {
+					errs <- fmt.Errorf("deliver response is not success : %v", t.Status)
+				}
+				return
+			default:
+				errs <- fmt.Errorf("unknown deliver response type %T", t)
+				return
+			}
+		}
+	}()
+
+	return blocks, errs
+}
+
+// NewBlockReplay ...
+/**
+ * Returns an events.BlockReplay retrieving the blocks of a chain from the Orderer
+ * with Deliver, up to the newest block at the time of the replay.
+ * @param {string} chainID The chain to retrieve blocks from.
+ */
+func (o *Orderer) NewBlockReplay(chainID string) events.BlockReplay {
+	return func(ctx context.Context, start uint64) (<-chan *common.Block, <-chan error) {
+		newestBlocks, errs := o.Deliver(ctx, chainID, NewSeekNewest(), NewSeekNewest())
+		var newest *common.Block
+		for block := range newestBlocks {
+			newest = block
+		}
+		err := <-errs
+		if err == nil && (newest == nil || newest.Header == nil) {
+			err = fmt.Errorf("Orderer did not deliver the newest block of chain %s", chainID)
+		}
+		if err != nil || start > newest.Header.Number {
+			// nothing to replay
+			blocks := make(chan *common.Block)
+			replayErrs := make(chan error, 1)
+			if err != nil {
+				replayErrs <- err
+			}
+			close(blocks)
+			close(replayErrs)
+			return blocks, replayErrs
+		}
+		return o.Deliver(ctx, chainID, NewSeekSpecified(start), NewSeekSpecified(newest.Header.Number))
+	}
+}
+
+// createSeekEnvelope creates the signed envelope carrying the seek request
+func (o *Orderer) createSeekEnvelope(chainID string, start *ab.SeekPosition, stop *ab.SeekPosition) (*common.Envelope, error) {
+	if chainID == "" {
+		return nil, fmt.Errorf("chainID is empty")
+	}
+	if start == nil || stop == nil {
+		return nil, fmt.Errorf("start and stop positions are required")
+	}
+	client := o.clientContext
+	if client == nil {
+		return nil, fmt.Errorf("Orderer has no client context")
+	}
+	user, err := client.GetUserContext("")
+	if err != nil {
+		return nil, fmt.Errorf("GetUserContext return error: %s", err)
+	}
+	seekInfo := &ab.SeekInfo{Start: start, Stop: stop, Behavior: ab.SeekInfo_BLOCK_UNTIL_READY}
+	seekInfoBytes, err := proto.Marshal(seekInfo)
+	if err != nil {
+		return nil, fmt.Errorf("Could not marshal seek info: %v", err)
+	}
+	return createSignedEnvelope(client, user, chainID, common.HeaderType_DELIVER_SEEK_INFO, seekInfoBytes)
+}
+
+// NewSeekOldest ...
+/**
+ * Returns the position of the oldest block of a chain.
+ */
+func NewSeekOldest() *ab.SeekPosition {
+	return &ab.SeekPosition{Type: &ab.SeekPosition_Oldest{Oldest: &ab.SeekOldest{}}}
+}
+
+// NewSeekNewest ...
+/**
+ * Returns the position of the newest block of a chain.
+ */
+func NewSeekNewest() *ab.SeekPosition {
+	return &ab.SeekPosition{Type: &ab.SeekPosition_Newest{Newest: &ab.SeekNewest{}}}
+}
+
+// NewSeekSpecified ...
+/**
+ * Returns the position of the block with the given number.
+ * @param {uint64} number The block number.
+ */
+func NewSeekSpecified(number uint64) *ab.SeekPosition {
+	return &ab.SeekPosition{Type: &ab.SeekPosition_Specified{Specified: &ab.SeekSpecified{Number: number}}}
+}
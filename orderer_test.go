@@ -21,6 +21,10 @@ package fabricsdk
 
 import (
 	"testing"
+
+	"github.com/hyperledger/fabric/protos/common"
+	protos_utils "github.com/hyperledger/fabric/protos/utils"
+	"golang.org/x/net/context"
 )
 
 //
@@ -100,3 +104,124 @@ func TestOrdererViaChainNilData(t *testing.T) {
 		t.Fatalf("SendTransaction didn't return right error")
 	}
 }
+
+//
+// Orderer deliver
+//
+// Retrieve blocks from a mock orderer with the Deliver method. Verify that
+// the requested range of blocks is delivered in order and that the seek
+// request is signed and bound to the requested chain.
+//
+func TestOrdererDeliver(t *testing.T) {
+	client := setupTestClient(t)
+	broadcastServer := &mockBroadcastServer{}
+	for i := 0; i < 5; i++ {
+		broadcastServer.blocks = append(broadcastServer.blocks, common.NewBlock(uint64(i), nil))
+	}
+	addr, grpcServer := startMockBroadcastServer(t, broadcastServer)
+	defer grpcServer.Stop()
+	orderer := CreateNewOrderer(addr)
+
+	_, errs := orderer.Deliver(context.Background(), "testchain", NewSeekOldest(), NewSeekNewest())
+	if err := <-errs; err == nil || err.Error() != "Orderer has no client context" {
+		t.Fatalf("Deliver didn't return right error")
+	}
+	orderer.SetClientContext(client)
+
+	blocks, errs := orderer.Deliver(context.Background(), "testchain", NewSeekSpecified(1), NewSeekNewest())
+	var numbers []uint64
+	for block := range blocks {
+		numbers = append(numbers, block.Header.Number)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Deliver return error[%s]", err)
+	}
+	if len(numbers) != 4 || numbers[0] != 1 || numbers[3] != 4 {
+		t.Fatalf("Deliver returned wrong blocks %v", numbers)
+	}
+	envelopes := broadcastServer.getEnvelopes()
+	if len(envelopes) != 1 || len(envelopes[0].Signature) == 0 {
+		t.Fatalf("Seek envelope was not signed")
+	}
+	payload, err := protos_utils.GetPayload(envelopes[0])
+	if err != nil {
+		t.Fatalf("GetPayload return error[%s]", err)
+	}
+	if payload.Header.ChainHeader.ChainID != "testchain" || payload.Header.ChainHeader.Type != int32(common.HeaderType_DELIVER_SEEK_INFO) {
+		t.Fatalf("Seek envelope has wrong header %v", payload.Header.ChainHeader)
+	}
+
+	// genesis block only
+	blocks, errs = orderer.Deliver(context.Background(), "testchain", NewSeekOldest(), NewSeekOldest())
+	numbers = nil
+	for block := range blocks {
+		numbers = append(numbers, block.Header.Number)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Deliver return error[%s]", err)
+	}
+	if len(numbers) != 1 || numbers[0] != 0 {
+		t.Fatalf("Deliver returned wrong blocks %v", numbers)
+	}
+
+	// out of range
+	blocks, errs = orderer.Deliver(context.Background(), "testchain", NewSeekSpecified(3), NewSeekSpecified(10))
+	for range blocks {
+	}
+	if err := <-errs; err == nil {
+		t.Fatalf("Deliver didn't return error for an out of range request")
+	}
+
+	_, errs = orderer.Deliver(context.Background(), "", NewSeekOldest(), NewSeekNewest())
+	if err := <-errs; err == nil || err.Error() != "chainID is empty" {
+		t.Fatalf("Deliver didn't return right error")
+	}
+}
+
+//
+// Orderer block replay
+//
+// Replay the blocks of a chain from a mock orderer. Verify that the blocks
+// from the start block to the newest one are delivered, and that nothing
+// is delivered when the start block is not committed yet.
+//
+func TestOrdererBlockReplay(t *testing.T) {
+	client := setupTestClient(t)
+	broadcastServer := &mockBroadcastServer{}
+	for i := 0; i < 4; i++ {
+		broadcastServer.blocks = append(broadcastServer.blocks, common.NewBlock(uint64(i), nil))
+	}
+	addr, grpcServer := startMockBroadcastServer(t, broadcastServer)
+	defer grpcServer.Stop()
+	chain, err := client.NewChain("testChain-replay")
+	if err != nil {
+		t.Fatalf("NewChain return error[%s]", err)
+	}
+	orderer := CreateNewOrderer(addr)
+	// the orderer signs with the client context of the chain it is added to
+	chain.AddOrderer(orderer)
+	if orderer.GetClientContext() != client {
+		t.Fatalf("AddOrderer didn't set the client context of the orderer")
+	}
+	replay := orderer.NewBlockReplay("testchain")
+
+	blocks, errs := replay(context.Background(), 2)
+	var numbers []uint64
+	for block := range blocks {
+		numbers = append(numbers, block.Header.Number)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Replay return error[%s]", err)
+	}
+	if len(numbers) != 2 || numbers[0] != 2 || numbers[1] != 3 {
+		t.Fatalf("Replay returned wrong blocks %v", numbers)
+	}
+
+	blocks, errs = replay(context.Background(), 4)
+	for block := range blocks {
+		t.Fatalf("Replay returned block %d after the newest block", block.Header.Number)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Replay return error[%s]", err)
+	}
+}
@@ -21,16 +21,52 @@ package fabricsdk
 
 import (
 	"encoding/pem"
+	"fmt"
+	"strings"
+	"sync"
 	"time"
 
+	common "github.com/hyperledger/fabric/protos/common"
 	pb "github.com/hyperledger/fabric/protos/peer"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 
 	config "github.com/hyperledger/fabric-sdk-go/config"
+	events "github.com/hyperledger/fabric-sdk-go/events"
 )
 
+const (
+	// BlockEventType is the AddListener event type of the blocks
+	BlockEventType = "BLOCK"
+	// ChaincodeEventType is the AddListener event type of the chaincode events
+	ChaincodeEventType = "CHAINCODE"
+	// TransactionEventType is the AddListener event type of the transaction status
+	TransactionEventType = "TRANSACTION"
+)
+
+// ChaincodeEventFilter ...
+/**
+ * The event type data of a CHAINCODE listener: the chaincode id and the regex
+ * filtering the event names, see events.EventHub.RegisterChaincodeEvent.
+ */
+type ChaincodeEventFilter struct {
+	ChaincodeID string
+	EventName   string
+}
+
+// eventListener is a listener added to the event source of a peer
+type eventListener struct {
+	eventType string
+	remove    func()
+}
+
+// txListener is a TRANSACTION listener. The event hub takes a single callback per
+// transaction, which notifies all the listeners of the transaction.
+type txListener struct {
+	callback func(string, error)
+}
+
 // Peer ...
 /**
  * The Peer class represents a peer in the target blockchain network to which
@@ -53,6 +89,16 @@ type Peer struct {
 	name                  string
 	roles                 []string
 	enrollmentCertificate *pem.Block
+	eventSourceURL        string
+	// protects the event source and the listeners
+	eventMtx       sync.Mutex
+	eventHub       *events.EventHub
+	listeners      map[string]*eventListener
+	txListeners    map[string][]*txListener
+	nextListenerID int
+	// serializes the registrations on the event hub, which update the event stream
+	// and are made without holding eventMtx
+	registerMtx sync.Mutex
 }
 
 // CreateNewPeer ...
@@ -73,6 +119,62 @@ func CreateNewPeer(url string) *Peer {
 	return &Peer{url: url, grpcDialOption: opts, name: "", roles: nil}
 }
 
+// CreateNewPeerFromConfig ...
+/**
+ * Constructs a Peer given its configuration, the event source is the
+ * event endpoint of the configuration.
+ *
+ * @param {PeerConfig} peerConfig The peer configuration.
+ */
+func CreateNewPeerFromConfig(peerConfig config.PeerConfig) *Peer {
+	p := CreateNewPeer(fmt.Sprintf("%s:%s", peerConfig.Host, peerConfig.Port))
+	if peerConfig.EventHost != "" {
+		p.SetEventSourceURL(fmt.Sprintf("%s:%s", peerConfig.EventHost, peerConfig.EventPort))
+	}
+	return p
+}
+
+// SetEventSourceURL ...
+/**
+ * Set the URL of the peer event source.
+ * @param {string} url The URL with format of "host:port".
+ */
+func (p *Peer) SetEventSourceURL(url string) {
+	p.eventMtx.Lock()
+	defer p.eventMtx.Unlock()
+	p.eventSourceURL = url
+}
+
+// GetEventSourceURL ...
+/**
+ * Get the URL of the peer event source.
+ * @returns {string} The event source address, empty if the peer is not an event source.
+ */
+func (p *Peer) GetEventSourceURL() string {
+	p.eventMtx.Lock()
+	defer p.eventMtx.Unlock()
+	return p.eventSourceURL
+}
+
+// GetEventHub ...
+/**
+ * Get the EventHub of the peer event source. Listeners can be registered
+ * on it before ConnectEventSource is called.
+ * @returns {EventHub} The EventHub of the peer.
+ */
+func (p *Peer) GetEventHub() *events.EventHub {
+	p.eventMtx.Lock()
+	defer p.eventMtx.Unlock()
+	return p.getEventHubLocked()
+}
+
+func (p *Peer) getEventHubLocked() *events.EventHub {
+	if p.eventHub == nil {
+		p.eventHub = events.NewEventHub()
+	}
+	return p.eventHub
+}
+
 // ConnectEventSource ...
 /**
  * Since practically all Peers are event producers, when constructing a Peer instance,
@@ -83,10 +185,51 @@ func CreateNewPeer(url string) *Peer {
  * manage the connection lifecycle to the Peer’s EventHub. It is the responsibility of
  * the Client Application to understand and inform the selected Peer as to which event
  * types it wants to receive and the call back functions to use.
- * @returns {Future} This gives the app a handle to attach “success” and “error” listeners
+ * Listeners can be added before or after the connection.
+ * @returns {error} An error if the peer has no event source URL or the connection failed
  */
-func (p *Peer) ConnectEventSource() {
-	//to do
+func (p *Peer) ConnectEventSource() error {
+	p.eventMtx.Lock()
+	url := p.eventSourceURL
+	eventHub := p.getEventHubLocked()
+	p.eventMtx.Unlock()
+	if url == "" {
+		return fmt.Errorf("Peer %s has no event source URL", p.url)
+	}
+	if eventHub.Isconnected() {
+		return nil
+	}
+	eventHub.SetPeerAddr(url)
+	if err := eventHub.Connect(); err != nil {
+		return fmt.Errorf("Could not connect to event source %s: %s", url, err)
+	}
+	return nil
+}
+
+// DisconnectEventSource ...
+/**
+ * Disconnects the peer event source. The listeners stay registered
+ * and receive events again once the event source is connected.
+ */
+func (p *Peer) DisconnectEventSource() {
+	p.eventMtx.Lock()
+	eventHub := p.eventHub
+	p.eventMtx.Unlock()
+	if eventHub != nil {
+		eventHub.Disconnect()
+	}
+}
+
+// IsEventSourceConnected ...
+/**
+ * Get the connection state of the peer event source.
+ * @returns true if connected to the event source, false otherwise
+ */
+func (p *Peer) IsEventSourceConnected() bool {
+	p.eventMtx.Lock()
+	eventHub := p.eventHub
+	p.eventMtx.Unlock()
+	return eventHub != nil && eventHub.Isconnected()
 }
 
 // IsEventListened ...
@@ -94,12 +237,26 @@ func (p *Peer) ConnectEventSource() {
  * A network call that discovers if at least one listener has been connected to the target
  * Peer for a given event. This helps application instance to decide whether it needs to
  * connect to the event source in a crash recovery or multiple instance deployment.
- * @param {string} eventName required
+ * The peer event service doesn't report the listeners of other application instances,
+ * so only the listeners added to this Peer are known, and peer events are not per chain.
+ * @param {string} eventName required, an event type of AddListener
  * @param {Chain} chain optional
  * @result {bool} Whether the said event has been listened on by some application instance on that chain.
  */
 func (p *Peer) IsEventListened(event string, chain *Chain) (bool, error) {
-	//to do
+	eventType := strings.ToUpper(event)
+	switch eventType {
+	case BlockEventType, ChaincodeEventType, TransactionEventType:
+	default:
+		return false, fmt.Errorf("Unsupported event type %s", event)
+	}
+	p.eventMtx.Lock()
+	defer p.eventMtx.Unlock()
+	for _, l := range p.listeners {
+		if l.eventType == eventType {
+			return true, nil
+		}
+	}
 	return false, nil
 }
 
@@ -115,12 +272,110 @@ func (p *Peer) IsEventListened(event string, chain *Chain) (bool, error) {
  * @param  {object} eventTypeData : Object Specific for event type as necessary, currently needed
  * for “Chaincode” event type, specifying a matching pattern to the event name set in the chaincode(s)
  * being executed on the target Peer, and for “Transaction” event type, specifying the transaction ID
- * @param {struct} eventCallback Client Application class registering for the callback.
+ * (a ChaincodeEventFilter and a string). Several listeners can be added for the same transaction.
+ * @param {struct} eventCallback Client Application class registering for the callback: a
+ * func(*common.Block), func(*pb.ChaincodeEvent) or func(txID string, err error) for the event type.
  * @returns {string} An ID reference to the event listener.
  */
 func (p *Peer) AddListener(eventType string, eventTypeData interface{}, eventCallback interface{}) (string, error) {
-	//to do
-	return "", nil
+	eventType = strings.ToUpper(eventType)
+	p.registerMtx.Lock()
+	defer p.registerMtx.Unlock()
+	eventHub := p.GetEventHub()
+
+	var remove func()
+	switch eventType {
+	case BlockEventType:
+		callback, ok := eventCallback.(func(*common.Block))
+		if !ok {
+			return "", fmt.Errorf("Invalid callback for %s listener: %T", eventType, eventCallback)
+		}
+		cbe := eventHub.RegisterBlockEvent(callback)
+		remove = func() { eventHub.UnregisterBlockEvent(cbe) }
+	case ChaincodeEventType:
+		filter, ok := eventTypeData.(ChaincodeEventFilter)
+		if !ok {
+			return "", fmt.Errorf("Invalid event type data for %s listener: %T", eventType, eventTypeData)
+		}
+		callback, ok := eventCallback.(func(*pb.ChaincodeEvent))
+		if !ok {
+			return "", fmt.Errorf("Invalid callback for %s listener: %T", eventType, eventCallback)
+		}
+		cbe := eventHub.RegisterChaincodeEvent(filter.ChaincodeID, filter.EventName, callback)
+		if cbe == nil {
+			return "", fmt.Errorf("Invalid event name filter %s", filter.EventName)
+		}
+		remove = func() { eventHub.UnregisterChaincodeEvent(cbe) }
+	case TransactionEventType:
+		txID, ok := eventTypeData.(string)
+		if !ok || txID == "" {
+			return "", fmt.Errorf("Invalid event type data for %s listener: %T", eventType, eventTypeData)
+		}
+		callback, ok := eventCallback.(func(string, error))
+		if !ok {
+			return "", fmt.Errorf("Invalid callback for %s listener: %T", eventType, eventCallback)
+		}
+		listener := &txListener{callback: callback}
+		p.eventMtx.Lock()
+		if p.txListeners == nil {
+			p.txListeners = make(map[string][]*txListener)
+		}
+		first := len(p.txListeners[txID]) == 0
+		p.txListeners[txID] = append(p.txListeners[txID], listener)
+		p.eventMtx.Unlock()
+		if first {
+			eventHub.RegisterTxEvent(txID, p.notifyTxListeners)
+		}
+		remove = func() { p.removeTxListener(eventHub, txID, listener) }
+	default:
+		return "", fmt.Errorf("Unsupported event type %s", eventType)
+	}
+
+	p.eventMtx.Lock()
+	defer p.eventMtx.Unlock()
+	if p.listeners == nil {
+		p.listeners = make(map[string]*eventListener)
+	}
+	p.nextListenerID++
+	ref := fmt.Sprintf("%s-%d", eventType, p.nextListenerID)
+	p.listeners[ref] = &eventListener{eventType: eventType, remove: remove}
+	return ref, nil
+}
+
+/**
+ * private internal callback notifying the TRANSACTION listeners of a transaction
+ */
+func (p *Peer) notifyTxListeners(txID string, err error) {
+	p.eventMtx.Lock()
+	listeners := p.txListeners[txID]
+	p.eventMtx.Unlock()
+	for _, l := range listeners {
+		l.callback(txID, err)
+	}
+}
+
+/**
+ * private internal method removing a TRANSACTION listener, the transaction is
+ * unregistered from the event hub with its last listener. Must be called with registerMtx held.
+ */
+func (p *Peer) removeTxListener(eventHub *events.EventHub, txID string, listener *txListener) {
+	p.eventMtx.Lock()
+	// build a new slice, the current one may be in use by a notification
+	remaining := make([]*txListener, 0, len(p.txListeners[txID]))
+	for _, l := range p.txListeners[txID] {
+		if l != listener {
+			remaining = append(remaining, l)
+		}
+	}
+	if len(remaining) == 0 {
+		delete(p.txListeners, txID)
+	} else {
+		p.txListeners[txID] = remaining
+	}
+	p.eventMtx.Unlock()
+	if len(remaining) == 0 {
+		eventHub.UnregisterTxEvent(txID)
+	}
 }
 
 // RemoveListener ...
@@ -130,8 +385,17 @@ func (p *Peer) AddListener(eventType string, eventTypeData interface{}, eventCal
  * @return {bool} Success / Failure status
  */
 func (p *Peer) RemoveListener(eventListenerRef string) (bool, error) {
-	return false, nil
-	//to do
+	p.registerMtx.Lock()
+	defer p.registerMtx.Unlock()
+	p.eventMtx.Lock()
+	l, ok := p.listeners[eventListenerRef]
+	delete(p.listeners, eventListenerRef)
+	p.eventMtx.Unlock()
+	if !ok {
+		return false, fmt.Errorf("Unknown event listener %s", eventListenerRef)
+	}
+	l.remove()
+	return true, nil
 }
 
 // GetName ...
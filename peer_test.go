@@ -21,6 +21,11 @@ package fabricsdk
 
 import (
 	"testing"
+
+	"github.com/golang/protobuf/proto"
+	config "github.com/hyperledger/fabric-sdk-go/config"
+	common "github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric/protos/peer"
 )
 
 //
@@ -98,3 +103,146 @@ func TestPeerViaChainNilData(t *testing.T) {
 		t.Fatalf("SendTransactionProposal didn't return right error")
 	}
 }
+
+//
+// Peer listeners
+//
+// Add a listener of each event type to the peer event source and verify
+// that the events are delivered until the listener is removed.
+//
+func TestPeerListeners(t *testing.T) {
+	peer := CreateNewPeer("localhost:7050")
+	var blocks, ccEvents int
+	var txStatus []string
+	blockRef, err := peer.AddListener("Block", nil, func(*common.Block) { blocks++ })
+	if err != nil {
+		t.Fatalf("AddListener return error[%s]", err)
+	}
+	if _, err := peer.AddListener(ChaincodeEventType, ChaincodeEventFilter{ChaincodeID: "mycc", EventName: "^transfer"},
+		func(*pb.ChaincodeEvent) { ccEvents++ }); err != nil {
+		t.Fatalf("AddListener return error[%s]", err)
+	}
+	if _, err := peer.AddListener(TransactionEventType, "tx1", func(txID string, err error) {
+		txStatus = append(txStatus, txID)
+	}); err != nil {
+		t.Fatalf("AddListener return error[%s]", err)
+	}
+
+	eventHub := peer.GetEventHub()
+	eventHub.Recv(&pb.Event{Event: &pb.Event_Block{Block: &common.Block{Header: &common.BlockHeader{Number: 1}}}})
+	eventHub.Recv(&pb.Event{Event: &pb.Event_ChaincodeEvent{ChaincodeEvent: &pb.ChaincodeEvent{ChaincodeID: "mycc", TxID: "tx1", EventName: "transfer"}}})
+	if blocks != 1 || ccEvents != 1 {
+		t.Fatalf("Listeners received %d blocks and %d chaincode events, expected 1 and 1", blocks, ccEvents)
+	}
+	if listened, err := peer.IsEventListened(BlockEventType, nil); err != nil || !listened {
+		t.Fatalf("IsEventListened returned %t, %v for a block listener", listened, err)
+	}
+
+	if removed, err := peer.RemoveListener(blockRef); err != nil || !removed {
+		t.Fatalf("RemoveListener returned %t, %v", removed, err)
+	}
+	eventHub.Recv(&pb.Event{Event: &pb.Event_Block{Block: &common.Block{Header: &common.BlockHeader{Number: 2}}}})
+	if blocks != 1 {
+		t.Fatalf("Removed listener received a block")
+	}
+	if listened, _ := peer.IsEventListened(BlockEventType, nil); listened {
+		t.Fatalf("IsEventListened returned true without block listener")
+	}
+	if _, err := peer.RemoveListener(blockRef); err == nil || err.Error() != "Unknown event listener "+blockRef {
+		t.Fatalf("RemoveListener didn't return right error: %v", err)
+	}
+}
+
+//
+// Peer transaction listeners
+//
+// Verify that the listeners of the same transaction are all notified,
+// and that removing one of them keeps the others.
+//
+func TestPeerTransactionListeners(t *testing.T) {
+	peer := CreateNewPeer("localhost:7050")
+	var first, second []string
+	firstRef, err := peer.AddListener(TransactionEventType, "tx1", func(txID string, err error) { first = append(first, txID) })
+	if err != nil {
+		t.Fatalf("AddListener return error[%s]", err)
+	}
+	secondRef, err := peer.AddListener(TransactionEventType, "tx1", func(txID string, err error) { second = append(second, txID) })
+	if err != nil {
+		t.Fatalf("AddListener return error[%s]", err)
+	}
+
+	eventHub := peer.GetEventHub()
+	eventHub.Recv(&pb.Event{Event: &pb.Event_Block{Block: transactionBlock(t, 1, "tx1")}})
+	if len(first) != 1 || len(second) != 1 {
+		t.Fatalf("Listeners were notified %d and %d times, expected 1 and 1", len(first), len(second))
+	}
+
+	if _, err := peer.RemoveListener(firstRef); err != nil {
+		t.Fatalf("RemoveListener return error[%s]", err)
+	}
+	eventHub.Recv(&pb.Event{Event: &pb.Event_Block{Block: transactionBlock(t, 2, "tx1")}})
+	if len(first) != 1 || len(second) != 2 {
+		t.Fatalf("Listeners were notified %d and %d times, expected 1 and 2", len(first), len(second))
+	}
+	if listened, _ := peer.IsEventListened(TransactionEventType, nil); !listened {
+		t.Fatalf("IsEventListened returned false with a transaction listener")
+	}
+
+	if _, err := peer.RemoveListener(secondRef); err != nil {
+		t.Fatalf("RemoveListener return error[%s]", err)
+	}
+	eventHub.Recv(&pb.Event{Event: &pb.Event_Block{Block: transactionBlock(t, 3, "tx1")}})
+	if len(second) != 2 {
+		t.Fatalf("Removed listener was notified")
+	}
+}
+
+func transactionBlock(t *testing.T, number uint64, txID string) *common.Block {
+	payload, err := proto.Marshal(&common.Payload{Header: &common.Header{ChainHeader: &common.ChainHeader{TxID: txID}}})
+	if err != nil {
+		t.Fatalf("Marshal return error[%s]", err)
+	}
+	envelope, err := proto.Marshal(&common.Envelope{Payload: payload})
+	if err != nil {
+		t.Fatalf("Marshal return error[%s]", err)
+	}
+	return &common.Block{Header: &common.BlockHeader{Number: number}, Data: &common.BlockData{Data: [][]byte{envelope}}}
+}
+
+//
+// Peer listeners invalid arguments
+//
+// Verify that listeners of an unknown event type, or with a callback
+// or event type data not matching the event type, are rejected.
+//
+func TestPeerListenersInvalid(t *testing.T) {
+	peer := CreateNewPeer("localhost:7050")
+	if _, err := peer.AddListener("CONFIG", nil, func(*common.Block) {}); err == nil || err.Error() != "Unsupported event type CONFIG" {
+		t.Fatalf("AddListener didn't return right error: %v", err)
+	}
+	if _, err := peer.AddListener(BlockEventType, nil, func(string, error) {}); err == nil {
+		t.Fatalf("AddListener accepted a tx callback for block events")
+	}
+	if _, err := peer.AddListener(ChaincodeEventType, "mycc", func(*pb.ChaincodeEvent) {}); err == nil {
+		t.Fatalf("AddListener accepted chaincode events without filter")
+	}
+	if _, err := peer.AddListener(TransactionEventType, "", func(string, error) {}); err == nil {
+		t.Fatalf("AddListener accepted a transaction without id")
+	}
+	if err := peer.ConnectEventSource(); err == nil || err.Error() != "Peer localhost:7050 has no event source URL" {
+		t.Fatalf("ConnectEventSource didn't return right error: %v", err)
+	}
+}
+
+//
+// Peer from configuration
+//
+// Verify that the event endpoint of the peer configuration is the
+// event source of the peer.
+//
+func TestCreateNewPeerFromConfig(t *testing.T) {
+	peer := CreateNewPeerFromConfig(config.PeerConfig{Host: "localhost", Port: "7051", EventHost: "localhost", EventPort: "7053"})
+	if peer.GetURL() != "localhost:7051" || peer.GetEventSourceURL() != "localhost:7053" {
+		t.Fatalf("Peer has URL %s and event source %s", peer.GetURL(), peer.GetEventSourceURL())
+	}
+}
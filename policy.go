@@ -0,0 +1,227 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	msp "github.com/hyperledger/fabric/msp"
+	"github.com/hyperledger/fabric/protos/common"
+	mb "github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// EndorsementPolicy evaluates a signature policy against the endorsements collected for a transaction,
+// the same way the committing peers validate it
+type EndorsementPolicy struct {
+	envelope *common.SignaturePolicyEnvelope
+	// admin certificates (DER) keyed by MSP identifier
+	admins map[string][][]byte
+}
+
+// NewEndorsementPolicy ...
+/**
+ * Creates an endorsement policy evaluator.
+ * @param {SignaturePolicyEnvelope} envelope The endorsement policy of the chaincode.
+ * @param {[]MSPConfig} msps The MSP configurations of the chain, used to recognize admin identities. May be nil.
+ */
+func NewEndorsementPolicy(envelope *common.SignaturePolicyEnvelope, msps []*mb.MSPConfig) (*EndorsementPolicy, error) {
+	if envelope == nil || envelope.Policy == nil {
+		return nil, fmt.Errorf("policy is nil")
+	}
+	if err := checkSignaturePolicy(envelope.Policy, len(envelope.Identities)); err != nil {
+		return nil, err
+	}
+	admins := make(map[string][][]byte)
+	for _, m := range msps {
+		fabricMSPConfig := &mb.FabricMSPConfig{}
+		if err := proto.Unmarshal(m.Config, fabricMSPConfig); err != nil {
+			return nil, fmt.Errorf("Could not unmarshal MSP config: %s", err)
+		}
+		for _, admin := range fabricMSPConfig.Admins {
+			admins[fabricMSPConfig.Name] = append(admins[fabricMSPConfig.Name], certificateDER(admin))
+		}
+	}
+	return &EndorsementPolicy{envelope: envelope, admins: admins}, nil
+}
+
+// Evaluate ...
+/**
+ * Checks whether the endorsements satisfy the policy. Each endorsement counts at most once.
+ * @param {[]Endorsement} endorsements The endorsements of the proposal responses.
+ * @returns An error describing why the policy is not satisfied, nil otherwise.
+ */
+func (p *EndorsementPolicy) Evaluate(endorsements []*pb.Endorsement) error {
+	identities := make([]*msp.SerializedIdentity, len(endorsements))
+	for i, e := range endorsements {
+		if e == nil {
+			return fmt.Errorf("endorsement %d is nil", i)
+		}
+		identity := &msp.SerializedIdentity{}
+		if err := proto.Unmarshal(e.Endorser, identity); err != nil {
+			return fmt.Errorf("Could not unmarshal the identity of endorsement %d: %s", i, err)
+		}
+		identities[i] = identity
+	}
+
+	// the principals each identity satisfies are computed once, the search below tries many assignments
+	matches := make([][]bool, len(p.envelope.Identities))
+	for j, principal := range p.envelope.Identities {
+		matches[j] = make([]bool, len(identities))
+		for i, identity := range identities {
+			matches[j][i] = p.satisfiesPrincipal(identity, principal)
+		}
+	}
+	used := make([]bool, len(identities))
+	if !p.evaluate(p.envelope.Policy, matches, used, func() bool { return true }) {
+		return fmt.Errorf("Endorsement policy is not satisfied by the %d endorsement(s)", len(endorsements))
+	}
+	return nil
+}
+
+// evaluate searches for an assignment of unused identities satisfying a policy node, such that the rest
+// of the policy, checked by next, is also satisfied. Identities are marked as used while an assignment is
+// tried and unmarked when backtracking, so a principal taking an identity another principal needed does
+// not make the whole policy fail.
+func (p *EndorsementPolicy) evaluate(policy *common.SignaturePolicy, matches [][]bool, used []bool, next func() bool) bool {
+	switch t := policy.Type.(type) {
+	case *common.SignaturePolicy_SignedBy:
+		for i, match := range matches[t.SignedBy] {
+			if match && !used[i] {
+				used[i] = true
+				satisfied := next()
+				used[i] = false
+				if satisfied {
+					return true
+				}
+			}
+		}
+		return false
+	case *common.SignaturePolicy_From:
+		policies := t.From.Policies
+		// chooses which of the remaining sub-policies are satisfied, from policies[j] on
+		var choose func(j int, needed int32) bool
+		choose = func(j int, needed int32) bool {
+			if needed <= 0 {
+				return next()
+			}
+			if int32(len(policies)-j) < needed {
+				return false
+			}
+			if p.evaluate(policies[j], matches, used, func() bool { return choose(j+1, needed-1) }) {
+				return true
+			}
+			return choose(j+1, needed)
+		}
+		return choose(0, t.From.N)
+	}
+	return false
+}
+
+// satisfiesPrincipal checks whether the identity matches the principal
+func (p *EndorsementPolicy) satisfiesPrincipal(identity *msp.SerializedIdentity, principal *common.MSPPrincipal) bool {
+	switch principal.PrincipalClassification {
+	case common.MSPPrincipal_ByMSPRole:
+		role := &common.MSPRole{}
+		if err := proto.Unmarshal(principal.Principal, role); err != nil {
+			logger.Warningf("Could not unmarshal MSPRole principal: %s\n", err)
+			return false
+		}
+		if role.MSPIdentifier != identity.Mspid {
+			return false
+		}
+		switch role.Role {
+		case common.MSPRole_Member:
+			return true
+		case common.MSPRole_Admin:
+			cert := certificateDER(identity.IdBytes)
+			for _, admin := range p.admins[identity.Mspid] {
+				if bytes.Equal(admin, cert) {
+					return true
+				}
+			}
+		}
+		return false
+	case common.MSPPrincipal_ByOrganizationUnit:
+		ou := &common.OrganizationUnit{}
+		if err := proto.Unmarshal(principal.Principal, ou); err != nil {
+			logger.Warningf("Could not unmarshal OrganizationUnit principal: %s\n", err)
+			return false
+		}
+		if ou.MSPIdentifier != identity.Mspid {
+			return false
+		}
+		cert, err := x509.ParseCertificate(certificateDER(identity.IdBytes))
+		if err != nil {
+			return false
+		}
+		for _, unit := range cert.Subject.OrganizationalUnit {
+			if unit == ou.OrganizationUnitIdentifier {
+				return true
+			}
+		}
+		return false
+	case common.MSPPrincipal_ByIdentity:
+		expected := &msp.SerializedIdentity{}
+		if err := proto.Unmarshal(principal.Principal, expected); err != nil {
+			logger.Warningf("Could not unmarshal identity principal: %s\n", err)
+			return false
+		}
+		return expected.Mspid == identity.Mspid && bytes.Equal(certificateDER(expected.IdBytes), certificateDER(identity.IdBytes))
+	}
+	return false
+}
+
+// checkSignaturePolicy checks that every SignedBy node references an existing identity
+func checkSignaturePolicy(policy *common.SignaturePolicy, identities int) error {
+	switch t := policy.Type.(type) {
+	case *common.SignaturePolicy_SignedBy:
+		if t.SignedBy < 0 || int(t.SignedBy) >= identities {
+			return fmt.Errorf("SignedBy references identity %d, but the policy has %d identities", t.SignedBy, identities)
+		}
+	case *common.SignaturePolicy_From:
+		if t.From == nil {
+			return fmt.Errorf("NOutOf policy is nil")
+		}
+		for _, sub := range t.From.Policies {
+			if sub == nil {
+				return fmt.Errorf("NOutOf policy contains a nil policy")
+			}
+			if err := checkSignaturePolicy(sub, identities); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("Unknown signature policy type")
+	}
+	return nil
+}
+
+// certificateDER returns the DER bytes of a certificate that may be PEM encoded
+func certificateDER(cert []byte) []byte {
+	if block, _ := pem.Decode(cert); block != nil {
+		return block.Bytes
+	}
+	return cert
+}
@@ -0,0 +1,282 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	msp "github.com/hyperledger/fabric/msp"
+	"github.com/hyperledger/fabric/protos/common"
+	mb "github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func TestEndorsementPolicyMembers(t *testing.T) {
+	// OutOf(2, Org1.member, Org2.member, Org3.member)
+	envelope := &common.SignaturePolicyEnvelope{
+		Policy: nOutOf(2, signedBy(0), signedBy(1), signedBy(2)),
+		Identities: []*common.MSPPrincipal{
+			rolePrincipal(t, "Org1MSP", common.MSPRole_Member),
+			rolePrincipal(t, "Org2MSP", common.MSPRole_Member),
+			rolePrincipal(t, "Org3MSP", common.MSPRole_Member),
+		},
+	}
+	policy, err := NewEndorsementPolicy(envelope, nil)
+	if err != nil {
+		t.Fatalf("NewEndorsementPolicy return error[%s]", err)
+	}
+
+	org1 := endorsement(t, "Org1MSP", []byte("cert1"))
+	org1bis := endorsement(t, "Org1MSP", []byte("cert1bis"))
+	org3 := endorsement(t, "Org3MSP", []byte("cert3"))
+	if err := policy.Evaluate([]*pb.Endorsement{org1, org3}); err != nil {
+		t.Fatalf("Evaluate return error[%s]", err)
+	}
+	if err := policy.Evaluate([]*pb.Endorsement{org1}); err == nil {
+		t.Fatalf("Evaluate didn't return error for a single endorsement")
+	}
+	if err := policy.Evaluate([]*pb.Endorsement{org1, org1bis}); err == nil {
+		t.Fatalf("Evaluate didn't return error for endorsements of the same organization")
+	}
+
+	// AND(Org1.member, Org1.member) needs two distinct endorsements
+	envelope = &common.SignaturePolicyEnvelope{
+		Policy:     nOutOf(2, signedBy(0), signedBy(0)),
+		Identities: []*common.MSPPrincipal{rolePrincipal(t, "Org1MSP", common.MSPRole_Member)},
+	}
+	policy, err = NewEndorsementPolicy(envelope, nil)
+	if err != nil {
+		t.Fatalf("NewEndorsementPolicy return error[%s]", err)
+	}
+	if err := policy.Evaluate([]*pb.Endorsement{org1}); err == nil {
+		t.Fatalf("Evaluate didn't return error when one endorsement is counted twice")
+	}
+	if err := policy.Evaluate([]*pb.Endorsement{org1, org1bis}); err != nil {
+		t.Fatalf("Evaluate return error[%s]", err)
+	}
+}
+
+func TestEndorsementPolicyPrincipals(t *testing.T) {
+	adminCert := generateTestCertificate(t, "admin")
+	peerCert := generateTestCertificate(t, "peer")
+	fabricMSPConfig, err := proto.Marshal(&mb.FabricMSPConfig{Name: "Org1MSP", Admins: [][]byte{adminCert}})
+	if err != nil {
+		t.Fatalf("Marshal return error[%s]", err)
+	}
+	msps := []*mb.MSPConfig{{Type: 0, Config: fabricMSPConfig}}
+
+	ou, err := proto.Marshal(&common.OrganizationUnit{MSPIdentifier: "Org1MSP", OrganizationUnitIdentifier: "peer"})
+	if err != nil {
+		t.Fatalf("Marshal return error[%s]", err)
+	}
+	identity, err := proto.Marshal(&msp.SerializedIdentity{Mspid: "Org1MSP", IdBytes: peerCert})
+	if err != nil {
+		t.Fatalf("Marshal return error[%s]", err)
+	}
+	principals := []*common.MSPPrincipal{
+		rolePrincipal(t, "Org1MSP", common.MSPRole_Admin),
+		{PrincipalClassification: common.MSPPrincipal_ByOrganizationUnit, Principal: ou},
+		{PrincipalClassification: common.MSPPrincipal_ByIdentity, Principal: identity},
+	}
+
+	admin := endorsement(t, "Org1MSP", adminCert)
+	peer := endorsement(t, "Org1MSP", peerCert)
+	other := endorsement(t, "Org2MSP", peerCert)
+	tests := []struct {
+		principal    int32
+		endorsements []*pb.Endorsement
+		satisfied    bool
+	}{
+		{0, []*pb.Endorsement{admin}, true},
+		{0, []*pb.Endorsement{peer}, false},
+		{1, []*pb.Endorsement{peer}, true},
+		{1, []*pb.Endorsement{admin}, false},
+		{1, []*pb.Endorsement{other}, false},
+		{2, []*pb.Endorsement{peer}, true},
+		{2, []*pb.Endorsement{other}, false},
+	}
+	for i, test := range tests {
+		policy, err := NewEndorsementPolicy(&common.SignaturePolicyEnvelope{Policy: signedBy(test.principal), Identities: principals}, msps)
+		if err != nil {
+			t.Fatalf("NewEndorsementPolicy return error[%s]", err)
+		}
+		err = policy.Evaluate(test.endorsements)
+		if test.satisfied && err != nil {
+			t.Fatalf("Test %d: Evaluate return error[%s]", i, err)
+		}
+		if !test.satisfied && err == nil {
+			t.Fatalf("Test %d: Evaluate didn't return error", i)
+		}
+	}
+}
+
+func TestEndorsementPolicyAssignment(t *testing.T) {
+	adminCert := generateTestCertificate(t, "admin")
+	fabricMSPConfig, err := proto.Marshal(&mb.FabricMSPConfig{Name: "Org1MSP", Admins: [][]byte{adminCert}})
+	if err != nil {
+		t.Fatalf("Marshal return error[%s]", err)
+	}
+	msps := []*mb.MSPConfig{{Type: 0, Config: fabricMSPConfig}}
+
+	// AND('Org1.member', 'Org1.admin'): the admin satisfies both principals, but only once
+	envelope := &common.SignaturePolicyEnvelope{
+		Policy: nOutOf(2, signedBy(0), signedBy(1)),
+		Identities: []*common.MSPPrincipal{
+			rolePrincipal(t, "Org1MSP", common.MSPRole_Member),
+			rolePrincipal(t, "Org1MSP", common.MSPRole_Admin),
+		},
+	}
+	policy, err := NewEndorsementPolicy(envelope, msps)
+	if err != nil {
+		t.Fatalf("NewEndorsementPolicy return error[%s]", err)
+	}
+	admin := endorsement(t, "Org1MSP", adminCert)
+	member := endorsement(t, "Org1MSP", generateTestCertificate(t, "member"))
+	if err := policy.Evaluate([]*pb.Endorsement{admin, member}); err != nil {
+		t.Fatalf("Evaluate return error[%s]", err)
+	}
+	if err := policy.Evaluate([]*pb.Endorsement{member, admin}); err != nil {
+		t.Fatalf("Evaluate return error[%s]", err)
+	}
+	if err := policy.Evaluate([]*pb.Endorsement{admin}); err == nil {
+		t.Fatalf("Evaluate didn't return error when the admin is counted twice")
+	}
+
+	// OR(AND('Org1.member', 'Org1.admin'), 'Org2.member') with the sub-policies sharing identities
+	envelope = &common.SignaturePolicyEnvelope{
+		Policy: nOutOf(2, nOutOf(1, signedBy(0), signedBy(2)), signedBy(1)),
+		Identities: []*common.MSPPrincipal{
+			rolePrincipal(t, "Org1MSP", common.MSPRole_Member),
+			rolePrincipal(t, "Org1MSP", common.MSPRole_Admin),
+			rolePrincipal(t, "Org2MSP", common.MSPRole_Member),
+		},
+	}
+	policy, err = NewEndorsementPolicy(envelope, msps)
+	if err != nil {
+		t.Fatalf("NewEndorsementPolicy return error[%s]", err)
+	}
+	if err := policy.Evaluate([]*pb.Endorsement{admin, member}); err != nil {
+		t.Fatalf("Evaluate return error[%s]", err)
+	}
+	if err := policy.Evaluate([]*pb.Endorsement{admin, endorsement(t, "Org2MSP", []byte("cert2"))}); err != nil {
+		t.Fatalf("Evaluate return error[%s]", err)
+	}
+	if err := policy.Evaluate([]*pb.Endorsement{member, endorsement(t, "Org2MSP", []byte("cert2"))}); err == nil {
+		t.Fatalf("Evaluate didn't return error without the admin")
+	}
+}
+
+func TestNewEndorsementPolicyInvalid(t *testing.T) {
+	_, err := NewEndorsementPolicy(nil, nil)
+	if err == nil || err.Error() != "policy is nil" {
+		t.Fatalf("NewEndorsementPolicy didn't return the expected error for a nil policy")
+	}
+	_, err = NewEndorsementPolicy(&common.SignaturePolicyEnvelope{Policy: signedBy(1),
+		Identities: []*common.MSPPrincipal{rolePrincipal(t, "Org1MSP", common.MSPRole_Member)}}, nil)
+	if err == nil || err.Error() != "SignedBy references identity 1, but the policy has 1 identities" {
+		t.Fatalf("NewEndorsementPolicy didn't return the expected error for an out of range identity")
+	}
+}
+
+func TestCreateTransactionWithPolicy(t *testing.T) {
+	client := setupTestClient(t)
+	chain, err := NewChain("testChain", client)
+	if err != nil {
+		t.Fatalf("NewChain return error[%s]", err)
+	}
+	_, proposal, err := chain.CreateTransactionProposal("testCC", "testChain", []string{"invoke"}, true, "1234", nil)
+	if err != nil {
+		t.Fatalf("CreateTransactionProposal return error[%s]", err)
+	}
+	envelope := &common.SignaturePolicyEnvelope{
+		Policy: nOutOf(2, signedBy(0), signedBy(1)),
+		Identities: []*common.MSPPrincipal{
+			rolePrincipal(t, "Org1MSP", common.MSPRole_Member),
+			rolePrincipal(t, "Org2MSP", common.MSPRole_Member),
+		},
+	}
+	response := func(mspID string) *pb.ProposalResponse {
+		return &pb.ProposalResponse{Response: &pb.Response{Status: 200}, Payload: []byte("payload"),
+			Endorsement: endorsement(t, mspID, []byte("cert"))}
+	}
+
+	_, err = chain.CreateTransaction(proposal, []*pb.ProposalResponse{response("Org1MSP")}, envelope)
+	if err == nil || err.Error() != "Endorsement policy is not satisfied by the 1 endorsement(s)" {
+		t.Fatalf("CreateTransaction didn't refuse a transaction not satisfying the policy, got %v", err)
+	}
+	_, err = chain.CreateTransaction(proposal, []*pb.ProposalResponse{response("Org1MSP"), response("Org2MSP")}, envelope)
+	if err != nil {
+		t.Fatalf("CreateTransaction return error[%s]", err)
+	}
+	_, err = chain.CreateTransaction(proposal, []*pb.ProposalResponse{response("Org1MSP")})
+	if err != nil {
+		t.Fatalf("CreateTransaction return error[%s]", err)
+	}
+}
+
+func signedBy(index int32) *common.SignaturePolicy {
+	return &common.SignaturePolicy{Type: &common.SignaturePolicy_SignedBy{SignedBy: index}}
+}
+
+func nOutOf(n int32, policies ...*common.SignaturePolicy) *common.SignaturePolicy {
+	return &common.SignaturePolicy{Type: &common.SignaturePolicy_From{From: &common.SignaturePolicy_NOutOf{N: n, Policies: policies}}}
+}
+
+func rolePrincipal(t *testing.T, mspID string, role common.MSPRole_MSPRoleType) *common.MSPPrincipal {
+	principal, err := proto.Marshal(&common.MSPRole{MSPIdentifier: mspID, Role: role})
+	if err != nil {
+		t.Fatalf("Marshal return error[%s]", err)
+	}
+	return &common.MSPPrincipal{PrincipalClassification: common.MSPPrincipal_ByMSPRole, Principal: principal}
+}
+
+func endorsement(t *testing.T, mspID string, cert []byte) *pb.Endorsement {
+	endorser, err := proto.Marshal(&msp.SerializedIdentity{Mspid: mspID, IdBytes: cert})
+	if err != nil {
+		t.Fatalf("Marshal return error[%s]", err)
+	}
+	return &pb.Endorsement{Endorser: endorser, Signature: []byte("signature")}
+}
+
+func generateTestCertificate(t *testing.T, ou string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey return error[%s]", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: ou, OrganizationalUnit: []string{ou}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate return error[%s]", err)
+	}
+	return cert
+}
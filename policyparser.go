@@ -0,0 +1,287 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/protos/common"
+)
+
+// roles of the MSP principals in the policy language
+const (
+	memberRole = "member"
+	adminRole  = "admin"
+)
+
+// policyParser is a recursive descent parser of the policy language
+type policyParser struct {
+	input string
+	pos   int
+	// identities of the policy and their index, keyed by "<MSP ID>.<role>"
+	identities []*common.MSPPrincipal
+	indexes    map[string]int32
+}
+
+// ParsePolicy ...
+/**
+ * Parses an endorsement policy expression into a SignaturePolicyEnvelope.
+ * The language is made of principals 'MSPID.member' or 'MSPID.admin' combined with
+ * AND(policy, ...), OR(policy, ...) and OutOf(n, policy, ...). For example
+ * AND('Org1MSP.member', OR('Org2MSP.admin', 'Org3MSP.member')).
+ * A principal used several times appears once in the identities of the envelope.
+ * @param {string} policy The policy expression.
+ * @returns {SignaturePolicyEnvelope} The policy.
+ */
+func ParsePolicy(policy string) (*common.SignaturePolicyEnvelope, error) {
+	p := &policyParser{input: policy, indexes: make(map[string]int32)}
+	signaturePolicy, err := p.parsePolicy()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if p.pos != len(p.input) {
+		return nil, p.errorf("unexpected %q", p.input[p.pos:])
+	}
+	return &common.SignaturePolicyEnvelope{Version: 0, Policy: signaturePolicy, Identities: p.identities}, nil
+}
+
+// PolicyToString ...
+/**
+ * Prints a SignaturePolicyEnvelope in the language accepted by ParsePolicy.
+ * Only policies over MSP role principals can be printed.
+ * @param {SignaturePolicyEnvelope} envelope The policy.
+ * @returns {string} The policy expression.
+ */
+func PolicyToString(envelope *common.SignaturePolicyEnvelope) (string, error) {
+	if envelope == nil || envelope.Policy == nil {
+		return "", fmt.Errorf("policy is nil")
+	}
+	if err := checkSignaturePolicy(envelope.Policy, len(envelope.Identities)); err != nil {
+		return "", err
+	}
+	principals := make([]string, len(envelope.Identities))
+	for i, identity := range envelope.Identities {
+		if identity.PrincipalClassification != common.MSPPrincipal_ByMSPRole {
+			return "", fmt.Errorf("identity %d is a %s principal, which can't be expressed in the policy language", i, identity.PrincipalClassification)
+		}
+		role := &common.MSPRole{}
+		if err := proto.Unmarshal(identity.Principal, role); err != nil {
+			return "", fmt.Errorf("Could not unmarshal MSPRole of identity %d: %s", i, err)
+		}
+		switch role.Role {
+		case common.MSPRole_Member:
+			principals[i] = fmt.Sprintf("'%s.%s'", role.MSPIdentifier, memberRole)
+		case common.MSPRole_Admin:
+			principals[i] = fmt.Sprintf("'%s.%s'", role.MSPIdentifier, adminRole)
+		default:
+			return "", fmt.Errorf("identity %d has unknown role %s", i, role.Role)
+		}
+	}
+	return policyString(envelope.Policy, principals)
+}
+
+// policyString prints a policy node. NOutOf nodes that ParsePolicy can't produce, without
+// sub-policies or with N outside 1..len(policies), are rejected so that the output parses back.
+func policyString(policy *common.SignaturePolicy, principals []string) (string, error) {
+	switch t := policy.Type.(type) {
+	case *common.SignaturePolicy_SignedBy:
+		return principals[t.SignedBy], nil
+	case *common.SignaturePolicy_From:
+		if t.From.N < 1 || int(t.From.N) > len(t.From.Policies) {
+			return "", fmt.Errorf("NOutOf policy requiring %d of %d policies can't be expressed in the policy language", t.From.N, len(t.From.Policies))
+		}
+		args := make([]string, len(t.From.Policies))
+		for i, sub := range t.From.Policies {
+			arg, err := policyString(sub, principals)
+			if err != nil {
+				return "", err
+			}
+			args[i] = arg
+		}
+		switch {
+		case int(t.From.N) == len(args):
+			return "AND(" + strings.Join(args, ", ") + ")", nil
+		case t.From.N == 1:
+			return "OR(" + strings.Join(args, ", ") + ")", nil
+		default:
+			return "OutOf(" + strconv.Itoa(int(t.From.N)) + ", " + strings.Join(args, ", ") + ")", nil
+		}
+	}
+	return "", fmt.Errorf("Unknown signature policy type")
+}
+
+// parsePolicy parses a principal or an operator
+func (p *policyParser) parsePolicy() (*common.SignaturePolicy, error) {
+	p.skipSpaces()
+	if p.pos >= len(p.input) {
+		return nil, p.errorf("unexpected end of policy")
+	}
+	if c := p.input[p.pos]; c == '\'' || c == '"' {
+		return p.parsePrincipal()
+	}
+
+	start := p.pos
+	for p.pos < len(p.input) && unicode.IsLetter(rune(p.input[p.pos])) {
+		p.pos++
+	}
+	operator := p.input[start:p.pos]
+	if operator == "" {
+		return nil, p.errorf("expected a principal or an operator")
+	}
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+
+	var n, numberPos int
+	switch strings.ToLower(operator) {
+	case "and", "or":
+	case "outof":
+		p.skipSpaces()
+		numberPos = p.pos
+		var err error
+		if n, err = p.parseNumber(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(','); err != nil {
+			return nil, err
+		}
+	default:
+		p.pos = start
+		return nil, p.errorf("unknown operator %s in policy", operator)
+	}
+
+	var policies []*common.SignaturePolicy
+	for {
+		policy, err := p.parsePolicy()
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+		p.skipSpaces()
+		if p.pos < len(p.input) && p.input[p.pos] == ',' {
+			p.pos++
+			continue
+		}
+		if err := p.expect(')'); err != nil {
+			return nil, err
+		}
+		break
+	}
+
+	switch strings.ToLower(operator) {
+	case "and":
+		n = len(policies)
+	case "or":
+		n = 1
+	default:
+		if n < 1 || n > len(policies) {
+			p.pos = numberPos
+			return nil, p.errorf("OutOf requires between 1 and %d policies to be satisfied, got %d", len(policies), n)
+		}
+	}
+	return &common.SignaturePolicy{Type: &common.SignaturePolicy_From{
+		From: &common.SignaturePolicy_NOutOf{N: int32(n), Policies: policies}}}, nil
+}
+
+// parsePrincipal parses a quoted 'MSPID.role' principal and returns the SignedBy policy of its identity
+func (p *policyParser) parsePrincipal() (*common.SignaturePolicy, error) {
+	start := p.pos
+	quote := p.input[p.pos]
+	end := strings.IndexByte(p.input[p.pos+1:], quote)
+	if end < 0 {
+		return nil, p.errorf("unterminated principal")
+	}
+	principal := p.input[p.pos+1 : p.pos+1+end]
+
+	// the principal errors are reported at its opening quote
+	dot := strings.LastIndex(principal, ".")
+	if dot <= 0 {
+		return nil, p.errorf("principal '%s' must be of the form 'MSPID.role'", principal)
+	}
+	mspID := principal[:dot]
+	var role common.MSPRole_MSPRoleType
+	switch strings.ToLower(principal[dot+1:]) {
+	case memberRole:
+		role = common.MSPRole_Member
+	case adminRole:
+		role = common.MSPRole_Admin
+	default:
+		return nil, p.errorf("principal '%s' has unknown role %s", principal, principal[dot+1:])
+	}
+	p.pos = start + end + 2
+
+	key := mspID + "." + strings.ToLower(principal[dot+1:])
+	index, ok := p.indexes[key]
+	if !ok {
+		roleBytes, err := proto.Marshal(&common.MSPRole{MSPIdentifier: mspID, Role: role})
+		if err != nil {
+			return nil, fmt.Errorf("Could not marshal MSPRole: %s", err)
+		}
+		index = int32(len(p.identities))
+		p.identities = append(p.identities, &common.MSPPrincipal{
+			PrincipalClassification: common.MSPPrincipal_ByMSPRole, Principal: roleBytes})
+		p.indexes[key] = index
+	}
+	return &common.SignaturePolicy{Type: &common.SignaturePolicy_SignedBy{SignedBy: index}}, nil
+}
+
+// parseNumber parses the number of policies of an OutOf operator
+func (p *policyParser) parseNumber() (int, error) {
+	p.skipSpaces()
+	start := p.pos
+	for p.pos < len(p.input) && p.input[p.pos] >= '0' && p.input[p.pos] <= '9' {
+		p.pos++
+	}
+	if start == p.pos {
+		return 0, p.errorf("expected a number")
+	}
+	number := p.input[start:p.pos]
+	n, err := strconv.Atoi(number)
+	if err != nil {
+		p.pos = start
+		return 0, p.errorf("invalid number %s: %s", number, err)
+	}
+	return n, nil
+}
+
+// expect consumes the expected character
+func (p *policyParser) expect(c byte) error {
+	p.skipSpaces()
+	if p.pos >= len(p.input) || p.input[p.pos] != c {
+		return p.errorf("expected '%c'", c)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *policyParser) skipSpaces() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *policyParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("Could not parse policy at position %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,124 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fabricsdk
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric/protos/common"
+)
+
+func TestParsePolicy(t *testing.T) {
+	envelope, err := ParsePolicy("AND('Org1MSP.member', OR('Org2MSP.admin', \"Org1MSP.member\"))")
+	if err != nil {
+		t.Fatalf("ParsePolicy return error[%s]", err)
+	}
+	expected := &common.SignaturePolicyEnvelope{
+		Policy: nOutOf(2, signedBy(0), nOutOf(1, signedBy(1), signedBy(0))),
+		Identities: []*common.MSPPrincipal{
+			rolePrincipal(t, "Org1MSP", common.MSPRole_Member),
+			rolePrincipal(t, "Org2MSP", common.MSPRole_Admin),
+		},
+	}
+	if !reflect.DeepEqual(envelope, expected) {
+		t.Fatalf("ParsePolicy return %v, expected %v", envelope, expected)
+	}
+
+	envelope, err = ParsePolicy(" OutOf( 2, 'Org1.member','Org2.member', 'Org3.member' ) ")
+	if err != nil {
+		t.Fatalf("ParsePolicy return error[%s]", err)
+	}
+	if len(envelope.Identities) != 3 || envelope.Policy.GetFrom().N != 2 || len(envelope.Policy.GetFrom().Policies) != 3 {
+		t.Fatalf("ParsePolicy return unexpected policy %v", envelope)
+	}
+
+	envelope, err = ParsePolicy("'my.org.admin'")
+	if err != nil {
+		t.Fatalf("ParsePolicy return error[%s]", err)
+	}
+	if !reflect.DeepEqual(envelope.Identities[0], rolePrincipal(t, "my.org", common.MSPRole_Admin)) {
+		t.Fatalf("ParsePolicy didn't split the MSP ID at the last dot")
+	}
+}
+
+func TestParsePolicyErrors(t *testing.T) {
+	tests := []struct {
+		policy string
+		err    string
+	}{
+		{"", "Could not parse policy at position 0: unexpected end of policy"},
+		{"AND('Org1.member'", "Could not parse policy at position 17: expected ')'"},
+		{"AND('Org1.member') x", "Could not parse policy at position 19: unexpected \"x\""},
+		{"NOT('Org1.member')", "Could not parse policy at position 0: unknown operator NOT in policy"},
+		{"AND('Org1.member', Not('Org2.member'))", "Could not parse policy at position 19: unknown operator Not in policy"},
+		{"OutOf(3, 'Org1.member', 'Org2.member')", "Could not parse policy at position 6: OutOf requires between 1 and 2 policies to be satisfied, got 3"},
+		{"OR('Org1.member', OutOf( 0, 'Org2.member'))", "Could not parse policy at position 25: OutOf requires between 1 and 1 policies to be satisfied, got 0"},
+		{"OutOf('Org1.member')", "Could not parse policy at position 6: expected a number"},
+		{"'Org1.peer'", "Could not parse policy at position 0: principal 'Org1.peer' has unknown role peer"},
+		{"AND('Org1.member', 'Org2.peer')", "Could not parse policy at position 19: principal 'Org2.peer' has unknown role peer"},
+		{"'Org1'", "Could not parse policy at position 0: principal 'Org1' must be of the form 'MSPID.role'"},
+		{"OR('Org1.member',\"Org2\")", "Could not parse policy at position 17: principal 'Org2' must be of the form 'MSPID.role'"},
+		{"'Org1.member", "Could not parse policy at position 0: unterminated principal"},
+		{"OutOf(99999999999999999999, 'Org1.member')", "Could not parse policy at position 6: invalid number 99999999999999999999: strconv.Atoi: parsing \"99999999999999999999\": value out of range"},
+	}
+	for _, test := range tests {
+		_, err := ParsePolicy(test.policy)
+		if err == nil || err.Error() != test.err {
+			t.Fatalf("ParsePolicy(%q) return error %v, expected %s", test.policy, err, test.err)
+		}
+	}
+}
+
+func TestPolicyToString(t *testing.T) {
+	policies := []string{
+		"AND('Org1MSP.member', OR('Org2MSP.admin', 'Org3MSP.member'))",
+		"OutOf(2, 'Org1MSP.member', 'Org2MSP.member', AND('Org1MSP.member', 'Org3MSP.admin'))",
+		"'Org1MSP.admin'",
+	}
+	for _, policy := range policies {
+		envelope, err := ParsePolicy(policy)
+		if err != nil {
+			t.Fatalf("ParsePolicy return error[%s]", err)
+		}
+		printed, err := PolicyToString(envelope)
+		if err != nil {
+			t.Fatalf("PolicyToString return error[%s]", err)
+		}
+		if printed != policy {
+			t.Fatalf("PolicyToString return %s, expected %s", printed, policy)
+		}
+	}
+
+	_, err := PolicyToString(&common.SignaturePolicyEnvelope{Policy: signedBy(0),
+		Identities: []*common.MSPPrincipal{{PrincipalClassification: common.MSPPrincipal_ByIdentity}}})
+	if err == nil || err.Error() != "identity 0 is a ByIdentity principal, which can't be expressed in the policy language" {
+		t.Fatalf("PolicyToString didn't return the expected error, got %v", err)
+	}
+
+	// NOutOf policies ParsePolicy rejects are not printed
+	member := rolePrincipal(t, "Org1MSP", common.MSPRole_Member)
+	for _, policy := range []*common.SignaturePolicy{nOutOf(0), nOutOf(0, signedBy(0)), nOutOf(2, signedBy(0))} {
+		printed, err := PolicyToString(&common.SignaturePolicyEnvelope{Policy: policy, Identities: []*common.MSPPrincipal{member}})
+		if err == nil {
+			t.Fatalf("PolicyToString didn't return error for %v, printed %s", policy, printed)
+		}
+	}
+}
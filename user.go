@@ -20,9 +20,22 @@ limitations under the License.
 package fabricsdk
 
 import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/hyperledger/fabric-sdk-go/config"
+	mspservices "github.com/hyperledger/fabric-sdk-go/msp"
 	"github.com/hyperledger/fabric/bccsp"
 )
 
+const (
+	// defaultTcertRefillThreshold is the pool size below which a new batch of TCerts is fetched
+	defaultTcertRefillThreshold = 10
+	// maxIssuedTcerts is the number of TCerts taken from the pool whose keys are kept to sign transactions
+	maxIssuedTcerts = 1000
+)
+
 // User ...
 /**
  * The User struct represents users that have been enrolled and represented by
@@ -46,12 +59,31 @@ type User struct {
 	roles                 []string
 	PrivateKey            bccsp.Key // ****This key is temporary We use it to sign transaction until we have tcerts
 	enrollmentCertificate []byte
+	mspID                 string
+	caCertificates        [][]byte
+	adminCertificates     [][]byte
+	tlsCACertificates     [][]byte
+	mspServices           *mspservices.Services
+	tcertMtx              sync.Mutex
+	tcerts                []*mspservices.TCert
+	tcertRefillThreshold  int
+	tcertRefill           *tcertRefill
+	issuedTcerts          map[string]bccsp.Key
+	issuedTcertsOrder     []string
+}
+
+// tcertRefill is a TCert batch being fetched for the pool of a user,
+// done is closed when it was added to the pool or err was set
+type tcertRefill struct {
+	done chan struct{}
+	err  error
 }
 
 // UserJSON ...
 type UserJSON struct {
 	PrivateKeySKI         []byte
 	EnrollmentCertificate []byte
+	MspID                 string
 }
 
 // NewUser ...
@@ -61,7 +93,7 @@ type UserJSON struct {
  * @param {string} name - The user name
  */
 func NewUser(name string) *User {
-	return &User{name: name}
+	return &User{name: name, tcertRefillThreshold: defaultTcertRefillThreshold}
 }
 
 // GetName ...
@@ -107,6 +139,75 @@ func (u *User) SetEnrollmentCertificate(cert []byte) {
 	u.enrollmentCertificate = cert
 }
 
+// GetMspID ...
+/**
+ * Get the ID of the MSP the user belongs to.
+ * @returns {string} The MSP ID of the user, the configured MSP ID when none was set.
+ */
+func (u *User) GetMspID() string {
+	if u.mspID == "" {
+		return config.GetMspID()
+	}
+	return u.mspID
+}
+
+// SetMspID ...
+/**
+ * Set the ID of the MSP the user belongs to.
+ * @param {string} mspID The MSP ID, empty for the configured MSP.
+ */
+func (u *User) SetMspID(mspID string) {
+	u.mspID = mspID
+}
+
+// GetCACertificates ...
+/**
+ * Get the certificates of the CAs of the user's MSP.
+ */
+func (u *User) GetCACertificates() [][]byte {
+	return u.caCertificates
+}
+
+// SetCACertificates ...
+/**
+ * Set the PEM encoded certificates of the CAs of the user's MSP.
+ */
+func (u *User) SetCACertificates(certs [][]byte) {
+	u.caCertificates = certs
+}
+
+// GetAdminCertificates ...
+/**
+ * Get the certificates of the administrators of the user's MSP.
+ */
+func (u *User) GetAdminCertificates() [][]byte {
+	return u.adminCertificates
+}
+
+// SetAdminCertificates ...
+/**
+ * Set the PEM encoded certificates of the administrators of the user's MSP.
+ */
+func (u *User) SetAdminCertificates(certs [][]byte) {
+	u.adminCertificates = certs
+}
+
+// GetTLSCACertificates ...
+/**
+ * Get the certificates of the TLS CAs of the user's MSP.
+ */
+func (u *User) GetTLSCACertificates() [][]byte {
+	return u.tlsCACertificates
+}
+
+// SetTLSCACertificates ...
+/**
+ * Set the PEM encoded certificates of the TLS CAs of the user's MSP.
+ */
+func (u *User) SetTLSCACertificates(certs [][]byte) {
+	u.tlsCACertificates = certs
+}
+
 // SetPrivateKey ...
 /**
  * deprecated.
@@ -123,14 +224,128 @@ func (u *User) GetPrivateKey() bccsp.Key {
 	return u.PrivateKey
 }
 
+// SetMSPServices ...
+/**
+ * Set the msp services issuing the user's TCerts.
+ * @param {mspservices.Services} msps The msp services, their crypto suite must hold the user's private key
+ */
+func (u *User) SetMSPServices(msps *mspservices.Services) {
+	u.tcertMtx.Lock()
+	defer u.tcertMtx.Unlock()
+	u.mspServices = msps
+}
+
+// GetMSPServices ...
+/**
+ * @returns {mspservices.Services} The msp services issuing the user's TCerts, nil if none was set.
+ */
+func (u *User) GetMSPServices() *mspservices.Services {
+	u.tcertMtx.Lock()
+	defer u.tcertMtx.Unlock()
+	return u.mspServices
+}
+
+// SetTcertRefillThreshold ...
+/**
+ * Set the number of pooled TCerts below which a new batch is fetched, 10 by default.
+ * @param {int} threshold The refill threshold
+ */
+func (u *User) SetTcertRefillThreshold(threshold int) {
+	u.tcertMtx.Lock()
+	defer u.tcertMtx.Unlock()
+	u.tcertRefillThreshold = threshold
+}
+
 // GenerateTcerts ...
 /**
  * Gets a batch of TCerts to use for transaction. there is a 1-to-1 relationship between
- * TCert and Transaction. The TCert can be generated locally by the SDK using the user’s crypto materials.
+ * TCert and Transaction. The TCerts are issued by the user's msp services and their private
+ * keys are derived locally from the user's private key.
  * @param {int} count how many in the batch to obtain
  * @param {[]string} attributes  list of attributes to include in the TCert
- * @return {[]tcert} An array of TCerts
+ * @return {[]*mspservices.TCert} An array of TCerts
+ */
+func (u *User) GenerateTcerts(count int, attributes []string) ([]*mspservices.TCert, error) {
+	msps := u.GetMSPServices()
+	if msps == nil {
+		return nil, fmt.Errorf("User %s has no msp services", u.name)
+	}
+	return msps.GetTCerts(u, count, attributes)
+}
+
+/**
+ * private internal method taking a TCert without attributes from the user's pool, the pool
+ * is refilled with a batch of batchSize TCerts when it falls below the refill threshold.
+ * The lock is released while the batch is fetched, so that the pooled TCerts can still be
+ * taken; a single batch is fetched at a time, which the callers finding the pool empty wait for.
  */
-func (u *User) GenerateTcerts(count int, attributes []string) {
+func (u *User) takeTcert(batchSize int) (*mspservices.TCert, error) {
+	u.tcertMtx.Lock()
+	defer u.tcertMtx.Unlock()
+	for len(u.tcerts) == 0 || (len(u.tcerts) < u.tcertRefillThreshold && u.tcertRefill == nil) {
+		if refill := u.tcertRefill; refill != nil {
+			u.tcertMtx.Unlock()
+			<-refill.done
+			u.tcertMtx.Lock()
+			if len(u.tcerts) == 0 && refill.err != nil {
+				return nil, refill.err
+			}
+			continue
+		}
+		if u.mspServices == nil {
+			return nil, fmt.Errorf("User %s has no msp services", u.name)
+		}
+		refill := &tcertRefill{done: make(chan struct{})}
+		u.tcertRefill = refill
+		msps := u.mspServices
+		u.tcertMtx.Unlock()
+		tcerts, err := msps.GetTCerts(u, batchSize, nil)
+		u.tcertMtx.Lock()
+		u.tcerts = append(u.tcerts, tcerts...)
+		if err == nil && len(tcerts) == 0 {
+			err = fmt.Errorf("No TCert was issued for user %s", u.name)
+		}
+		refill.err = err
+		u.tcertRefill = nil
+		close(refill.done)
+		if err != nil {
+			if len(u.tcerts) == 0 {
+				return nil, err
+			}
+			logger.Warningf("Failed to refill the TCert pool of user %s: %v", u.name, err)
+		}
+		// a batch smaller than the threshold is not refilled before the next TCert is taken
+		break
+	}
+	tcert := u.tcerts[0]
+	u.tcerts = u.tcerts[1:]
 
+	// keep the key to sign the transaction of the proposal the TCert is used for
+	if u.issuedTcerts == nil {
+		u.issuedTcerts = make(map[string]bccsp.Key)
+	}
+	if len(u.issuedTcertsOrder) == maxIssuedTcerts {
+		delete(u.issuedTcerts, u.issuedTcertsOrder[0])
+		u.issuedTcertsOrder = u.issuedTcertsOrder[1:]
+	}
+	u.issuedTcerts[string(tcert.Certificate)] = tcert.PrivateKey
+	u.issuedTcertsOrder = append(u.issuedTcertsOrder, string(tcert.Certificate))
+	return tcert, nil
+}
+
+/**
+ * private internal method returning the private key of the user's enrollment certificate or
+ * of one of the TCerts taken from its pool
+ */
+func (u *User) getSigningKey(cert []byte) (bccsp.Key, error) {
+	if bytes.Equal(cert, u.enrollmentCertificate) {
+		return u.PrivateKey, nil
+	}
+	u.tcertMtx.Lock()
+	defer u.tcertMtx.Unlock()
+	key, ok := u.issuedTcerts[string(cert)]
+	if !ok {
+		return nil, fmt.Errorf("The certificate is neither the enrollment certificate nor a TCert of user %s", u.name)
+	}
+	return key, nil
 }
@@ -20,7 +20,9 @@ limitations under the License.
 package fabricsdk
 
 import (
+	"bytes"
 	"testing"
+	"time"
 )
 
 func TestUserMethods(t *testing.T) {
@@ -41,3 +43,110 @@ func TestUserMethods(t *testing.T) {
 	}
 
 }
+
+func TestUserTcertPool(t *testing.T) {
+	client := setupTestClient(t)
+	user, err := client.GetUserContext("")
+	if err != nil {
+		t.Fatalf("GetUserContext return error[%s]", err)
+	}
+	if _, err := user.GenerateTcerts(3, nil); err == nil {
+		t.Fatalf("GenerateTcerts didn't return error")
+	}
+	ca := startMockCAServer(t)
+	defer ca.server.Close()
+	ca.enroll(t, client.GetCryptoSuite(), user)
+	user.SetMSPServices(ca.newMSPServices(t, client.GetCryptoSuite()))
+	user.SetTcertRefillThreshold(2)
+
+	tcerts, err := user.GenerateTcerts(3, nil)
+	if err != nil {
+		t.Fatalf("GenerateTcerts return error[%s]", err)
+	}
+	if len(tcerts) != 3 {
+		t.Fatalf("GenerateTcerts returned %d TCerts, expected 3", len(tcerts))
+	}
+
+	// batches of 3 are fetched when less than 2 TCerts are pooled
+	expectedBatches := []int{2, 2, 3, 3, 3, 4}
+	for i, expected := range expectedBatches {
+		tcert, err := user.takeTcert(3)
+		if err != nil {
+			t.Fatalf("takeTcert return error[%s]", err)
+		}
+		if batches := ca.getBatches(); batches != expected {
+			t.Fatalf("%d batches were fetched after taking %d TCerts, expected %d", batches, i+1, expected)
+		}
+		key, err := user.getSigningKey(tcert.Certificate)
+		if err != nil || key != tcert.PrivateKey {
+			t.Fatalf("getSigningKey didn't return the key of the TCert: %v", err)
+		}
+	}
+	if key, err := user.getSigningKey(user.GetEnrollmentCertificate()); err != nil || key != user.GetPrivateKey() {
+		t.Fatalf("getSigningKey didn't return the key of the enrollment certificate: %v", err)
+	}
+	if _, err := user.getSigningKey(tcerts[0].Certificate); err == nil || bytes.Equal(tcerts[0].Certificate, user.GetEnrollmentCertificate()) {
+		t.Fatalf("getSigningKey didn't return error for a TCert not taken from the pool")
+	}
+}
+
+func TestUserTcertPoolRefill(t *testing.T) {
+	client := setupTestClient(t)
+	user, err := client.GetUserContext("")
+	if err != nil {
+		t.Fatalf("GetUserContext return error[%s]", err)
+	}
+	ca := startMockCAServer(t)
+	defer ca.server.Close()
+	ca.enroll(t, client.GetCryptoSuite(), user)
+	user.SetMSPServices(ca.newMSPServices(t, client.GetCryptoSuite()))
+	user.SetTcertRefillThreshold(2)
+	for i := 0; i < 2; i++ {
+		if _, err := user.takeTcert(3); err != nil {
+			t.Fatalf("takeTcert return error[%s]", err)
+		}
+	}
+
+	// the last pooled TCert starts a refill, which the CA holds
+	hold := make(chan struct{})
+	ca.Lock()
+	ca.hold = hold
+	ca.Unlock()
+	taken := make(chan error, 2)
+	take := func() {
+		_, err := user.takeTcert(3)
+		taken <- err
+	}
+	go take()
+	for i := 0; ; i++ {
+		user.tcertMtx.Lock()
+		refilling := user.tcertRefill != nil
+		user.tcertMtx.Unlock()
+		if refilling {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("The TCert pool wasn't refilled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// the pooled TCert is taken while the batch is fetched, and the empty pool waits for it
+	if _, err := user.takeTcert(3); err != nil {
+		t.Fatalf("takeTcert return error[%s]", err)
+	}
+	go take()
+	select {
+	case err := <-taken:
+		t.Fatalf("takeTcert didn't wait for the batch: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(hold)
+	for i := 0; i < 2; i++ {
+		if err := <-taken; err != nil {
+			t.Fatalf("takeTcert return error[%s]", err)
+		}
+	}
+	if batches := ca.getBatches(); batches != 2 {
+		t.Fatalf("%d batches were fetched, expected 2", batches)
+	}
+}